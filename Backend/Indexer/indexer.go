@@ -1,18 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/mail"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime/pprof"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
-	"log"
 )
 
 // Estructura Email
@@ -26,26 +38,79 @@ type Email struct {
 	Subject   string `json:"subject"`
 	Body      string `json:"body"`
 	Folder    string `json:"folder"`
+	// Campos keyword derivados de la ruta del archivo, para filtrar por buzón de forma exacta:
+	// Custodian es el dueño del buzón ("allen-p"); FolderPath, la carpeta normalizada
+	// "custodio/carpeta[/subcarpeta]" sin la raíz del dataset ni "maildir" ("allen-p/inbox"), que
+	// el servidor agrega para construir el árbol de carpetas; FolderLeaf, el último nivel de la
+	// carpeta ("inbox"); y FileName, el nombre del archivo ("12.").
+	Custodian  string `json:"custodian"`
+	FolderPath string `json:"folder_path"`
+	FolderLeaf string `json:"folder_leaf"`
+	FileName   string `json:"file_name"`
+	// SentAt es Date en RFC 3339, para el campo de tipo date del mapping; vacío si Date no se
+	// puede interpretar.
+	SentAt string `json:"sent_at,omitempty"`
 }
 
+// zincBaseURL es la dirección de ZincSearch.
+var zincBaseURL = "http://localhost:4080"
+
+// defaultMappingFile es el mapping versionado del índice, compartido con el servidor. Es
+// relativo a Backend/Indexer; defaultMappingPath lo resuelve.
+const defaultMappingFile = "../Mapping/emails.json"
+
+// defaultMappingPath devuelve defaultMappingFile relativo a la carpeta del ejecutable, para que el
+// indexador compilado encuentre el mapping sin importar desde dónde se lance. Con go run el
+// ejecutable queda en una carpeta temporal; entonces se usa relativo a la carpeta de trabajo.
+func defaultMappingPath() string {
+	if executable, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(executable), defaultMappingFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return defaultMappingFile
+}
+
+// Códigos de salida. exitPreflight indica que la ejecución se abortó antes de leer ningún
+// archivo. Una ejecución interrumpida por una señal termina con 128 + el número de la
+// señal (130 con Ctrl-C, 143 con SIGTERM), como hacen las shells.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitPreflight   = 2 // no se empezó a indexar: credenciales, ZincSearch o índice
+	exitInterrupted = 128
+)
+
 func main() {
+	// "index" administra el índice (crear, borrar, ver, actualizar el mapping) sin indexar.
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		os.Exit(runIndexCommand(os.Args[2:], os.Stdout))
+	}
+	os.Exit(run())
+}
+
+// run ejecuta la indexación y devuelve el código de salida. Está separada de main para que los
+// defer (perfil de CPU, log, servidor de métricas) se ejecuten antes de os.Exit.
+func run() int {
 	// Configuración del archivo de log para registrar el progreso del procesamiento.
 	logFile, err := os.OpenFile("Logs/process_bulk_2000.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Printf("Error creando archivo de log: %v\n", err)
-		return
+		return exitError
 	}
 	defer logFile.Close()
 
-	log.SetOutput(logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	// Logs estructurados en JSON; el nivel se controla con LOG_LEVEL (debug, info, warn, error).
+	setupLogger(logFile)
 
-	log.Println("Iniciando procesamiento con bulk index")
+	slog.Info("Iniciando procesamiento con bulk index")
 
 	// Iniciar perfilado de CPU para analizar el rendimiento de la aplicación.
 	f, err := os.Create("Profiles/cpu_profile_bulk_2000.prof")
 	if err != nil {
-		log.Fatalf("Error creando archivo de perfil: %v", err)
+		slog.Error("Error creando archivo de perfil", "error", err)
+		return exitError
 	}
 	defer f.Close()
 
@@ -56,26 +121,209 @@ func main() {
 	// Configuración para el procesamiento
 	folderPath := "enron_mail_20110402" // Cambia esto a la ruta de tu carpeta
 	indexName := "emails"               // El nombre del índice en ZincSearch
-	batchSize := 2000                   // Tamaño del lote de documentos a enviar por cada solicitud
+	batchSize := 2000                   // Máximo de documentos por lote (el controlador puede usar menos)
+	batchMaxBytes := 8 << 20            // Máximo de bytes (sin comprimir) del cuerpo de cada solicitud _bulk
+	targetLatency := 2 * time.Second    // Latencia de _bulk que busca el controlador adaptativo
 	numWorkers := 16                    // Número de workers concurrentes para procesar archivos
+	checkpointPath := checkpointFile
+	mappingPath := defaultMappingPath() // INDEXER_MAPPING_FILE lo cambia
+	if path := os.Getenv("INDEXER_MAPPING_FILE"); path != "" {
+		mappingPath = path
+	}
+
+	// Comprobaciones previas: credenciales, conexión con ZincSearch e índice con el mapping
+	// esperado. Si algo falla se aborta aquí, antes de recorrer ningún archivo.
+	creds, indexCreatedAt, err := preflight(indexName, mappingPath)
+	if err != nil {
+		slog.Error("Comprobación previa fallida, no se indexa nada", "index", indexName, "error", err)
+		fmt.Fprintf(os.Stderr, "No se puede indexar: %v\n", err)
+		return exitPreflight
+	}
+	bulk := bulkConfig{
+		IndexName:   indexName,
+		MaxBytes:    batchMaxBytes,
+		Credentials: creds,
+		// INDEXER_GZIP=true comprime los cuerpos _bulk (Content-Encoding: gzip).
+		Gzip: strings.EqualFold(os.Getenv("INDEXER_GZIP"), "true"),
+	}
+
+	// Progreso en vivo: en la salida de errores (el log va a un archivo) y, si se define
+	// INDEXER_METRICS_ADDR (por ejemplo, ":9100"), en /metrics mientras dura la ejecución.
+	stats = newProgress(numWorkers)
+	ctrl := newBatchController(batchSize, numWorkers, targetLatency)
+	stats.ctrl = ctrl
+	displayDone := make(chan struct{})
+	displayStopped := make(chan struct{})
+	go func() {
+		runProgressDisplay(os.Stderr, time.Second, displayDone)
+		close(displayStopped)
+	}()
+	if addr := os.Getenv("INDEXER_METRICS_ADDR"); addr != "" {
+		metricsServer := serveMetrics(addr)
+		defer metricsServer.Close()
+	}
+
+	// Con SIGINT o SIGTERM se cancela ctx: se deja de recorrer la carpeta y los workers envían lo
+	// que tengan acumulado antes de terminar. Una segunda señal mata el proceso sin esperar.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var interrupted atomic.Value // os.Signal recibida
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		signal.Stop(signals)
+		interrupted.Store(sig)
+		slog.Warn("Señal recibida, terminando los lotes en curso", "signal", sig.String())
+		fmt.Fprintf(os.Stderr, "\n%s: terminando los lotes en curso (otra vez para salir sin esperar)...\n", sig)
+		cancel()
+	}()
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+
+	// El checkpoint guarda los custodios indexados por completo; si la ejecución anterior no
+	// terminó, se retoma saltando esos custodios.
+	cp, err := loadCheckpoint(checkpointPath, folderPath, indexName, indexCreatedAt)
+	if err != nil {
+		slog.Warn("Error leyendo el checkpoint, se indexa todo", "path", checkpointPath, "error", err)
+		cp = newCheckpoint(checkpointPath, folderPath, indexName, indexCreatedAt)
+	}
+	if len(cp.Completed) > 0 {
+		slog.Info("Retomando desde el checkpoint", "path", checkpointPath, "completed_custodians", len(cp.Completed))
+		fmt.Fprintf(os.Stderr, "Retomando: %d custodios ya indexados según %s\n", len(cp.Completed), checkpointPath)
+	}
 
 	start := time.Now()
-	log.Printf("Procesando carpeta: %s\n", folderPath)
+	slog.Info("Procesando carpeta", "folder", folderPath, "index", indexName, "workers", numWorkers,
+		"batch_size", batchSize, "batch_max_bytes", batchMaxBytes, "target_latency", targetLatency.String(),
+		"gzip", bulk.Gzip)
 
 	// Llama a la función que procesa la carpeta de manera concurrente
-	err = processFolderConcurrent(folderPath, indexName, numWorkers, batchSize)
+	code := exitOK
+	err = processFolderConcurrent(ctx, folderPath, numWorkers, ctrl, bulk, cp)
 	if err != nil {
-		log.Printf("Error procesando carpeta: %v\n", err)
+		slog.Error("Error procesando carpeta", "folder", folderPath, "error", err)
+		code = exitError
 	}
+	close(displayDone)
+	<-displayStopped
 
 	// Registra el tiempo de duración del procesamiento
 	duration := time.Since(start)
-	log.Printf("Procesamiento completado en %s\n", duration)
+	sig, _ := interrupted.Load().(os.Signal)
+	if sig != nil {
+		slog.Warn("Procesamiento interrumpido", "signal", sig.String(), "duration", duration.String())
+		if s, ok := sig.(syscall.Signal); ok {
+			code = exitInterrupted + int(s)
+		}
+	} else {
+		slog.Info("Procesamiento completado", "duration", duration.String())
+	}
+
+	// Guardar el checkpoint, o borrarlo si ya no queda nada pendiente
+	finished, err := cp.save()
+	switch {
+	case err != nil:
+		slog.Error("Error guardando el checkpoint", "path", checkpointPath, "error", err)
+	case finished:
+		slog.Info("Carpeta indexada por completo, checkpoint eliminado", "path", checkpointPath)
+	default:
+		slog.Info("Checkpoint guardado", "path", checkpointPath, "completed_custodians", len(cp.Completed))
+		fmt.Fprintf(os.Stderr, "Checkpoint guardado en %s (%d custodios completos); vuelve a ejecutar para continuar\n",
+			checkpointPath, len(cp.Completed))
+	}
+	logSummary(stats.snapshot(), sig)
+
+	// Avisa al servidor de que hay una nueva versión del índice para que invalide su caché
+	if err := notifyIndexVersion(time.Now().UTC().Format(time.RFC3339)); err != nil {
+		slog.Warn("Error notificando la versión del índice", "error", err)
+	}
+	return code
+}
+
+// logSummary registra el resumen final de la ejecución.
+func logSummary(s progressSnapshot, sig os.Signal) {
+	attrs := []any{
+		"interrupted", sig != nil,
+		"duration", s.Elapsed.Round(time.Millisecond).String(),
+		"files_discovered", s.FilesDiscovered,
+		"files_processed", s.FilesProcessed,
+		"docs_indexed", s.DocsIndexed,
+		"batches", s.Batches,
+		"read_bytes", s.BytesRead,
+		"sent_bytes", s.BytesSent,
+		"docs_per_second", math.Round(s.DocsPerSec),
+	}
+	for _, category := range errorCategories {
+		attrs = append(attrs, "errors_"+category, s.Errors[category])
+	}
+	slog.Info("Resumen", attrs...)
+}
+
+// notifyIndexVersion informa al servidor de búsqueda de la nueva versión del índice.
+// Solo se hace si está definida la variable SERVER_URL (por ejemplo, http://localhost:8080).
+// SERVER_API_KEY es opcional y se envía en la cabecera X-API-Key.
+func notifyIndexVersion(version string) error {
+	serverURL := os.Getenv("SERVER_URL")
+	if serverURL == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{"version": version})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(serverURL, "/")+"/api/index/version", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey := os.Getenv("SERVER_API_KEY"); apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error enviando la versión del índice: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("el servidor rechazó la versión del índice: %s", body)
+	}
+
+	slog.Info("Versión del índice notificada al servidor", "index_version", version)
+	return nil
+}
+
+// setupLogger instala un logger JSON sobre w como logger por defecto.
+func setupLogger(w io.Writer) {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, AddSource: true})))
 }
 
 // processFolderConcurrent procesa los archivos en la carpeta de manera concurrente utilizando workers.
 // La carpeta de archivos se recorre con filepath.Walk y cada archivo es enviado a los workers.
-func processFolderConcurrent(folderPath, indexName string, numWorkers, batchSize int) error {
+// El tamaño de los lotes y el número de envíos simultáneos los decide ctrl. Los custodios que cp
+// da por completos se saltan. Si ctx se cancela, el recorrido se detiene y la función vuelve
+// cuando los workers han enviado sus lotes pendientes.
+func processFolderConcurrent(ctx context.Context, folderPath string, numWorkers int, ctrl *batchController, bulk bulkConfig, cp *checkpoint) error {
 	// Canal para transmitir las rutas de los archivos a los workers
 	files := make(chan string, 10000) // Canal con buffer grande para evitar bloqueos
 	wg := &sync.WaitGroup{}
@@ -83,20 +331,48 @@ func processFolderConcurrent(folderPath, indexName string, numWorkers, batchSize
 	// Iniciar los workers concurrentes
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go workerBulk(files, indexName, wg, batchSize)
+		go workerBulk(ctx, i, folderPath, files, wg, ctrl, bulk, cp)
 	}
 
-	// Recorrer los archivos en la carpeta y enviarlos al canal
+	// Recorrer los archivos en la carpeta y enviarlos al canal. filepath.Walk visita las rutas en
+	// orden léxico, así que cuando cambia el custodio el anterior ya está recorrido entero.
+	current := ""
 	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
 		if err != nil {
-			log.Printf("Error accediendo a %s: %v", path, err)
+			slog.Warn("Error accediendo a la ruta", "path", path, "error", err)
+			stats.addError(errWalk)
 			return nil // Continuar procesando otros archivos
 		}
-		if !info.IsDir() {
-			files <- path // Enviar ruta de archivo al canal
+		if info.IsDir() {
+			if custodian, ok := custodianDir(folderPath, path); ok && cp.isCompleted(custodian) {
+				slog.Debug("Saltando custodio ya indexado", "custodian", custodian)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		custodian := custodianOf(folderPath, path)
+		if custodian != current {
+			cp.walked(current)
+			current = custodian
+		}
+		cp.dispatch(custodian)
+		stats.filesDiscovered.Add(1)
+		select {
+		case files <- path: // Enviar ruta de archivo al canal
+		case <-ctx.Done():
+			return filepath.SkipAll
 		}
 		return nil
 	})
+	if ctx.Err() == nil {
+		cp.walked(current)
+		cp.walkFinished()
+	}
+	stats.walkDone.Store(true)
 
 	// Cerrar el canal cuando se haya procesado todo
 	close(files)
@@ -104,109 +380,1043 @@ func processFolderConcurrent(folderPath, indexName string, numWorkers, batchSize
 	return err
 }
 
+// bulkConfig agrupa cómo se envían los lotes a ZincSearch.
+type bulkConfig struct {
+	IndexName   string
+	MaxBytes    int  // tamaño máximo (aproximado, sin comprimir) del cuerpo de cada lote
+	Gzip        bool // comprimir los cuerpos con gzip
+	Credentials zincCredentials
+}
+
 // workerBulk es una función que ejecuta el procesamiento de archivos en paralelo y
-// envía los lotes de documentos a la API de ZincSearch.
-func workerBulk(files <-chan string, indexName string, wg *sync.WaitGroup, batchSize int) {
+// envía los lotes de documentos a la API de ZincSearch. Un lote se cierra al llegar al número
+// de documentos que indica ctrl o cuando el siguiente documento haría pasar el cuerpo de
+// bulk.MaxBytes. Cuando ctx se cancela, el worker deja de tomar archivos y envía el lote que
+// tenga a medias.
+func workerBulk(ctx context.Context, id int, folderPath string, files <-chan string, wg *sync.WaitGroup, ctrl *batchController, bulk bulkConfig, cp *checkpoint) {
 	defer wg.Done() // Asegura que la goroutine se marca como terminada al finalizar
+	defer stats.setWorker(id, "done", "")
 	client := &http.Client{}
-	var bulkData []Email // Slice para almacenar los correos electrónicos a indexar en un lote
+	batch := &bulkBatch{} // Se reutiliza entre lotes
 
 	// Procesar los archivos recibidos desde el canal
-	for path := range files {
+	for ctx.Err() == nil {
+		path, ok := <-files
+		if !ok {
+			break
+		}
+		stats.setWorker(id, "reading", path)
 		content, err := os.ReadFile(path)
+		stats.filesProcessed.Add(1)
 		if err != nil {
-			log.Printf("Error leyendo archivo %s: %v\n", path, err)
+			slog.Warn("Error leyendo archivo", "path", path, "error", err)
+			stats.addError(errRead)
+			// Reintentarlo no cambiaría nada: cuenta como terminado para el checkpoint.
+			cp.finish(custodianOf(folderPath, path), 1, true)
 			continue
 		}
+		stats.bytesRead.Add(int64(len(content)))
 
 		// Parsear el contenido del archivo a un objeto Email
 		email := parseEmail(string(content))
 		if email.MessageID == "" {
-			log.Printf("Saltando archivo sin Message-ID: %s\n", path)
+			slog.Debug("Saltando archivo sin Message-ID", "path", path)
+			stats.addError(errSkipped)
+			cp.finish(custodianOf(folderPath, path), 1, true)
 			continue
 		}
 
 		// Establecer el campo "folder" que contiene la ruta del archivo
 		email.Folder = filepath.Join(filepath.Dir(path), filepath.Base(path))
+		setPathFields(&email, folderPath, path)
+		email.SentAt = sentAt(email.Date)
 		// Limpiar el cuerpo del correo (eliminar saltos de línea innecesarios)
 		email.Body = cleanBody(email.Body)
 
+		// Si el correo no cabe en el lote actual, enviar primero lo acumulado. Un correo que por
+		// sí solo supera el límite se envía en un lote propio.
+		size := bulkLineSize(&email)
+		if len(batch.emails) > 0 && batch.bytes+size > bulk.MaxBytes {
+			sendBatch(id, batch, client, ctrl, bulk, cp)
+		}
+		if size > bulk.MaxBytes {
+			slog.Warn("Correo mayor que el tamaño máximo de lote", "path", path, "bytes", size, "batch_max_bytes", bulk.MaxBytes)
+		}
+
 		// Agregar el correo al lote
-		bulkData = append(bulkData, email)
+		batch.add(email, size)
 
-		// Si el lote alcanza el tamaño configurado, enviarlo
-		if len(bulkData) >= batchSize {
-			if err := sendBulk(indexName, bulkData, client); err != nil {
-				log.Printf("Error indexando lote: %v\n", err)
-			}
-			bulkData = nil // Reiniciar el slice para el siguiente lote
+		// Si el lote alcanza el tamaño que indica el controlador, enviarlo
+		if len(batch.emails) >= ctrl.batchDocs() || batch.bytes >= bulk.MaxBytes {
+			sendBatch(id, batch, client, ctrl, bulk, cp)
 		}
 	}
 
-	// Enviar el último lote si queda algún correo sin procesar
-	if len(bulkData) > 0 {
-		if err := sendBulk(indexName, bulkData, client); err != nil {
-			log.Printf("Error indexando lote final: %v\n", err)
+	// Enviar el último lote si queda algún correo sin procesar (también al interrumpir)
+	if len(batch.emails) > 0 {
+		sendBatch(id, batch, client, ctrl, bulk, cp)
+	}
+}
+
+// bulkAction es la línea de acción que precede a cada documento en la API _bulk.
+var bulkAction = []byte(`{"index":{}}` + "\n")
+
+// emptyDocSize es lo que ocupa en JSON un Email vacío (nombres de campo, comillas y comas).
+var emptyDocSize = func() int {
+	doc, _ := json.Marshal(Email{})
+	return len(doc)
+}()
+
+// bulkBatch acumula los correos de un lote y el tamaño estimado de su cuerpo _bulk. Los correos
+// se serializan al enviarlo, directamente sobre la conexión.
+type bulkBatch struct {
+	emails []Email
+	bytes  int
+}
+
+func (b *bulkBatch) add(email Email, size int) {
+	b.emails = append(b.emails, email)
+	b.bytes += size
+}
+
+// reset vacía el lote conservando la capacidad del slice.
+func (b *bulkBatch) reset() {
+	clear(b.emails)
+	b.emails = b.emails[:0]
+	b.bytes = 0
+}
+
+// bulkLineSize estima lo que ocupa un correo en el cuerpo _bulk (línea de acción incluida) sin
+// serializarlo. No cuenta los caracteres que JSON escapa, así que puede quedarse algo corto.
+func bulkLineSize(email *Email) int {
+	fields := len(email.MessageID) + len(email.Date) + len(email.From) + len(email.To) +
+		len(email.Subject) + len(email.Body) + len(email.Folder) + len(email.Custodian) +
+		len(email.FolderPath) + len(email.FolderLeaf) + len(email.FileName) + len(email.SentAt)
+	return len(bulkAction) + emptyDocSize + fields + 1
+}
+
+// sendBatch envía el lote cuando el controlador lo permite, le informa de la latencia y del
+// resultado, registra el lote en el progreso y en el checkpoint y lo vacía para reutilizarlo.
+func sendBatch(id int, batch *bulkBatch, client *http.Client, ctrl *batchController, bulk bulkConfig, cp *checkpoint) {
+	stats.setWorker(id, "waiting", "")
+	ctrl.acquire()
+	stats.setWorker(id, "sending", "")
+	start := time.Now()
+	sent, err := sendBulk(bulk, batch.emails, client)
+	latency := time.Since(start)
+	ctrl.release(latency, err)
+	stats.observeBatch(id, len(batch.emails), int(sent), latency, err)
+	for i := range batch.emails {
+		cp.finish(batch.emails[i].Custodian, 1, err == nil)
+	}
+	if err != nil {
+		slog.Error("Error indexando lote", "docs", len(batch.emails), "bytes", sent, "error", err)
+	} else {
+		slog.Info("Lote indexado", "docs", len(batch.emails), "bytes", sent, "latency", latency.String())
+	}
+	batch.reset()
+}
+
+// batchController ajusta el tamaño de los lotes y el número de envíos simultáneos según la
+// latencia y los errores de _bulk (aumento aditivo, reducción multiplicativa): si un lote falla o
+// tarda más de 1,5 veces la latencia objetivo, reduce el lote a la mitad y permite un envío
+// simultáneo menos; si tarda menos de la mitad del objetivo y casi no hay errores, aumenta el
+// lote un 5 % del máximo y permite un envío más.
+type batchController struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	target time.Duration
+
+	minDocs, maxDocs int
+	docs             int // documentos por lote actuales
+
+	maxLimit int // envíos simultáneos como máximo (uno por worker)
+	limit    int // envíos simultáneos permitidos ahora
+	active   int // envíos en curso
+
+	errorRate float64 // media móvil de lotes fallidos
+}
+
+// minBatchDocs es el tamaño mínimo al que el controlador reduce los lotes.
+const minBatchDocs = 10
+
+func newBatchController(maxDocs, workers int, target time.Duration) *batchController {
+	c := &batchController{
+		target:   target,
+		minDocs:  minBatchDocs,
+		maxDocs:  maxDocs,
+		docs:     maxDocs,
+		maxLimit: workers,
+		limit:    workers,
+	}
+	if c.minDocs > maxDocs {
+		c.minDocs = maxDocs
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// batchDocs devuelve el número de documentos con el que se debe cerrar un lote.
+func (c *batchController) batchDocs() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.docs
+}
+
+// acquire espera a que haya hueco para un envío más.
+func (c *batchController) acquire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.active >= c.limit {
+		c.cond.Wait()
+	}
+	c.active++
+}
+
+// release termina un envío y ajusta el lote y la concurrencia con su resultado.
+func (c *batchController) release(latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	c.errorRate = 0.8*c.errorRate + 0.2*failed
+
+	switch {
+	case err != nil || latency > c.target*3/2:
+		c.docs /= 2
+		if c.docs < c.minDocs {
+			c.docs = c.minDocs
+		}
+		if c.limit > 1 {
+			c.limit--
+		}
+	case latency < c.target/2 && c.errorRate < 0.05:
+		step := c.maxDocs / 20
+		if step < 1 {
+			step = 1
+		}
+		c.docs += step
+		if c.docs > c.maxDocs {
+			c.docs = c.maxDocs
+		}
+		if c.limit < c.maxLimit {
+			c.limit++
 		}
 	}
+	c.cond.Broadcast()
 }
 
-// sendBulk envía un lote de correos electrónicos a la API de ZincSearch
-// Utiliza la API _bulk para enviar los documentos de forma eficiente.
-func sendBulk(indexName string, emails []Email, client *http.Client) error {
-	zincURL := fmt.Sprintf("http://localhost:4080/api/%s/_bulk", indexName)
-	var buffer bytes.Buffer
+// state devuelve el tamaño de lote y la concurrencia actuales.
+func (c *batchController) state() (docs, limit int, errorRate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.docs, c.limit, c.errorRate
+}
+
+// normalizedFolderPath devuelve la carpeta del archivo relativa a la raíz del dataset, con "/"
+// como separador y sin el directorio "maildir" (por ejemplo, "allen-p/inbox").
+func normalizedFolderPath(root, path string) string {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	rel = strings.TrimPrefix(rel, "maildir/")
+	if rel == "maildir" {
+		return ""
+	}
+	return rel
+}
+
+// setPathFields rellena los campos keyword del correo a partir de la ruta del archivo.
+func setPathFields(email *Email, root, path string) {
+	email.FolderPath = normalizedFolderPath(root, path)
+	email.Custodian, _, _ = strings.Cut(email.FolderPath, "/")
+	email.FolderLeaf = email.FolderPath[strings.LastIndex(email.FolderPath, "/")+1:]
+	email.FileName = filepath.Base(path)
+}
+
+// custodianOf devuelve el custodio (primer nivel de la carpeta normalizada) de un archivo.
+func custodianOf(root, path string) string {
+	custodian, _, _ := strings.Cut(normalizedFolderPath(root, path), "/")
+	return custodian
+}
+
+// custodianDir indica si dir es la carpeta de un custodio y devuelve cuál.
+func custodianDir(root, dir string) (string, bool) {
+	folder := normalizedFolderPath(root, filepath.Join(dir, "_"))
+	return folder, folder != "" && !strings.Contains(folder, "/")
+}
+
+// checkpointFile es donde se guarda el checkpoint entre ejecuciones.
+var checkpointFile = "Logs/checkpoint_bulk_2000.json"
+
+// checkpoint registra qué custodios se han indexado por completo para poder retomar una
+// ejecución interrumpida. Un custodio está completo cuando el recorrido ya ha pasado por todos sus
+// archivos y todos se han enviado sin error (o no se podían indexar: ilegibles o sin
+// Message-ID). Los custodios a medias se vuelven a indexar enteros al retomar, así que sus
+// documentos ya enviados pueden quedar duplicados. IndexCreatedAt es la fecha de creación del
+// índice que informa ZincSearch: si el índice se ha borrado y vuelto a crear, no coincide y el
+// checkpoint se ignora.
+type checkpoint struct {
+	path string
+
+	Folder         string    `json:"folder"`
+	Index          string    `json:"index"`
+	IndexCreatedAt string    `json:"index_created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Completed      []string  `json:"completed_custodians"`
+
+	mu        sync.Mutex
+	completed map[string]bool
+	pending   map[string]*custodianProgress
+	walkDone  bool // el recorrido llegó al final sin interrumpirse
+}
+
+// custodianProgress es el avance de un custodio en la ejecución actual.
+type custodianProgress struct {
+	dispatched int  // archivos enviados a los workers
+	finished   int  // archivos indexados o descartados
+	failed     bool // algún lote con archivos suyos falló
+	walked     bool // el recorrido ya pasó por todos sus archivos
+}
+
+func newCheckpoint(path, folder, index, indexCreatedAt string) *checkpoint {
+	return &checkpoint{
+		path:           path,
+		Folder:         folder,
+		Index:          index,
+		IndexCreatedAt: indexCreatedAt,
+		completed:      make(map[string]bool),
+		pending:        make(map[string]*custodianProgress),
+	}
+}
+
+// loadCheckpoint lee el checkpoint de path. Si no existe, o es de otra carpeta, de otro índice o
+// de otra instancia del índice (indexCreatedAt distinto o desconocido), devuelve uno vacío.
+func loadCheckpoint(path, folder, index, indexCreatedAt string) (*checkpoint, error) {
+	cp := newCheckpoint(path, folder, index, indexCreatedAt)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Folder != folder || saved.Index != index {
+		slog.Warn("El checkpoint es de otra carpeta o de otro índice, se ignora",
+			"path", path, "folder", saved.Folder, "index", saved.Index)
+		return cp, nil
+	}
+	if indexCreatedAt == "" || saved.IndexCreatedAt != indexCreatedAt {
+		slog.Warn("El checkpoint es de un índice que se ha vuelto a crear desde entonces, se ignora",
+			"path", path, "index", index, "checkpoint_index_created_at", saved.IndexCreatedAt, "index_created_at", indexCreatedAt)
+		return cp, nil
+	}
+	cp.Completed = saved.Completed
+	for _, custodian := range saved.Completed {
+		cp.completed[custodian] = true
+	}
+	return cp, nil
+}
+
+func (c *checkpoint) isCompleted(custodian string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.completed[custodian]
+}
+
+func (c *checkpoint) progress(custodian string) *custodianProgress {
+	p := c.pending[custodian]
+	if p == nil {
+		p = &custodianProgress{}
+		c.pending[custodian] = p
+	}
+	return p
+}
+
+func (c *checkpoint) dispatch(custodian string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress(custodian).dispatched++
+}
+
+func (c *checkpoint) walked(custodian string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress(custodian).walked = true
+}
+
+func (c *checkpoint) walkFinished() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.walkDone = true
+}
+
+func (c *checkpoint) finish(custodian string, files int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.progress(custodian)
+	p.finished += files
+	p.failed = p.failed || !ok
+}
+
+// save incorpora los custodios que se han completado en esta ejecución y escribe el checkpoint.
+// Si el recorrido terminó y no queda nada pendiente, borra el archivo y devuelve finished = true,
+// de modo que la siguiente ejecución vuelve a empezar desde el principio.
+func (c *checkpoint) save() (finished bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	finished = c.walkDone
+	for custodian, p := range c.pending {
+		if !p.walked || p.failed || p.finished < p.dispatched {
+			finished = false
+			continue
+		}
+		// Los archivos que no cuelgan de ningún custodio no se pueden saltar al retomar.
+		if custodian != "" {
+			c.completed[custodian] = true
+		}
+	}
+	if finished {
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			return true, err
+		}
+		return true, nil
+	}
+
+	c.Completed = make([]string, 0, len(c.completed))
+	for custodian := range c.completed {
+		c.Completed = append(c.Completed, custodian)
+	}
+	sort.Strings(c.Completed)
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	// Escribir en un archivo temporal y renombrarlo, para no dejar un checkpoint a medias.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return false, err
+	}
+	return false, os.Rename(tmp, c.path)
+}
+
+// removeCheckpoint borra el checkpoint de path si es del índice indicado. Se usa al borrar o crear
+// el índice con el subcomando index, porque los custodios que marca ya no están indexados.
+func removeCheckpoint(path, index string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var saved checkpoint
+	if json.Unmarshal(data, &saved) == nil && saved.Index != index {
+		return false, nil
+	}
+	return true, os.Remove(path)
+}
+
+// zincCredentials son las credenciales de autenticación básica de ZincSearch.
+type zincCredentials struct {
+	User     string
+	Password string
+}
+
+// credentialsFromEnv lee las credenciales de ZINC_FIRST_ADMIN_USER y ZINC_FIRST_ADMIN_PASSWORD.
+func credentialsFromEnv() (zincCredentials, error) {
+	creds := zincCredentials{
+		User:     os.Getenv("ZINC_FIRST_ADMIN_USER"),
+		Password: os.Getenv("ZINC_FIRST_ADMIN_PASSWORD"),
+	}
+	if creds.User == "" || creds.Password == "" {
+		return creds, fmt.Errorf("las variables de entorno ZINC_FIRST_ADMIN_USER y ZINC_FIRST_ADMIN_PASSWORD deben estar definidas")
+	}
+	return creds, nil
+}
+
+// preflightClient se usa en las comprobaciones previas; el plazo evita quedarse esperando a un
+// ZincSearch que acepta conexiones pero no responde.
+var preflightClient = &http.Client{Timeout: 10 * time.Second}
+
+// preflight comprueba, antes de empezar a indexar, que hay credenciales, que ZincSearch responde
+// y las acepta, y que el índice tiene el mapping de mappingPath. Si el índice no existe lo crea;
+// si le faltan campos, los añade; si un campo tiene otro tipo, falla (hay que recrear el índice).
+// Devuelve las credenciales para los envíos _bulk y la fecha de creación del índice, con la que
+// se comprueba que el checkpoint es de este mismo índice.
+func preflight(indexName, mappingPath string) (zincCredentials, string, error) {
+	creds, err := credentialsFromEnv()
+	if err != nil {
+		return creds, "", err
+	}
+	mapping, err := loadMapping(mappingPath)
+	if err != nil {
+		return creds, "", err
+	}
+
+	// /healthz no requiere autenticación: distingue "ZincSearch caído" de "credenciales malas".
+	status, body, err := zincRequest("GET", "/healthz", nil, zincCredentials{})
+	if err != nil {
+		return creds, "", fmt.Errorf("ZincSearch no responde en %s: %w", zincBaseURL, err)
+	}
+	if status != http.StatusOK {
+		return creds, "", fmt.Errorf("ZincSearch en %s no está sano (HTTP %d): %s", zincBaseURL, status, body)
+	}
+
+	index, err := getIndex(indexName, creds)
+	if err != nil {
+		return creds, "", err
+	}
+	if index == nil {
+		if err := createIndex(indexName, mapping, creds); err != nil {
+			return creds, "", err
+		}
+		slog.Info("Índice creado", "index", indexName, "mapping_version", mapping.Version)
+		if index, err = getIndex(indexName, creds); err != nil || index == nil {
+			return creds, "", err
+		}
+		return creds, index.CreateAt, nil
+	}
+	if differences := diffMapping(mapping, index).Differences; len(differences) > 0 {
+		slog.Warn("El índice difiere del mapping en campos que no se pueden cambiar sin recrearlo",
+			"index", indexName, "mapping_version", mapping.Version, "differences", differences)
+	}
+	added, err := updateMapping(indexName, mapping, index, creds)
+	if err != nil {
+		return creds, "", err
+	}
+	if len(added) > 0 {
+		slog.Info("Campos añadidos al mapping", "index", indexName, "fields", added, "mapping_version", mapping.Version)
+	}
+	return creds, index.CreateAt, nil
+}
+
+// indexMapping es el mapping versionado del índice (Backend/Mapping/emails.json): los ajustes
+// (analizadores) y el tipo de cada campo. El servidor lee el mismo archivo para comprobar el
+// índice al arrancar. indexMapping, loadMapping, diffMapping y propertyChanges duplican el
+// paquete internal/mapping del servidor, porque el indexador no tiene módulo propio y no puede
+// importarlo; cualquier cambio en uno debe hacerse también en el otro. TestLoadMapping_SharedFile
+// y su equivalente en el servidor comprueban que ambos leen el archivo igual.
+type indexMapping struct {
+	Version  int             `json:"version"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	Mappings struct {
+		Properties map[string]mappingProperty `json:"properties"`
+	} `json:"mappings"`
+}
+
+// mappingProperty es la definición de un campo en ZincSearch. index hace el campo buscable;
+// store guarda su valor en el índice (necesario para resaltarlo); el resto de banderas activan
+// ordenación, agregaciones y resaltado.
+type mappingProperty struct {
+	Type           string `json:"type"`
+	Index          bool   `json:"index"`
+	Store          bool   `json:"store"`
+	Sortable       bool   `json:"sortable"`
+	Aggregatable   bool   `json:"aggregatable"`
+	Highlightable  bool   `json:"highlightable"`
+	Analyzer       string `json:"analyzer,omitempty"`
+	SearchAnalyzer string `json:"search_analyzer,omitempty"`
+	Format         string `json:"format,omitempty"`
+}
+
+var mappingTypes = []string{"text", "keyword", "date", "numeric", "bool"}
+
+// loadMapping lee y valida el archivo de mapping.
+func loadMapping(path string) (*indexMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo el mapping: %w", err)
+	}
+	var mapping indexMapping
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	if mapping.Version < 1 {
+		return nil, fmt.Errorf("mapping %s: version debe ser un entero positivo", path)
+	}
+	if len(mapping.Mappings.Properties) == 0 {
+		return nil, fmt.Errorf("mapping %s: no declara ningún campo", path)
+	}
+	for _, field := range mapping.fields() {
+		property := mapping.Mappings.Properties[field]
+		if !slices.Contains(mappingTypes, property.Type) {
+			return nil, fmt.Errorf("mapping %s: el campo %q tiene un tipo desconocido %q", path, field, property.Type)
+		}
+	}
+	return &mapping, nil
+}
 
-	// Construir el cuerpo del request en formato bulk
-	for _, email := range emails {
-		action := map[string]interface{}{
-			"index": map[string]string{}, // Acción de indexación (formato esperado por la API _bulk)
+// fields devuelve los nombres de los campos ordenados.
+func (m *indexMapping) fields() []string {
+	fields := make([]string, 0, len(m.Mappings.Properties))
+	for field := range m.Mappings.Properties {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// zincIndex es lo que devuelve ZincSearch de un índice existente.
+type zincIndex struct {
+	Name     string          `json:"name"`
+	CreateAt string          `json:"create_at"`
+	Settings json.RawMessage `json:"settings"`
+	Mappings struct {
+		Properties map[string]mappingProperty `json:"properties"`
+	} `json:"mappings"`
+	Stats struct {
+		DocNum int `json:"doc_num"`
+	} `json:"stats"`
+}
+
+// getIndex lee el índice; devuelve nil si no existe.
+func getIndex(indexName string, creds zincCredentials) (*zincIndex, error) {
+	status, body, err := zincRequest("GET", "/api/index/"+indexName, nil, creds)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando el índice %q: %w", indexName, err)
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("ZincSearch rechazó las credenciales del usuario %q (HTTP %d)", creds.User, status)
+	default:
+		return nil, fmt.Errorf("error consultando el índice %q (HTTP %d): %s", indexName, status, body)
+	}
+	var index zincIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("error leyendo el mapping del índice %q: %w", indexName, err)
+	}
+	return &index, nil
+}
+
+// mappingDiff compara el mapping del archivo con el del índice. Missing son los campos que el
+// índice no tiene (se pueden añadir); Conflicts, los que tienen otro tipo (ZincSearch no permite
+// cambiarlo: hay que recrear el índice); Differences, otras diferencias de un campo (analizador,
+// formato, banderas) que tampoco se pueden cambiar en un índice existente.
+type mappingDiff struct {
+	Missing     []string
+	Conflicts   []string
+	Differences []string
+}
+
+func diffMapping(want *indexMapping, live *zincIndex) mappingDiff {
+	var diff mappingDiff
+	for _, field := range want.fields() {
+		expected := want.Mappings.Properties[field]
+		actual, ok := live.Mappings.Properties[field]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, field)
+		case actual.Type != expected.Type:
+			diff.Conflicts = append(diff.Conflicts, fmt.Sprintf("%s: tipo %q, se esperaba %q", field, actual.Type, expected.Type))
+		case actual != expected:
+			diff.Differences = append(diff.Differences, field+": "+strings.Join(propertyChanges(actual, expected), ", "))
+		}
+	}
+	return diff
+}
+
+// propertyChanges describe los atributos de actual que no coinciden con expected.
+func propertyChanges(actual, expected mappingProperty) []string {
+	var changes []string
+	compare := func(name string, actual, expected any) {
+		if actual != expected {
+			changes = append(changes, fmt.Sprintf("%s %v (se esperaba %v)", name, actual, expected))
+		}
+	}
+	compare("index", actual.Index, expected.Index)
+	compare("store", actual.Store, expected.Store)
+	compare("sortable", actual.Sortable, expected.Sortable)
+	compare("aggregatable", actual.Aggregatable, expected.Aggregatable)
+	compare("highlightable", actual.Highlightable, expected.Highlightable)
+	compare("analyzer", strconv.Quote(actual.Analyzer), strconv.Quote(expected.Analyzer))
+	compare("search_analyzer", strconv.Quote(actual.SearchAnalyzer), strconv.Quote(expected.SearchAnalyzer))
+	compare("format", strconv.Quote(actual.Format), strconv.Quote(expected.Format))
+	return changes
+}
+
+// createIndex crea el índice con los ajustes y el mapping del archivo.
+func createIndex(indexName string, mapping *indexMapping, creds zincCredentials) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"name":         indexName,
+		"storage_type": "disk",
+		"settings":     mapping.Settings,
+		"mappings":     mapping.Mappings,
+	})
+	if err != nil {
+		return err
+	}
+	status, body, err := zincRequest("POST", "/api/index", payload, creds)
+	if err != nil {
+		return fmt.Errorf("error creando el índice %q: %w", indexName, err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("ZincSearch no pudo crear el índice %q (HTTP %d): %s", indexName, status, body)
+	}
+	return nil
+}
+
+// updateMapping añade al índice los campos del archivo que le faltan y devuelve cuáles añadió.
+// Falla, sin cambiar nada, si algún campo existente tiene otro tipo.
+func updateMapping(indexName string, mapping *indexMapping, index *zincIndex, creds zincCredentials) ([]string, error) {
+	diff := diffMapping(mapping, index)
+	if len(diff.Conflicts) > 0 {
+		return nil, fmt.Errorf("el índice %q no coincide con el mapping v%d y ZincSearch no permite cambiar el tipo de un campo; borra y vuelve a crear el índice:\n  %s",
+			indexName, mapping.Version, strings.Join(diff.Conflicts, "\n  "))
+	}
+	if len(diff.Missing) == 0 {
+		return nil, nil
+	}
+
+	// Los analizadores propios que usen los campos nuevos deben existir antes que los campos.
+	if len(mapping.Settings) > 0 {
+		status, body, err := zincRequest("PUT", fmt.Sprintf("/api/%s/_settings", indexName), mapping.Settings, creds)
+		if err != nil {
+			return nil, fmt.Errorf("error enviando los ajustes: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("ZincSearch rechazó los ajustes del índice %q (HTTP %d): %s", indexName, status, body)
+		}
+	}
+
+	properties := make(map[string]mappingProperty, len(diff.Missing))
+	for _, field := range diff.Missing {
+		properties[field] = mapping.Mappings.Properties[field]
+	}
+	payload, err := json.Marshal(map[string]interface{}{"properties": properties})
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := zincRequest("PUT", fmt.Sprintf("/api/%s/_mapping", indexName), payload, creds)
+	if err != nil {
+		return nil, fmt.Errorf("error enviando el mapping: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("ZincSearch rechazó el mapping del índice %q (HTTP %d): %s", indexName, status, body)
+	}
+	return diff.Missing, nil
+}
+
+// runIndexCommand implementa "indexer index <create|delete|show|update-mapping>", que administra
+// el índice con el mapping versionado sin indexar correos. Devuelve el código de salida.
+func runIndexCommand(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("index", flag.ContinueOnError)
+	indexName := flags.String("name", "emails", "nombre del índice en ZincSearch")
+	mappingPath := flags.String("mapping", defaultMappingPath(), "archivo de mapping versionado")
+	yes := flags.Bool("yes", false, "confirmar delete")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Uso: go run indexer.go index <create|delete|show|update-mapping> [flags]")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitError
+	}
+	if os.Getenv("INDEXER_MAPPING_FILE") != "" && !isFlagSet(flags, "mapping") {
+		*mappingPath = os.Getenv("INDEXER_MAPPING_FILE")
+	}
+
+	creds, err := credentialsFromEnv()
+	if err == nil {
+		err = indexCommand(action, *indexName, *mappingPath, *yes, creds, out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "index %s: %v\n", action, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// discardCheckpoint borra el checkpoint del índice tras crearlo o borrarlo: los custodios que
+// marca como indexados ya no lo están.
+func discardCheckpoint(indexName string, out io.Writer) {
+	removed, err := removeCheckpoint(checkpointFile, indexName)
+	switch {
+	case err != nil:
+		fmt.Fprintf(out, "No se pudo borrar el checkpoint %s: %v\n", checkpointFile, err)
+	case removed:
+		fmt.Fprintf(out, "Checkpoint %s borrado\n", checkpointFile)
+	}
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+func indexCommand(action, indexName, mappingPath string, yes bool, creds zincCredentials, out io.Writer) error {
+	switch action {
+	case "create":
+		mapping, err := loadMapping(mappingPath)
+		if err != nil {
+			return err
+		}
+		index, err := getIndex(indexName, creds)
+		if err != nil {
+			return err
+		}
+		if index != nil {
+			return fmt.Errorf("el índice %q ya existe; usa update-mapping para añadir campos o delete para recrearlo", indexName)
+		}
+		if err := createIndex(indexName, mapping, creds); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Índice %q creado con el mapping v%d (%d campos)\n", indexName, mapping.Version, len(mapping.Mappings.Properties))
+		discardCheckpoint(indexName, out)
+
+	case "delete":
+		if !yes {
+			return fmt.Errorf("delete borra el índice %q y todos sus documentos; repite con -yes para confirmar", indexName)
+		}
+		status, body, err := zincRequest("DELETE", "/api/index/"+indexName, nil, creds)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("ZincSearch no pudo borrar el índice %q (HTTP %d): %s", indexName, status, body)
 		}
-		actionJSON, _ := json.Marshal(action)
-		emailJSON, _ := json.Marshal(email)
+		fmt.Fprintf(out, "Índice %q borrado\n", indexName)
+		discardCheckpoint(indexName, out)
 
-		// Escribir la acción y el documento en el buffer
-		buffer.Write(actionJSON)
-		buffer.WriteByte('\n')
-		buffer.Write(emailJSON)
-		buffer.WriteByte('\n')
+	case "show":
+		index, err := getIndex(indexName, creds)
+		if err != nil {
+			return err
+		}
+		if index == nil {
+			return fmt.Errorf("el índice %q no existe", indexName)
+		}
+		showIndex(out, indexName, index, mappingPath)
+
+	case "update-mapping":
+		mapping, err := loadMapping(mappingPath)
+		if err != nil {
+			return err
+		}
+		index, err := getIndex(indexName, creds)
+		if err != nil {
+			return err
+		}
+		if index == nil {
+			return fmt.Errorf("el índice %q no existe; usa create", indexName)
+		}
+		added, err := updateMapping(indexName, mapping, index, creds)
+		if err != nil {
+			return err
+		}
+		if len(added) == 0 {
+			fmt.Fprintf(out, "El índice %q ya tiene todos los campos del mapping v%d\n", indexName, mapping.Version)
+			return nil
+		}
+		fmt.Fprintf(out, "Campos añadidos al índice %q (mapping v%d): %s\n", indexName, mapping.Version, strings.Join(added, ", "))
+
+	default:
+		return fmt.Errorf("acción desconocida %q (create, delete, show o update-mapping)", action)
+	}
+	return nil
+}
+
+// showIndex escribe los campos del índice y sus diferencias con el archivo de mapping.
+func showIndex(out io.Writer, indexName string, index *zincIndex, mappingPath string) {
+	fmt.Fprintf(out, "Índice %q: %d documentos\n", indexName, index.Stats.DocNum)
+	if len(index.Settings) > 0 && string(index.Settings) != "null" {
+		fmt.Fprintf(out, "Ajustes: %s\n", index.Settings)
+	}
+	fields := make([]string, 0, len(index.Mappings.Properties))
+	for field := range index.Mappings.Properties {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	fmt.Fprintf(out, "%-14s %-8s %-6s %-6s %-10s %s\n", "CAMPO", "TIPO", "INDEX", "STORE", "ANALIZADOR", "FORMATO")
+	for _, field := range fields {
+		p := index.Mappings.Properties[field]
+		line := fmt.Sprintf("%-14s %-8s %-6t %-6t %-10s %s", field, p.Type, p.Index, p.Store, p.Analyzer, p.Format)
+		fmt.Fprintln(out, strings.TrimRight(line, " "))
 	}
 
+	mapping, err := loadMapping(mappingPath)
+	if err != nil {
+		fmt.Fprintf(out, "No se puede comparar con el mapping: %v\n", err)
+		return
+	}
+	diff := diffMapping(mapping, index)
+	if len(diff.Missing)+len(diff.Conflicts)+len(diff.Differences) == 0 {
+		fmt.Fprintf(out, "Coincide con el mapping v%d de %s\n", mapping.Version, mappingPath)
+		return
+	}
+	fmt.Fprintf(out, "Diferencias con el mapping v%d de %s:\n", mapping.Version, mappingPath)
+	for _, field := range diff.Missing {
+		fmt.Fprintf(out, "  falta %s (update-mapping lo añade)\n", field)
+	}
+	for _, conflict := range diff.Conflicts {
+		fmt.Fprintf(out, "  %s (hay que recrear el índice)\n", conflict)
+	}
+	for _, difference := range diff.Differences {
+		fmt.Fprintf(out, "  %s\n", difference)
+	}
+}
+
+// zincRequest hace una solicitud a ZincSearch y devuelve el código y el cuerpo de la respuesta.
+// Con credenciales vacías no se envía autenticación.
+func zincRequest(method, path string, payload []byte, creds zincCredentials) (int, []byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, zincBaseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if creds.User != "" {
+		req.SetBasicAuth(creds.User, creds.Password)
+	}
+
+	resp, err := preflightClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, bytes.TrimSpace(body), err
+}
+
+// sendBulk envía un lote de correos electrónicos a la API de ZincSearch
+// Utiliza la API _bulk para enviar los documentos de forma eficiente. El cuerpo no se construye
+// en memoria: una goroutine lo serializa (y lo comprime con gzip si compress) sobre un io.Pipe
+// mientras el cliente HTTP lo va enviando. Devuelve los bytes que salieron por la conexión.
+// Las credenciales ya se validaron en preflight.
+func sendBulk(bulk bulkConfig, emails []Email, client *http.Client) (sent int64, err error) {
+	url := fmt.Sprintf("%s/api/%s/_bulk", zincBaseURL, bulk.IndexName)
+	compress := bulk.Gzip
+
+	pr, pw := io.Pipe()
+	body := &countingWriter{w: pw}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := bulkEncoders.Get().(*bulkEncoder)
+		err := enc.writeBody(body, emails, compress)
+		bulkEncoders.Put(enc)
+		pw.CloseWithError(err)
+	}()
+	// Si la solicitud termina sin leer todo el cuerpo (error de conexión o respuesta anticipada
+	// de ZincSearch), cerrar el lector desbloquea a la goroutine; se espera a que termine para
+	// no dejarla escribiendo sobre emails, que el worker reutiliza.
+	defer func() {
+		pr.Close()
+		<-done
+		sent = body.n
+	}()
+
 	// Crear la solicitud HTTP POST
-	req, err := http.NewRequest("POST", zincURL, &buffer)
+	req, err := http.NewRequest("POST", url, pr)
 	if err != nil {
-		return fmt.Errorf("error creando solicitud HTTP bulk: %w", err)
+		return 0, fmt.Errorf("error creando solicitud HTTP bulk: %w", err)
 	}
 
 	// Configurar los encabezados para la solicitud
 	req.Header.Set("Content-Type", "application/json")
-
-	// Obtener las credenciales desde las variables de entorno para autenticación básica
-	username := os.Getenv("ZINC_FIRST_ADMIN_USER")
-	password := os.Getenv("ZINC_FIRST_ADMIN_PASSWORD")
-
-	if username == "" || password == "" {
-		log.Fatal("Las credenciales no están configuradas en las variables de entorno.")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
 	}
-	req.SetBasicAuth(username, password) // Autenticación básica
+	req.SetBasicAuth(bulk.Credentials.User, bulk.Credentials.Password) // Autenticación básica
 
 	// Realizar la solicitud HTTP
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error enviando solicitud HTTP bulk: %w", err)
+		return 0, fmt.Errorf("error enviando solicitud HTTP bulk: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Verificar la respuesta HTTP
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("error al indexar lote: %s", body)
+		return 0, fmt.Errorf("error al indexar lote: %s", body)
 	}
+	return 0, nil
+}
 
-	log.Printf("Lote indexado con %d documentos\n", len(emails))
+// bulkEncoder serializa cuerpos _bulk. Se reutiliza entre lotes (bulkEncoders) para no reservar
+// en cada envío el búfer, el compresor gzip y el codificador JSON.
+type bulkEncoder struct {
+	bw  *bufio.Writer
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+var bulkEncoders = sync.Pool{New: func() any {
+	e := &bulkEncoder{bw: bufio.NewWriterSize(io.Discard, 64<<10)}
+	e.enc = json.NewEncoder(e.bw)
+	e.enc.SetEscapeHTML(false)
+	return e
+}}
+
+// writeBody escribe en w una línea de acción y una de documento por correo.
+func (e *bulkEncoder) writeBody(w io.Writer, emails []Email, compress bool) error {
+	dst := w
+	if compress {
+		if e.gz == nil {
+			e.gz, _ = gzip.NewWriterLevel(w, gzip.BestSpeed)
+		} else {
+			e.gz.Reset(w)
+		}
+		dst = e.gz
+	}
+	e.bw.Reset(dst)
+	for i := range emails {
+		if _, err := e.bw.Write(bulkAction); err != nil {
+			return err
+		}
+		// Encode añade el salto de línea que separa los documentos.
+		if err := e.enc.Encode(&emails[i]); err != nil {
+			return err
+		}
+	}
+	if err := e.bw.Flush(); err != nil {
+		return err
+	}
+	if compress {
+		return e.gz.Close()
+	}
 	return nil
 }
 
+// countingWriter cuenta los bytes escritos en w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // parseEmail analiza el contenido del correo electrónico y extrae los campos relevantes
 // como Message-ID, Fecha, De, Para, Asunto y Cuerpo.
 func parseEmail(content string) Email {
@@ -240,8 +1450,347 @@ func parseEmail(content string) Email {
 	return email
 }
 
+// sentAt convierte la cabecera Date ("Mon, 14 May 2001 16:39:00 -0700 (PDT)") a RFC 3339.
+func sentAt(date string) string {
+	t, err := mail.ParseDate(date)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
 // cleanBody limpia el cuerpo del correo, eliminando saltos de línea innecesarios
 // y dejando solo un espacio limpio entre las líneas del cuerpo.
 func cleanBody(body string) string {
 	return strings.TrimSpace(strings.ReplaceAll(body, "\n", " "))
 }
+
+// Categorías de error que se cuentan por separado en el progreso.
+const (
+	errWalk    = "walk"    // no se pudo recorrer una ruta
+	errRead    = "read"    // no se pudo leer un archivo
+	errSkipped = "skipped" // archivo sin Message-ID
+	errBulk    = "bulk"    // ZincSearch rechazó un lote o no respondió
+)
+
+var errorCategories = []string{errWalk, errRead, errSkipped, errBulk}
+
+// maxLatencySamples es el número de lotes recientes sobre los que se calculan los percentiles.
+const maxLatencySamples = 1024
+
+// progress acumula las estadísticas de la ejecución. Los contadores son atómicos porque los
+// actualizan todos los workers; las latencias y el estado de cada worker van protegidos por mu.
+type progress struct {
+	start time.Time
+
+	filesDiscovered atomic.Int64
+	filesProcessed  atomic.Int64
+	docsIndexed     atomic.Int64
+	bytesRead       atomic.Int64
+	bytesSent       atomic.Int64
+	batches         atomic.Int64
+	walkDone        atomic.Bool
+	errors          map[string]*atomic.Int64
+	// ctrl es el controlador de lotes de la ejecución, para mostrar su estado.
+	ctrl *batchController
+
+	mu           sync.Mutex
+	latencies    []time.Duration // ring buffer de las últimas latencias de lote
+	latencyNext  int
+	latencySum   time.Duration
+	workerStates []workerState
+}
+
+// workerState es lo que está haciendo un worker en este momento.
+type workerState struct {
+	State string // "idle", "reading", "waiting" (turno para enviar), "sending" o "done"
+	File  string
+	Docs  int64
+	Since time.Time
+}
+
+// stats es el progreso de la ejecución actual.
+var stats = newProgress(0)
+
+func newProgress(workers int) *progress {
+	p := &progress{
+		start:        time.Now(),
+		errors:       make(map[string]*atomic.Int64, len(errorCategories)),
+		workerStates: make([]workerState, workers),
+	}
+	for _, category := range errorCategories {
+		p.errors[category] = &atomic.Int64{}
+	}
+	for i := range p.workerStates {
+		p.workerStates[i] = workerState{State: "idle", Since: p.start}
+	}
+	return p
+}
+
+func (p *progress) addError(category string) {
+	p.errors[category].Add(1)
+}
+
+func (p *progress) setWorker(id int, state, file string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id < 0 || id >= len(p.workerStates) {
+		return
+	}
+	p.workerStates[id].State = state
+	p.workerStates[id].File = file
+	p.workerStates[id].Since = time.Now()
+}
+
+// observeBatch registra un lote enviado: su latencia, sus bytes y, si tuvo éxito, sus documentos.
+func (p *progress) observeBatch(worker int, docs int, bytes int, latency time.Duration, err error) {
+	p.batches.Add(1)
+	p.bytesSent.Add(int64(bytes))
+	if err != nil {
+		p.addError(errBulk)
+	} else {
+		p.docsIndexed.Add(int64(docs))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.latencies) < maxLatencySamples {
+		p.latencies = append(p.latencies, latency)
+	} else {
+		p.latencies[p.latencyNext] = latency
+		p.latencyNext = (p.latencyNext + 1) % maxLatencySamples
+	}
+	p.latencySum += latency
+	if err == nil && worker >= 0 && worker < len(p.workerStates) {
+		p.workerStates[worker].Docs += int64(docs)
+	}
+}
+
+// progressSnapshot es una foto coherente del progreso para mostrarla o exportarla.
+type progressSnapshot struct {
+	Elapsed         time.Duration
+	FilesDiscovered int64
+	FilesProcessed  int64
+	DocsIndexed     int64
+	BytesRead       int64
+	BytesSent       int64
+	Batches         int64
+	LatencySum      time.Duration
+	WalkDone        bool
+	Errors          map[string]int64
+	DocsPerSec      float64
+	BytesPerSec     float64
+	ETA             time.Duration // -1 si aún no se puede estimar
+	P50, P90, P99   time.Duration
+	Workers         []workerState
+	// Estado del controlador adaptativo: documentos por lote, envíos simultáneos permitidos y
+	// media móvil de lotes fallidos.
+	BatchDocs      int
+	SendLimit      int
+	BatchErrorRate float64
+}
+
+func (p *progress) snapshot() progressSnapshot {
+	s := progressSnapshot{
+		Elapsed:         time.Since(p.start),
+		FilesDiscovered: p.filesDiscovered.Load(),
+		FilesProcessed:  p.filesProcessed.Load(),
+		DocsIndexed:     p.docsIndexed.Load(),
+		BytesRead:       p.bytesRead.Load(),
+		BytesSent:       p.bytesSent.Load(),
+		Batches:         p.batches.Load(),
+		WalkDone:        p.walkDone.Load(),
+		Errors:          make(map[string]int64, len(p.errors)),
+		ETA:             -1,
+	}
+	for category, count := range p.errors {
+		s.Errors[category] = count.Load()
+	}
+	if p.ctrl != nil {
+		s.BatchDocs, s.SendLimit, s.BatchErrorRate = p.ctrl.state()
+	}
+
+	p.mu.Lock()
+	latencies := append([]time.Duration(nil), p.latencies...)
+	s.LatencySum = p.latencySum
+	s.Workers = append([]workerState(nil), p.workerStates...)
+	p.mu.Unlock()
+
+	if seconds := s.Elapsed.Seconds(); seconds > 0 {
+		s.DocsPerSec = float64(s.DocsIndexed) / seconds
+		s.BytesPerSec = float64(s.BytesRead) / seconds
+		// El ETA solo tiene sentido cuando ya se conoce el total de archivos.
+		if filesPerSec := float64(s.FilesProcessed) / seconds; s.WalkDone && filesPerSec > 0 {
+			remaining := float64(s.FilesDiscovered - s.FilesProcessed)
+			s.ETA = time.Duration(remaining / filesPerSec * float64(time.Second))
+		}
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		s.P50 = percentile(latencies, 0.50)
+		s.P90 = percentile(latencies, 0.90)
+		s.P99 = percentile(latencies, 0.99)
+	}
+	return s
+}
+
+// percentile devuelve el percentil q (0-1) de una lista ordenada.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// render escribe el progreso en texto. Con full incluye una línea por worker.
+func (s progressSnapshot) render(w io.Writer, full bool) {
+	total := fmt.Sprintf("%d", s.FilesDiscovered)
+	percent := ""
+	if s.WalkDone && s.FilesDiscovered > 0 {
+		percent = fmt.Sprintf(" (%.1f%%)", 100*float64(s.FilesProcessed)/float64(s.FilesDiscovered))
+	} else {
+		total += "+"
+	}
+	eta := "?"
+	if s.ETA >= 0 {
+		eta = s.ETA.Round(time.Second).String()
+	}
+	fmt.Fprintf(w, "Archivos %d/%s%s  Docs %d  %.0f docs/s  %s/s  Transcurrido %s  ETA %s\n",
+		s.FilesProcessed, total, percent, s.DocsIndexed, s.DocsPerSec, formatBytes(s.BytesPerSec),
+		s.Elapsed.Round(time.Second), eta)
+
+	errs := make([]string, 0, len(errorCategories))
+	for _, category := range errorCategories {
+		errs = append(errs, fmt.Sprintf("%s=%d", category, s.Errors[category]))
+	}
+	fmt.Fprintf(w, "Errores %s  Lotes %d  p50 %s  p90 %s  p99 %s  Lote %d docs  Envíos simultáneos %d\n",
+		strings.Join(errs, " "), s.Batches, s.P50.Round(time.Millisecond), s.P90.Round(time.Millisecond),
+		s.P99.Round(time.Millisecond), s.BatchDocs, s.SendLimit)
+
+	if !full {
+		return
+	}
+	for i, worker := range s.Workers {
+		line := fmt.Sprintf("  worker %2d  %-8s %7d docs  %6s  %s", i, worker.State, worker.Docs,
+			time.Since(worker.Since).Round(100*time.Millisecond), worker.File)
+		if len(line) > 120 {
+			line = line[:117] + "..."
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// runProgressDisplay muestra el progreso en w cada interval hasta que se cierra done. En una
+// terminal redibuja el bloque en su sitio e incluye el estado de cada worker; en otro caso (por
+// ejemplo, con la salida redirigida a un archivo) escribe solo las líneas de resumen.
+// INDEXER_PROGRESS=off lo desactiva.
+func runProgressDisplay(w *os.File, interval time.Duration, done <-chan struct{}) {
+	if strings.ToLower(os.Getenv("INDEXER_PROGRESS")) == "off" {
+		<-done
+		return
+	}
+	info, err := w.Stat()
+	tty := err == nil && info.Mode()&os.ModeCharDevice != 0
+
+	lines := 0
+	draw := func() {
+		var buf bytes.Buffer
+		stats.snapshot().render(&buf, tty)
+		if tty && lines > 0 {
+			// Subir al inicio del bloque anterior y borrarlo.
+			fmt.Fprintf(w, "\033[%dA\033[J", lines)
+		}
+		lines = bytes.Count(buf.Bytes(), []byte("\n"))
+		w.Write(buf.Bytes())
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			draw()
+			return
+		case <-ticker.C:
+			draw()
+		}
+	}
+}
+
+// serveMetrics publica el progreso en formato de exposición de Prometheus en addr/metrics
+// mientras dura la ejecución. Devuelve el servidor para poder cerrarlo al terminar.
+func serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		stats.snapshot().writeMetrics(w)
+	})
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Error sirviendo métricas", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("Métricas disponibles", "addr", addr, "path", "/metrics")
+	return server
+}
+
+func (s progressSnapshot) writeMetrics(w io.Writer) {
+	metric := func(name, kind, help string, samples ...string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, sample := range samples {
+			fmt.Fprintf(w, "%s%s\n", name, sample)
+		}
+	}
+	metric("indexer_files_discovered_total", "counter", "Files found while walking the dataset.", fmt.Sprintf(" %d", s.FilesDiscovered))
+	metric("indexer_files_processed_total", "counter", "Files read and parsed by the workers.", fmt.Sprintf(" %d", s.FilesProcessed))
+	metric("indexer_docs_indexed_total", "counter", "Documents accepted by ZincSearch.", fmt.Sprintf(" %d", s.DocsIndexed))
+	metric("indexer_read_bytes_total", "counter", "Bytes read from email files.", fmt.Sprintf(" %d", s.BytesRead))
+	metric("indexer_sent_bytes_total", "counter", "Bytes sent to ZincSearch in bulk requests.", fmt.Sprintf(" %d", s.BytesSent))
+
+	errs := make([]string, 0, len(errorCategories))
+	for _, category := range errorCategories {
+		errs = append(errs, fmt.Sprintf("{category=%q} %d", category, s.Errors[category]))
+	}
+	metric("indexer_errors_total", "counter", "Errors by category.", errs...)
+
+	quantiles := []string{
+		fmt.Sprintf("{quantile=\"0.5\"} %g", s.P50.Seconds()),
+		fmt.Sprintf("{quantile=\"0.9\"} %g", s.P90.Seconds()),
+		fmt.Sprintf("{quantile=\"0.99\"} %g", s.P99.Seconds()),
+		fmt.Sprintf("_sum %g", s.LatencySum.Seconds()),
+		fmt.Sprintf("_count %d", s.Batches),
+	}
+	metric("indexer_batch_duration_seconds", "summary", "Latency of bulk requests (quantiles over the last batches).", quantiles...)
+
+	metric("indexer_batch_target_docs", "gauge", "Documents per batch chosen by the adaptive controller.", fmt.Sprintf(" %d", s.BatchDocs))
+	metric("indexer_send_concurrency_limit", "gauge", "Concurrent bulk requests allowed by the adaptive controller.", fmt.Sprintf(" %d", s.SendLimit))
+	metric("indexer_batch_error_rate", "gauge", "Moving average of failed bulk requests.", fmt.Sprintf(" %g", s.BatchErrorRate))
+	metric("indexer_docs_per_second", "gauge", "Average indexing rate since start.", fmt.Sprintf(" %g", s.DocsPerSec))
+	metric("indexer_read_bytes_per_second", "gauge", "Average read throughput since start.", fmt.Sprintf(" %g", s.BytesPerSec))
+	eta := -1.0
+	if s.ETA >= 0 {
+		eta = s.ETA.Seconds()
+	}
+	metric("indexer_eta_seconds", "gauge", "Estimated time left (-1 while files are still being discovered).", fmt.Sprintf(" %g", eta))
+
+	docs := make([]string, 0, len(s.Workers))
+	states := make([]string, 0, len(s.Workers))
+	for i, worker := range s.Workers {
+		docs = append(docs, fmt.Sprintf("{worker=\"%d\"} %d", i, worker.Docs))
+		states = append(states, fmt.Sprintf("{worker=\"%d\",state=%q} 1", i, worker.State))
+	}
+	metric("indexer_worker_docs_total", "counter", "Documents indexed by each worker.", docs...)
+	metric("indexer_worker_state", "gauge", "Current state of each worker (idle, reading, waiting, sending or done).", states...)
+}
@@ -0,0 +1,475 @@
+package main
+
+// Pruebas del envío a ZincSearch (cuerpo _bulk y comprobaciones previas) y benchmarks del cuerpo
+// _bulk, que comparan la implementación anterior (un bytes.Buffer con todo el lote y un mapa de
+// acción serializado por documento) con el envío en streaming sobre io.Pipe, con y sin gzip.
+// Como el indexador no tiene go.mod, se ejecutan pasando los archivos:
+//
+//	go test indexer.go indexer_test.go
+//	go test -run xxx -bench . -benchmem -cpuprofile Profiles/cpu_profile_bench.prof indexer.go indexer_test.go
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testMappingFile es el mapping versionado, relativo a este archivo y no a la carpeta desde la
+// que se ejecuta go test.
+var testMappingFile = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), defaultMappingFile)
+}()
+
+// legacyBulkBody reproduce cómo se construía el cuerpo antes del streaming.
+func legacyBulkBody(emails []Email) *bytes.Buffer {
+	var buffer bytes.Buffer
+	for _, email := range emails {
+		action := map[string]interface{}{
+			"index": map[string]string{},
+		}
+		actionJSON, _ := json.Marshal(action)
+		emailJSON, _ := json.Marshal(email)
+
+		buffer.Write(actionJSON)
+		buffer.WriteByte('\n')
+		buffer.Write(emailJSON)
+		buffer.WriteByte('\n')
+	}
+	return &buffer
+}
+
+// legacySendBulk envía el cuerpo anterior, ya construido, como lo hacía sendBulk.
+func legacySendBulk(url string, emails []Email, client *http.Client) error {
+	req, err := http.NewRequest("POST", url, legacyBulkBody(emails))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("admin", "secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// testEmails genera n correos con cuerpos de unos 2 KB, parecidos a los del dataset de Enron.
+func testEmails(n int) []Email {
+	body := strings.Repeat("Please review the attached <draft> & send comments by Friday.\n", 32)
+	emails := make([]Email, n)
+	for i := range emails {
+		emails[i] = Email{
+			MessageID:  fmt.Sprintf("<%d.1075855687451.JavaMail.evans@thyme>", i),
+			Date:       "Mon, 14 May 2001 16:39:00 -0700 (PDT)",
+			From:       "phillip.allen@enron.com",
+			To:         "tim.belden@enron.com",
+			Subject:    fmt.Sprintf("Re: forecast %d", i),
+			Body:       body,
+			Folder:     fmt.Sprintf("enron_mail_20110402/maildir/allen-p/inbox/%d.", i),
+			Custodian:  "allen-p",
+			FolderPath: "allen-p/inbox",
+			FolderLeaf: "inbox",
+			FileName:   fmt.Sprintf("%d.", i),
+		}
+	}
+	return emails
+}
+
+func testBulkConfig(compress bool) bulkConfig {
+	return bulkConfig{
+		IndexName:   "enron_mails",
+		Gzip:        compress,
+		Credentials: zincCredentials{User: "admin", Password: "secret"},
+	}
+}
+
+// decodeBulk lee un cuerpo _bulk y devuelve sus documentos, comprobando las líneas de acción.
+func decodeBulk(t *testing.T, r io.Reader) []Email {
+	t.Helper()
+	var docs []Email
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for line := 0; scanner.Scan(); line++ {
+		if line%2 == 0 {
+			if scanner.Text() != `{"index":{}}` {
+				t.Fatalf("línea de acción inesperada: %q", scanner.Text())
+			}
+			continue
+		}
+		var doc Email
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("documento inválido: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func TestSendBulk_StreamsSameDocuments(t *testing.T) {
+	emails := testEmails(50)
+	want := decodeBulk(t, legacyBulkBody(emails))
+
+	for _, compress := range []bool{false, true} {
+		var got []Email
+		var received int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					t.Errorf("cuerpo gzip inválido: %v", err)
+					return
+				}
+				body = gz
+			} else if compress {
+				t.Error("falta Content-Encoding: gzip")
+			}
+			counted := &countingWriter{w: io.Discard}
+			got = decodeBulk(t, io.TeeReader(body, counted))
+			received = counted.n
+		}))
+		zincBaseURL = server.URL
+
+		sent, err := sendBulk(testBulkConfig(compress), emails, server.Client())
+		server.Close()
+		if err != nil {
+			t.Fatalf("gzip=%v: %v", compress, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("gzip=%v: esperados %d documentos, recibidos %d", compress, len(want), len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("gzip=%v: el documento %d no coincide", compress, i)
+			}
+		}
+		if compress && sent >= received {
+			t.Errorf("gzip: enviados %d bytes comprimidos para %d sin comprimir", sent, received)
+		}
+		if !compress && sent != received {
+			t.Errorf("enviados %d bytes, recibidos %d", sent, received)
+		}
+	}
+}
+
+const benchBatchDocs = 2000
+
+func BenchmarkBulkBody(b *testing.B) {
+	emails := testEmails(benchBatchDocs)
+	size := int64(legacyBulkBody(emails).Len())
+
+	b.Run("buffered", func(b *testing.B) {
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			legacyBulkBody(emails).WriteTo(io.Discard)
+		}
+	})
+	for _, compress := range []bool{false, true} {
+		name := "streamed"
+		if compress {
+			name = "streamed-gzip"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				enc := bulkEncoders.Get().(*bulkEncoder)
+				if err := enc.writeBody(io.Discard, emails, compress); err != nil {
+					b.Fatal(err)
+				}
+				bulkEncoders.Put(enc)
+			}
+		})
+	}
+}
+
+// BenchmarkSendBulk incluye el transporte HTTP contra un servidor que descarta el cuerpo.
+func BenchmarkSendBulk(b *testing.B) {
+	emails := testEmails(benchBatchDocs)
+	size := int64(legacyBulkBody(emails).Len())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+	zincBaseURL = server.URL
+	client := server.Client()
+
+	b.Run("buffered", func(b *testing.B) {
+		b.SetBytes(size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := legacySendBulk(server.URL+"/api/enron_mails/_bulk", emails, client); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, compress := range []bool{false, true} {
+		name := "streamed"
+		if compress {
+			name = "streamed-gzip"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := sendBulk(testBulkConfig(compress), emails, client); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// fakeZinc simula los endpoints de ZincSearch que usa preflight. mapping son los tipos de los
+// campos del índice; nil si el índice no existe.
+func fakeZinc(t *testing.T, mapping map[string]string) (*httptest.Server, *[]string) {
+	var calls []string
+	createAt := "2026-01-01T00:00:00Z"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/healthz" {
+			fmt.Fprint(w, `{"status":"ok"}`)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/index/emails":
+			if mapping == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			properties := map[string]interface{}{}
+			for field, typ := range mapping {
+				properties[field] = map[string]string{"type": typ}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"create_at": createAt, "mappings": map[string]interface{}{"properties": properties}})
+		case r.Method == "POST" && r.URL.Path == "/api/index":
+			// El índice creado queda con los campos enviados y una fecha de creación nueva.
+			var created indexMapping
+			json.NewDecoder(r.Body).Decode(&created)
+			mapping = map[string]string{}
+			for field, property := range created.Mappings.Properties {
+				mapping[field] = property.Type
+			}
+			createAt = "2026-10-19T12:00:00Z"
+			fmt.Fprint(w, `{"message":"ok"}`)
+		case r.Method == "PUT" && r.URL.Path == "/api/emails/_mapping", r.Method == "PUT" && r.URL.Path == "/api/emails/_settings",
+			r.Method == "DELETE" && r.URL.Path == "/api/index/emails":
+			fmt.Fprint(w, `{"message":"ok"}`)
+		default:
+			t.Errorf("solicitud inesperada: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	zincBaseURL = server.URL
+	return server, &calls
+}
+
+func TestPreflight(t *testing.T) {
+	mapping, err := loadMapping(testMappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := map[string]string{}
+	for field, property := range mapping.Mappings.Properties {
+		complete[field] = property.Type
+	}
+	cases := []struct {
+		name     string
+		user     string
+		mapping  map[string]string
+		wantErr  string
+		wantCall string
+	}{
+		{name: "sin credenciales", user: "", wantErr: "ZINC_FIRST_ADMIN_USER"},
+		{name: "credenciales rechazadas", user: "otro", mapping: complete, wantErr: "rechazó las credenciales"},
+		{name: "índice inexistente", user: "admin", wantCall: "POST /api/index"},
+		{name: "faltan campos", user: "admin", mapping: map[string]string{"custodian": "keyword"}, wantCall: "PUT /api/emails/_mapping"},
+		{name: "tipo incorrecto", user: "admin", mapping: map[string]string{"custodian": "text"}, wantErr: `custodian: tipo "text"`},
+		{name: "índice correcto", user: "admin", mapping: complete},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, calls := fakeZinc(t, c.mapping)
+			t.Setenv("ZINC_FIRST_ADMIN_USER", c.user)
+			t.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "secret")
+
+			_, createdAt, err := preflight("emails", testMappingFile)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("esperado un error con %q, obtenido %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			if c.wantCall != "" && !slices.Contains(*calls, c.wantCall) {
+				t.Errorf("esperada la llamada %q, llamadas: %v", c.wantCall, *calls)
+			}
+			if last := (*calls)[len(*calls)-1]; c.wantCall == "" && last != "GET /api/index/emails" {
+				t.Errorf("no se esperaban cambios en el índice, la última llamada fue %q", last)
+			}
+			if createdAt == "" {
+				t.Error("preflight debería devolver la fecha de creación del índice")
+			}
+		})
+	}
+}
+
+func TestPreflight_ZincDown(t *testing.T) {
+	server, _ := fakeZinc(t, nil)
+	server.Close()
+	t.Setenv("ZINC_FIRST_ADMIN_USER", "admin")
+	t.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "secret")
+	if _, _, err := preflight("emails", testMappingFile); err == nil || !strings.Contains(err.Error(), "no responde") {
+		t.Fatalf("esperado un error de conexión, obtenido %v", err)
+	}
+}
+
+func TestIndexCommand(t *testing.T) {
+	t.Setenv("ZINC_FIRST_ADMIN_USER", "admin")
+	t.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "secret")
+	t.Setenv("INDEXER_MAPPING_FILE", "")
+	defer func(path string) { checkpointFile = path }(checkpointFile)
+	checkpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+
+	cases := []struct {
+		name     string
+		args     []string
+		mapping  map[string]string
+		wantCode int
+		wantOut  string
+		wantCall string
+	}{
+		{name: "create", args: []string{"create"}, wantCode: exitOK, wantOut: "creado con el mapping v1", wantCall: "POST /api/index"},
+		{name: "create existente", args: []string{"create"}, mapping: map[string]string{"body": "text"}, wantCode: exitError},
+		{name: "delete sin confirmar", args: []string{"delete"}, mapping: map[string]string{"body": "text"}, wantCode: exitError},
+		{name: "delete", args: []string{"delete", "-yes"}, mapping: map[string]string{"body": "text"}, wantCode: exitOK, wantCall: "DELETE /api/index/emails"},
+		{name: "show", args: []string{"show"}, mapping: map[string]string{"body": "text"}, wantCode: exitOK, wantOut: "falta custodian"},
+		{name: "update-mapping", args: []string{"update-mapping"}, mapping: map[string]string{"body": "text"}, wantCode: exitOK,
+			wantOut: "Campos añadidos", wantCall: "PUT /api/emails/_mapping"},
+		{name: "acción desconocida", args: []string{"drop"}, wantCode: exitError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, calls := fakeZinc(t, c.mapping)
+			var out bytes.Buffer
+			if code := runIndexCommand(c.args, &out); code != c.wantCode {
+				t.Fatalf("código de salida %d, esperado %d (salida: %s)", code, c.wantCode, out.String())
+			}
+			if !strings.Contains(out.String(), c.wantOut) {
+				t.Errorf("la salida no contiene %q: %s", c.wantOut, out.String())
+			}
+			if c.wantCall != "" && (*calls)[len(*calls)-1] != c.wantCall {
+				t.Errorf("esperada la llamada %q, llamadas: %v", c.wantCall, *calls)
+			}
+			if c.wantCode != exitOK {
+				for _, call := range *calls {
+					if !strings.HasPrefix(call, "GET ") {
+						t.Errorf("un comando fallido no debe modificar el índice: %v", *calls)
+					}
+				}
+			}
+		})
+	}
+}
+
+// canonicalMapping decodifica el archivo de mapping tal cual, completando con false las banderas
+// que no declara. Es lo que debe quedar al volver a serializar el mapping cargado; el servidor
+// (Backend/Server/test/mapping_test.go) hace la misma comprobación con su propio cargador, así
+// que ambos leen el archivo igual.
+func canonicalMapping(t *testing.T, data []byte) any {
+	t.Helper()
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	properties := raw["mappings"].(map[string]any)["properties"].(map[string]any)
+	for _, property := range properties {
+		for _, flag := range []string{"index", "store", "sortable", "aggregatable", "highlightable"} {
+			if _, ok := property.(map[string]any)[flag]; !ok {
+				property.(map[string]any)[flag] = false
+			}
+		}
+	}
+	return raw
+}
+
+func TestLoadMapping_SharedFile(t *testing.T) {
+	mapping, err := loadMapping(testMappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(testMappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := json.Marshal(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got any
+	if err := json.Unmarshal(loaded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := canonicalMapping(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("el mapping cargado no coincide con el archivo:\n obtenido %v\n esperado %v", got, want)
+	}
+}
+
+func TestCheckpoint_IgnoredAfterIndexRecreated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp := newCheckpoint(path, "enron", "emails", "2026-01-01T00:00:00Z")
+	cp.dispatch("allen-p")
+	cp.walked("allen-p")
+	cp.finish("allen-p", 1, true)
+	if finished, err := cp.save(); err != nil || finished {
+		t.Fatalf("save: finished=%v, err=%v", finished, err)
+	}
+
+	resumed, err := loadCheckpoint(path, "enron", "emails", "2026-01-01T00:00:00Z")
+	if err != nil || !resumed.isCompleted("allen-p") {
+		t.Fatalf("el mismo índice debería retomar el checkpoint: %+v, %v", resumed, err)
+	}
+	for _, createdAt := range []string{"2026-10-19T12:00:00Z", ""} {
+		recreated, err := loadCheckpoint(path, "enron", "emails", createdAt)
+		if err != nil || recreated.isCompleted("allen-p") {
+			t.Errorf("con el índice creado en %q el checkpoint debería ignorarse: %+v, %v", createdAt, recreated, err)
+		}
+	}
+
+	// index delete borra el checkpoint del índice.
+	fakeZinc(t, map[string]string{"body": "text"})
+	t.Setenv("ZINC_FIRST_ADMIN_USER", "admin")
+	t.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "secret")
+	defer func(path string) { checkpointFile = path }(checkpointFile)
+	checkpointFile = path
+	var out bytes.Buffer
+	if code := runIndexCommand([]string{"delete", "-yes"}, &out); code != exitOK {
+		t.Fatalf("delete: código %d: %s", code, out.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) || !strings.Contains(out.String(), "Checkpoint") {
+		t.Errorf("delete debería borrar el checkpoint (stat: %v, salida: %s)", err, out.String())
+	}
+}
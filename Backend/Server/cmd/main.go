@@ -1,42 +1,258 @@
 package main
 
 import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
     "log"
-    "net/http"
+    "log/slog"
+    "os"
 
     "github.com/go-chi/chi/v5"
     "github.com/go-chi/chi/v5/middleware"
 
     "server/config"
+    "server/internal/acl"
+    "server/internal/audit"
+    "server/internal/auth"
     "server/internal/handlers"
+    "server/internal/logging"
+    "server/internal/mapping"
     "server/internal/services"
+    "server/internal/metrics"
+    "server/internal/ratelimit"
     customMiddleware "server/internal/middleware"
+    "server/internal/tracing"
+    "server/internal/zinc"
+)
+
+// Información de compilación, inyectada con:
+//   go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+    version   string
+    commit    string
+    buildDate string
 )
 
 func main() {
-    config, err := config.LoadConfig()
+    config, err := config.Load(os.Args[1:])
+    if errors.Is(err, flag.ErrHelp) {
+        os.Exit(0)
+    }
+    if config.PrintConfig {
+        config.Print(os.Stdout)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Invalid config:\n"+err.Error())
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
     if err != nil {
-        log.Fatal("Cannot load config:", err)
+        log.Fatal("Cannot load config:\n", err)
     }
 
-    searchService := services.NewSearchService(config)
+    logging.Setup(os.Stdout, config.LogFormat, config.LogLevel, logging.Policy{
+        Mode:    config.LogRedaction,
+        MaxLen:  config.LogRedactMaxLen,
+        HashKey: []byte(config.LogRedactHashKey),
+    })
+
+    shutdownTracing, err := tracing.Setup(context.Background(), config)
+    if err != nil {
+        slog.Error("cannot set up tracing", "error", err)
+        os.Exit(1)
+    }
+
+    zincClient := zinc.NewClient(config, nil)
+    searchService := services.NewSearchService(config, zincClient)
+    metrics.RegisterCache("search", searchService.CacheStats)
     searchHandler := handlers.NewSearchHandler(searchService)
+    emailHandler := handlers.NewEmailHandler(searchService)
+    exportService := services.NewExportService(config, searchService)
+    exportHandler := handlers.NewExportHandler(exportService)
 
     // Inicializa el servicio y handler para folders.
-    folderService := services.NewFolderService()
+    folderService := services.NewFolderService(config, zincClient)
     foldersHandler := handlers.NewFoldersHandler(folderService)
+    // El árbol de carpetas se lee en segundo plano y se mantiene al día hasta el apagado.
+    foldersCtx, stopFolders := context.WithCancel(context.Background())
+    go folderService.Run(foldersCtx)
+
+    healthService := services.NewHealthService(config, zincClient, folderService)
+    if config.IndexMappingFile != "" {
+        indexMapping, err := mapping.Load(config.IndexMappingFile)
+        if err != nil {
+            slog.Error("cannot load index mapping", "error", err)
+            os.Exit(1)
+        }
+        healthService.SetMapping(indexMapping)
+        // Con un circuit breaker propio: si ZincSearch no responde al arrancar, los reintentos de
+        // esta comprobación no abren el del cliente compartido antes de atender tráfico.
+        if err := checkIndexMapping(config, zincClient.WithOwnBreaker(), indexMapping); err != nil {
+            slog.Error("index does not match the mapping", "error", err)
+            os.Exit(1)
+        }
+    }
+    healthHandler := handlers.NewHealthHandler(zincClient, healthService)
+    versionHandler := handlers.NewVersionHandler(handlers.BuildInfo{
+        Version:   version,
+        Commit:    commit,
+        BuildDate: buildDate,
+    })
+    cacheHandler := handlers.NewCacheHandler(searchService)
     
+    authenticator, err := auth.New(config)
+    if err != nil {
+        slog.Error("cannot set up authentication", "error", err)
+        os.Exit(1)
+    }
+    var aclPolicy *acl.Policy
+    if config.ACLFile != "" {
+        if aclPolicy, err = acl.Load(config.ACLFile); err != nil {
+            slog.Error("cannot load access control rules", "error", err)
+            os.Exit(1)
+        }
+    }
+    if authenticator == nil {
+        slog.Warn("authentication is disabled: anyone who can reach the server can read every email, and /api/admin, /api/cache and /api/index are not available (set AUTH_ENABLED=true)")
+    }
+
+    auditLog, err := audit.Setup(config, zincClient)
+    if err != nil {
+        slog.Error("cannot open audit log", "error", err)
+        os.Exit(1)
+    }
+    auditHandler := handlers.NewAuditHandler(auditLog)
+
+    trustedProxies, err := ratelimit.ParseTrustedProxies(config.TrustedProxies)
+    if err != nil {
+        slog.Error("invalid trusted proxies", "error", err)
+        os.Exit(1)
+    }
+    var limiter *ratelimit.Limiter
+    if config.RateLimitEnabled {
+        limiter = ratelimit.New(map[string]ratelimit.Budget{
+            ratelimit.ClassSearch: {Rate: config.RateLimitSearchRate, Burst: config.RateLimitSearchBurst},
+            ratelimit.ClassExport: {Rate: config.RateLimitExportRate, Burst: config.RateLimitExportBurst},
+            ratelimit.ClassAdmin:  {Rate: config.RateLimitAdminRate, Burst: config.RateLimitAdminBurst},
+            ratelimit.ClassAuth:   {Rate: config.RateLimitAuthRate, Burst: config.RateLimitAuthBurst},
+        })
+    }
+    rateLimitHandler := handlers.NewRateLimitHandler(limiter)
+
     r := chi.NewRouter()
-    r.Use(middleware.Logger)
+    r.Use(customMiddleware.RequestID)
+    r.Use(customMiddleware.Tracing)
+    r.Use(customMiddleware.Metrics)
+    r.Use(customMiddleware.RequestLogger)
     r.Use(middleware.Recoverer)
-    r.Use(customMiddleware.EnableCors)
+    r.Use(customMiddleware.CORS(
+        customMiddleware.CORSGroup{Prefix: "/api/", Policy: config.CORSAPI},
+        customMiddleware.CORSGroup{Prefix: "/api/admin/", Policy: config.CORSAdmin},
+        customMiddleware.CORSGroup{Prefix: "/api/cache/", Policy: config.CORSAdmin},
+        customMiddleware.CORSGroup{Prefix: "/api/index/", Policy: config.CORSAdmin},
+    ))
+
+    // Endpoints para el orquestador: liveness, readiness y versión.
+    r.Get("/healthz", healthHandler.HandleLiveness)
+    r.Get("/readyz", healthHandler.HandleReadiness)
+    r.Get("/version", versionHandler.Handle)
+    r.Method("GET", "/metrics", metrics.Handler())
 
     r.Route("/api", func(r chi.Router) {
-        r.Post("/search", searchHandler.Handle)
+        // Los fallos de autenticación se cobran a la IP antes de validar credenciales.
+        r.Use(customMiddleware.LimitFailedAuth(limiter, trustedProxies))
+        r.Use(customMiddleware.Authenticate(authenticator))
+        r.Use(customMiddleware.AccessControl(aclPolicy))
+
+        // Cada grupo tiene su propio presupuesto de solicitudes por cliente.
+        r.Group(func(r chi.Router) {
+            r.Use(customMiddleware.RateLimit(limiter, trustedProxies, ratelimit.ClassSearch))
+            r.Post("/search", searchHandler.Handle)
+            r.Get("/emails/{id}", emailHandler.Handle)
+            r.Get("/health/zinc", healthHandler.HandleZinc)
+            r.Get("/folders", foldersHandler.Handle)
+        })
+
+        r.Group(func(r chi.Router) {
+            r.Use(customMiddleware.RateLimit(limiter, trustedProxies, ratelimit.ClassExport))
+            r.Get("/export", exportHandler.Handle)
+            r.Post("/export", exportHandler.Handle)
+        })
+
+        r.Group(func(r chi.Router) {
+            r.Use(customMiddleware.RateLimit(limiter, trustedProxies, ratelimit.ClassAdmin))
+
+            // Sin autenticación no hay administradores: las rutas de administración no se montan
+            // y la caché solo se renueva al vencer CacheTTL.
+            if authenticator == nil {
+                return
+            }
+            r.Group(func(r chi.Router) {
+                r.Use(customMiddleware.RequireRole(authenticator, config.AuditAdminRole, config.CacheIndexerRole))
+                r.Get("/cache/stats", cacheHandler.HandleStats)
+                r.Post("/index/version", cacheHandler.HandleIndexVersion)
+            })
+            r.Route("/admin", func(r chi.Router) {
+                r.Use(customMiddleware.RequireRole(authenticator, config.AuditAdminRole))
+                r.Get("/audit", auditHandler.Handle)
+                r.Get("/ratelimits", rateLimitHandler.HandleGet)
+                r.Put("/ratelimits", rateLimitHandler.HandleUpdate)
+            })
+        })
     })
 
-    r.Get("/api/folders", foldersHandler.Handle)
+    server, err := newHTTPServer(config, r)
+    if err != nil {
+        slog.Error("cannot create server", "error", err)
+        os.Exit(1)
+    }
 
-    log.Printf("Server listening on port %s", config.ServerPort)
-    log.Fatal(http.ListenAndServe(":"+config.ServerPort, r))
+    err = runServer(config, server, func() {
+        healthService.SetShuttingDown()
+        stopFolders()
+    })
+    if tracingErr := shutdownTracing(context.Background()); tracingErr != nil {
+        slog.Warn("error flushing traces", "error", tracingErr)
+    }
+    if auditErr := auditLog.Close(); auditErr != nil {
+        slog.Warn("error closing audit log", "error", auditErr)
+    }
+    if err != nil {
+        slog.Error("server stopped with error", "error", err)
+        os.Exit(1)
+    }
+}
+
+// checkIndexMapping compara el índice con el mapping versionado al arrancar. Las diferencias se
+// registran como avisos; con IndexMappingStrict, un índice al que le faltan campos o que los
+// tiene con otro tipo impide arrancar. Si ZincSearch no responde solo se avisa: /readyz lo
+// seguirá informando.
+func checkIndexMapping(config *config.Config, client *zinc.Client, m *mapping.Mapping) error {
+    ctx, cancel := context.WithTimeout(context.Background(), client.Timeout(zinc.OpHealth))
+    defer cancel()
+    healthService := services.NewHealthService(config, client, nil)
+    healthService.SetMapping(m)
+    diff, err := healthService.CheckMapping(ctx)
+    if err != nil {
+        slog.Warn("cannot check the index mapping", "index", config.IndexName(), "mapping_version", m.Version, "error", err)
+        return nil
+    }
+    if len(diff.Differences) > 0 {
+        slog.Warn("index fields differ from the mapping", "index", config.IndexName(), "mapping_version", m.Version,
+            "differences", diff.Differences)
+    }
+    if diff.Compatible() {
+        slog.Info("index matches the mapping", "index", config.IndexName(), "mapping_version", m.Version)
+        return nil
+    }
+    err = fmt.Errorf("index %q does not match mapping version %d: missing %v, conflicts %v "+
+        "(the indexer's \"index update-mapping\" command adds missing fields; conflicts need the index recreated)",
+        config.IndexName(), m.Version, diff.Missing, diff.Conflicts)
+    if config.IndexMappingStrict {
+        return err
+    }
+    slog.Warn(err.Error())
+    return nil
 }
\ No newline at end of file
@@ -0,0 +1,138 @@
+package main
+
+//Construye el http.Server de la API con tiempos máximos y límites de cabeceras configurables,
+//TLS opcional (certificado propio o autofirmado para desarrollo) y apagado ordenado: al recibir
+//SIGINT/SIGTERM deja de aceptar conexiones y espera a que terminen las búsquedas y
+//exportaciones en curso, como mucho ShutdownTimeout.
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math/big"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "server/config"
+)
+
+func newHTTPServer(config *config.Config, handler http.Handler) (*http.Server, error) {
+    server := &http.Server{
+        Addr:              ":" + config.ServerPort,
+        Handler:           handler,
+        ReadTimeout:       config.ServerReadTimeout,
+        ReadHeaderTimeout: config.ServerReadHeaderTimeout,
+        WriteTimeout:      config.ServerWriteTimeout,
+        IdleTimeout:       config.ServerIdleTimeout,
+        MaxHeaderBytes:    config.ServerMaxHeaderBytes,
+        ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+    }
+
+    if config.TLSSelfSigned && config.TLSCertFile == "" {
+        cert, err := selfSignedCertificate()
+        if err != nil {
+            return nil, fmt.Errorf("error generating self-signed certificate: %w", err)
+        }
+        server.TLSConfig = &tls.Config{
+            MinVersion:   tls.VersionTLS12,
+            Certificates: []tls.Certificate{cert},
+        }
+    } else if config.TLSCertFile != "" {
+        server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+    }
+    return server, nil
+}
+
+// runServer atiende solicitudes hasta recibir SIGINT o SIGTERM y entonces apaga el servidor de
+// forma ordenada. beforeShutdown se ejecuta justo al recibir la señal (por ejemplo, para que
+// /readyz empiece a fallar mientras se drenan las conexiones).
+func runServer(config *config.Config, server *http.Server, beforeShutdown func()) error {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    serveErr := make(chan error, 1)
+    go func() {
+        var err error
+        if server.TLSConfig != nil {
+            // Con certificado autofirmado ya está en TLSConfig y los archivos van vacíos.
+            err = server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+        } else {
+            err = server.ListenAndServe()
+        }
+        if !errors.Is(err, http.ErrServerClosed) {
+            serveErr <- err
+        }
+        close(serveErr)
+    }()
+    slog.Info("server listening", "addr", server.Addr, "scheme", scheme(server))
+
+    select {
+    case err := <-serveErr:
+        return err
+    case <-ctx.Done():
+    }
+    stop()
+
+    slog.Info("shutdown signal received, draining connections", "timeout", config.ShutdownTimeout.String())
+    if beforeShutdown != nil {
+        beforeShutdown()
+    }
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        // Se agotó el plazo: se cortan las conexiones que sigan abiertas.
+        slog.Warn("graceful shutdown timed out, closing remaining connections", "error", err)
+        server.Close()
+        return err
+    }
+    slog.Info("server stopped")
+    return <-serveErr
+}
+
+func scheme(server *http.Server) string {
+    if server.TLSConfig != nil {
+        return "https"
+    }
+    return "http"
+}
+
+// selfSignedCertificate genera en memoria un certificado para localhost válido un año. Solo
+// para desarrollo: los navegadores mostrarán una advertencia.
+func selfSignedCertificate() (tls.Certificate, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return tls.Certificate{}, err
+    }
+    serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+    if err != nil {
+        return tls.Certificate{}, err
+    }
+
+    template := &x509.Certificate{
+        SerialNumber:          serial,
+        Subject:               pkix.Name{CommonName: "localhost", Organization: []string{"email-search dev"}},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().AddDate(1, 0, 0),
+        KeyUsage:              x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        BasicConstraintsValid: true,
+        DNSNames:              []string{"localhost"},
+        IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        return tls.Certificate{}, err
+    }
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: template}, nil
+}
@@ -1,11 +1,21 @@
 package config
 
 
-//Contiene la definición de la estructura de configuración y la función de carga que obtiene 
-//parámetros desde variables de entorno o valores por defecto. Esto incluye la URL de ZincSearch, 
-//credenciales de autenticación y el puerto del servidor.
+//Contiene la definición de la estructura de configuración y su carga. Los valores se toman,
+//de menor a mayor prioridad, de los valores por defecto, de un archivo YAML o TOML opcional
+//(--config o CONFIG_FILE), de variables de entorno y de flags de línea de comandos. Los
+//secretos pueden leerse desde archivos (por ejemplo, ZINC_PASSWORD_FILE). Al final se valida
+//todo y se devuelven juntos todos los errores encontrados.
 
-import "os"
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
 
 type Config struct {
     ZincSearchURL      string
@@ -13,21 +23,275 @@ type Config struct {
     ZincSearchPassword string
     ServerPort         string
     EndpointIndex      string
+    ExportPageSize     int
+
+    // Ajustes del http.Server de la API.
+    ServerReadTimeout       time.Duration
+    ServerReadHeaderTimeout time.Duration
+    ServerWriteTimeout      time.Duration
+    ServerIdleTimeout       time.Duration
+    ServerMaxHeaderBytes    int
+    ShutdownTimeout         time.Duration
+
+    // TLS opcional: certificado y clave en archivos, o un certificado autofirmado para desarrollo.
+    TLSCertFile   string
+    TLSKeyFile    string
+    TLSSelfSigned bool
+
+    // Tiempos máximos por tipo de operación contra ZincSearch.
+    ZincTimeoutSearch  time.Duration
+    ZincTimeoutExport  time.Duration
+    ZincTimeoutHealth  time.Duration
+    ZincTimeoutFolders time.Duration
+
+    // Ajustes del transporte HTTP hacia ZincSearch.
+    ZincDialTimeout         time.Duration
+    ZincKeepAlive           time.Duration
+    ZincIdleConnTimeout     time.Duration
+    ZincMaxIdleConns        int
+    ZincMaxIdleConnsPerHost int
+
+    // Reintentos de lecturas y circuit breaker hacia ZincSearch.
+    ZincRetryMax         int
+    ZincRetryBackoff     time.Duration
+    ZincRetryMaxBackoff  time.Duration
+    ZincBreakerThreshold int
+    ZincBreakerCooldown  time.Duration
+
+    // Caché de resultados de búsqueda. CacheIndexerRole es el rol (además de AuditAdminRole)
+    // que puede consultar /api/cache/stats e informar la versión del índice, lo que vacía la caché.
+    CacheEnabled     bool
+    CacheMaxBytes    int64
+    CacheTTL         time.Duration
+    CacheIndexerRole string
+
+    // Origen del listado de carpetas: "index" (agregación sobre folder_path) o "filesystem"
+    // (recorrido de FoldersRoot). FoldersMaxBuckets limita las rutas distintas agregadas.
+    FoldersSource     string
+    FoldersRoot       string
+    FoldersMaxBuckets int
+    // El árbol de carpetas se guarda en memoria y se vuelve a leer cada FoldersRefreshInterval
+    // (0 lo lee en cada solicitud); cada FoldersPollInterval se comprueba si el origen ha
+    // cambiado para renovarlo antes (0 desactiva la comprobación).
+    FoldersRefreshInterval time.Duration
+    FoldersPollInterval    time.Duration
+
+    // Número mínimo de documentos en el índice para considerar el servidor listo.
+    ReadyMinDocs int
+
+    // IndexMappingFile es el mapping versionado del índice (Backend/Mapping/emails.json) con el
+    // que se compara el índice al arrancar; vacío desactiva la comprobación. Con
+    // IndexMappingStrict el servidor no arranca si al índice le faltan campos o tienen otro tipo.
+    IndexMappingFile   string
+    IndexMappingStrict bool
+
+    // Trazas OpenTelemetry: exportador ("none", "stdout", "file" u "otlp"), archivo de salida
+    // para "file", nombre del servicio y fracción de trazas muestreadas.
+    TracingExporter    string
+    TracingFile        string
+    TracingServiceName string
+    TracingSampleRatio float64
+
+    // Logs: formato ("json" o "text"), nivel y política de redacción de términos y cuerpos
+    // ("none", "truncate", "hash" o "redact"). LogRedactHashKey es la clave del HMAC del modo
+    // "hash"; si está vacía se genera una aleatoria en cada arranque.
+    LogFormat        string
+    LogLevel         string
+    LogRedaction     string
+    LogRedactMaxLen  int
+    LogRedactHashKey string
+
+    // Políticas CORS por grupo de rutas: la API pública (búsqueda, exportación, carpetas) y
+    // los endpoints de administración (caché, versión del índice, /api/admin).
+    CORSAPI   CORSPolicy
+    CORSAdmin CORSPolicy
+
+    // Autenticación de /api: API keys (solo su SHA-256, "nombre:hash[:rol1|rol2]") y tokens JWT
+    // HS256 (secreto compartido) o RS256 (claves de un archivo JWKS local).
+    AuthEnabled       bool
+    AuthAPIKeys       []string
+    AuthJWTHMACSecret string
+    AuthJWTJWKSFile   string
+    AuthJWTIssuer     string
+    AuthJWTAudience   string
+    AuthJWTRolesClaim string
+    AuthJWTLeeway     time.Duration
+
+    // ACLFile es el archivo de reglas que asigna custodios y carpetas a usuarios y roles.
+    // Vacío desactiva el control de acceso (todos ven todos los buzones).
+    ACLFile string
+
+    // Límites de solicitudes por cliente (API key, usuario o IP): tasa sostenida por segundo
+    // y ráfaga de cada clase de rutas. Una tasa 0 desactiva el límite de esa clase. La clase
+    // auth cuenta las autenticaciones fallidas por IP.
+    // TrustedProxies son las IPs o rangos CIDR cuyo X-Forwarded-For se acepta.
+    RateLimitEnabled     bool
+    RateLimitSearchRate  float64
+    RateLimitSearchBurst int
+    RateLimitExportRate  float64
+    RateLimitExportBurst int
+    RateLimitAdminRate   float64
+    RateLimitAdminBurst  int
+    RateLimitAuthRate    float64
+    RateLimitAuthBurst   int
+    TrustedProxies       []string
+
+    // Registro de auditoría: archivo JSON-lines con rotación por tamaño y, opcionalmente, un
+    // índice de ZincSearch. AuditAdminRole es el rol necesario para consultar /api/admin.
+    AuditFile       string
+    AuditMaxSizeMB  int64
+    AuditMaxBackups int
+    AuditZincIndex  string
+    AuditAdminRole  string
+
+    // ConfigFile es el archivo YAML o TOML del que se leyó la configuración, si hubo alguno.
+    ConfigFile string
+    // PrintConfig indica que se pidió --print-config: mostrar la configuración y salir.
+    PrintConfig bool
+}
+
+// CORSPolicy describe qué orígenes pueden llamar a un grupo de rutas desde el navegador.
+// AllowedOrigins acepta orígenes exactos ("https://app.example.com"), subdominios con comodín
+// ("https://*.example.com") o "*" para cualquiera. Sin orígenes no se envían encabezados CORS.
+type CORSPolicy struct {
+    AllowedOrigins   []string
+    AllowedMethods   []string
+    AllowedHeaders   []string
+    ExposedHeaders   []string
+    AllowCredentials bool
+    MaxAge           time.Duration
 }
 
+// LoadConfig carga la configuración sin flags de línea de comandos (archivo de CONFIG_FILE,
+// si está definido, y variables de entorno).
 func LoadConfig() (*Config, error) {
-    return &Config{
-        ZincSearchURL:      getEnvOrDefault("ZINC_SEARCH_URL", "http://localhost:4080"),
-        ZincSearchUser:     os.Getenv("ZINC_FIRST_ADMIN_USER"),
-        ZincSearchPassword: os.Getenv("ZINC_FIRST_ADMIN_PASSWORD"),
-        ServerPort:         getEnvOrDefault("SERVER_PORT", "8080"),
-        EndpointIndex:      getEnvOrDefault("ENDPOINT_INDEX", "/api/emails"),
-    }, nil
+    return Load(nil)
+}
+
+// Load carga la configuración combinando valores por defecto, archivo, entorno y los flags de
+// args. Si hay errores de formato o de validación los devuelve todos juntos; el *Config
+// devuelto contiene igualmente lo que se pudo cargar (útil para --print-config).
+func Load(args []string) (*Config, error) {
+    c := &Config{}
+    settings := c.settings()
+    for _, s := range settings {
+        if err := s.value.Set(s.def); err != nil {
+            panic(fmt.Sprintf("config: invalid default for %s: %v", s.key, err))
+        }
+    }
+
+    // Los flags se leen primero (hace falta saber si hay --config), pero se aplican al final
+    // porque son los de mayor prioridad.
+    flagValues, err := c.parseFlags(settings, args)
+    if err != nil {
+        return c, err
+    }
+
+    var errs []error
+    if c.ConfigFile == "" {
+        c.ConfigFile = os.Getenv("CONFIG_FILE")
+    }
+    if c.ConfigFile != "" {
+        errs = append(errs, c.loadFile(settings, c.ConfigFile)...)
+    }
+    errs = append(errs, applyEnv(settings)...)
+    errs = append(errs, applyValues(settings, flagValues, "flag --")...)
+
+    if err := c.Validate(); err != nil {
+        errs = append(errs, err)
+    }
+    return c, errors.Join(errs...)
+}
+
+// parseFlags define un flag por cada opción (zinc.url -> --zinc-url), más --<secreto>-file para
+// los secretos, y devuelve los valores que se indicaron, sin aplicarlos todavía.
+func (c *Config) parseFlags(settings []*setting, args []string) (map[string]string, error) {
+    fs := flag.NewFlagSet("server", flag.ContinueOnError)
+    fs.StringVar(&c.ConfigFile, "config", "", "YAML or TOML configuration file (also CONFIG_FILE)")
+    fs.BoolVar(&c.PrintConfig, "print-config", false, "print the effective configuration with secrets masked and exit")
+
+    values := make(map[string]string)
+    for _, s := range settings {
+        fs.Var(&flagRecorder{key: s.key, values: values, isBool: s.isBool()}, s.flagName(), s.usage+" ("+s.env+")")
+        if s.secret {
+            fs.Var(&flagRecorder{key: s.key + "_file", values: values}, flagName(s.key+"_file"), "file to read the "+s.key+" secret from ("+s.env+"_FILE)")
+        }
+    }
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+    return values, nil
+}
+
+func applyEnv(settings []*setting) []error {
+    var errs []error
+    for _, s := range settings {
+        // Una lista vacía en el entorno es un valor válido (por ejemplo, desactivar CORS).
+        if value, ok := os.LookupEnv(s.env); value != "" || (ok && s.isList()) {
+            if err := s.value.Set(value); err != nil {
+                errs = append(errs, fmt.Errorf("env %s: %w", s.env, err))
+            }
+        }
+        if !s.secret {
+            continue
+        }
+        for _, fileEnv := range s.fileEnvs() {
+            if file := os.Getenv(fileEnv); file != "" {
+                if err := setFromSecretFile(s, file); err != nil {
+                    errs = append(errs, fmt.Errorf("env %s: %w", fileEnv, err))
+                }
+            }
+        }
+    }
+    return errs
+}
+
+// applyValues aplica valores indexados por clave (los del archivo o los de los flags). Las
+// claves "<secreto>_file" leen el valor del secreto desde ese archivo.
+func applyValues(settings []*setting, values map[string]string, source string) []error {
+    byKey := make(map[string]*setting, len(settings))
+    for _, s := range settings {
+        byKey[s.key] = s
+    }
+
+    var errs []error
+    for key, value := range values {
+        if s, ok := byKey[key]; ok {
+            if err := s.value.Set(value); err != nil {
+                errs = append(errs, fmt.Errorf("%s%s: %w", source, displayKey(source, key), err))
+            }
+            continue
+        }
+        if s, ok := byKey[strings.TrimSuffix(key, "_file")]; ok && s.secret && strings.HasSuffix(key, "_file") {
+            if err := setFromSecretFile(s, value); err != nil {
+                errs = append(errs, fmt.Errorf("%s%s: %w", source, displayKey(source, key), err))
+            }
+            continue
+        }
+        errs = append(errs, fmt.Errorf("%s%s: unknown option", source, displayKey(source, key)))
+    }
+    return errs
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-    if value := os.Getenv(key); value != "" {
-        return value
+func displayKey(source, key string) string {
+    if strings.HasPrefix(source, "flag") {
+        return flagName(key)
     }
-    return defaultValue
-}
\ No newline at end of file
+    return key
+}
+
+// setFromSecretFile lee un secreto desde un archivo (por ejemplo, un secret de Docker o
+// Kubernetes), quitando el salto de línea final.
+func setFromSecretFile(s *setting, file string) error {
+    content, err := os.ReadFile(file)
+    if err != nil {
+        return fmt.Errorf("cannot read secret file: %w", err)
+    }
+    return s.value.Set(strings.TrimRight(string(content), "\r\n"))
+}
+
+// IndexName devuelve el nombre del índice de ZincSearch a partir de EndpointIndex
+// (por ejemplo, "emails" para "/api/emails").
+func (c *Config) IndexName() string {
+    return path.Base(c.EndpointIndex)
+}
@@ -0,0 +1,59 @@
+package config
+
+//Muestra la configuración efectiva (--print-config) en el mismo formato YAML que acepta
+//--config, con los secretos enmascarados.
+import (
+    "fmt"
+    "io"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+const maskedSecret = "********"
+
+// Print escribe la configuración efectiva en YAML. Los secretos con valor se muestran como
+// "********" para poder compartir la salida sin exponerlos.
+func (c *Config) Print(w io.Writer) error {
+    root := make(map[string]interface{})
+    for _, s := range c.settings() {
+        var value interface{} = s.value.String()
+        switch v := s.value.(type) {
+        case *intValue:
+            value = int(*v)
+        case *int64Value:
+            value = int64(*v)
+        case *floatValue:
+            value = float64(*v)
+        case *boolValue:
+            value = bool(*v)
+        case *listValue:
+            value = append([]string{}, *v...)
+        }
+        if s.secret && s.value.String() != "" {
+            value = maskedSecret
+        }
+
+        parts := strings.Split(s.key, ".")
+        node := root
+        for _, part := range parts[:len(parts)-1] {
+            child, ok := node[part].(map[string]interface{})
+            if !ok {
+                child = make(map[string]interface{})
+                node[part] = child
+            }
+            node = child
+        }
+        node[parts[len(parts)-1]] = value
+    }
+
+    if c.ConfigFile != "" {
+        fmt.Fprintf(w, "# loaded from %s\n", c.ConfigFile)
+    }
+    out, err := yaml.Marshal(root)
+    if err != nil {
+        return err
+    }
+    _, err = w.Write(out)
+    return err
+}
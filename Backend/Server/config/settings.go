@@ -0,0 +1,319 @@
+package config
+
+//Tabla de opciones de configuración. Cada opción tiene una clave en el archivo YAML o TOML
+//("zinc.url"), una variable de entorno (ZINC_SEARCH_URL), un flag derivado de la clave
+//(--zinc-url) y un valor por defecto. Añadir una opción nueva es añadir una línea aquí.
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v3"
+)
+
+type setting struct {
+    key    string
+    env    string
+    def    string
+    usage  string
+    secret bool
+    value  value
+}
+
+// value es un flag.Value que además sabe mostrarse en --print-config.
+type value interface {
+    Set(string) error
+    String() string
+}
+
+func (c *Config) settings() []*setting {
+    return []*setting{
+        {key: "server.port", env: "SERVER_PORT", def: "8080", usage: "port the API listens on", value: (*stringValue)(&c.ServerPort)},
+        {key: "server.read_timeout", env: "SERVER_READ_TIMEOUT", def: "15s", usage: "maximum time to read a request", value: (*durationValue)(&c.ServerReadTimeout)},
+        {key: "server.read_header_timeout", env: "SERVER_READ_HEADER_TIMEOUT", def: "5s", usage: "maximum time to read request headers", value: (*durationValue)(&c.ServerReadHeaderTimeout)},
+        {key: "server.write_timeout", env: "SERVER_WRITE_TIMEOUT", def: "60s", usage: "maximum time to write a response", value: (*durationValue)(&c.ServerWriteTimeout)},
+        {key: "server.idle_timeout", env: "SERVER_IDLE_TIMEOUT", def: "120s", usage: "keep-alive idle timeout", value: (*durationValue)(&c.ServerIdleTimeout)},
+        {key: "server.max_header_bytes", env: "SERVER_MAX_HEADER_BYTES", def: "65536", usage: "maximum size of request headers", value: (*intValue)(&c.ServerMaxHeaderBytes)},
+        {key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", def: "30s", usage: "time allowed to drain connections on shutdown", value: (*durationValue)(&c.ShutdownTimeout)},
+
+        {key: "tls.cert_file", env: "TLS_CERT_FILE", usage: "TLS certificate file", value: (*stringValue)(&c.TLSCertFile)},
+        {key: "tls.key_file", env: "TLS_KEY_FILE", usage: "TLS private key file", value: (*stringValue)(&c.TLSKeyFile)},
+        {key: "tls.self_signed", env: "TLS_SELF_SIGNED", def: "false", usage: "serve HTTPS with a self-signed certificate (development)", value: (*boolValue)(&c.TLSSelfSigned)},
+
+        {key: "zinc.url", env: "ZINC_SEARCH_URL", def: "http://localhost:4080", usage: "ZincSearch base URL", value: (*stringValue)(&c.ZincSearchURL)},
+        {key: "zinc.user", env: "ZINC_FIRST_ADMIN_USER", usage: "ZincSearch user", value: (*stringValue)(&c.ZincSearchUser)},
+        {key: "zinc.password", env: "ZINC_FIRST_ADMIN_PASSWORD", usage: "ZincSearch password", secret: true, value: (*stringValue)(&c.ZincSearchPassword)},
+        {key: "zinc.index_endpoint", env: "ENDPOINT_INDEX", def: "/api/emails", usage: "ZincSearch index path", value: (*stringValue)(&c.EndpointIndex)},
+
+        {key: "zinc.timeouts.search", env: "ZINC_TIMEOUT_SEARCH", def: "10s", usage: "timeout for a search call", value: (*durationValue)(&c.ZincTimeoutSearch)},
+        {key: "zinc.timeouts.export", env: "ZINC_TIMEOUT_EXPORT", def: "30s", usage: "timeout for each export page", value: (*durationValue)(&c.ZincTimeoutExport)},
+        {key: "zinc.timeouts.health", env: "ZINC_TIMEOUT_HEALTH", def: "2s", usage: "timeout for health checks", value: (*durationValue)(&c.ZincTimeoutHealth)},
+        {key: "zinc.timeouts.folders", env: "ZINC_TIMEOUT_FOLDERS", def: "10s", usage: "timeout for folder queries", value: (*durationValue)(&c.ZincTimeoutFolders)},
+
+        {key: "zinc.transport.dial_timeout", env: "ZINC_DIAL_TIMEOUT", def: "5s", usage: "TCP/TLS connect timeout", value: (*durationValue)(&c.ZincDialTimeout)},
+        {key: "zinc.transport.keep_alive", env: "ZINC_KEEP_ALIVE", def: "30s", usage: "TCP keep-alive period", value: (*durationValue)(&c.ZincKeepAlive)},
+        {key: "zinc.transport.idle_conn_timeout", env: "ZINC_IDLE_CONN_TIMEOUT", def: "90s", usage: "idle pooled connection lifetime", value: (*durationValue)(&c.ZincIdleConnTimeout)},
+        {key: "zinc.transport.max_idle_conns", env: "ZINC_MAX_IDLE_CONNS", def: "100", usage: "connection pool size", value: (*intValue)(&c.ZincMaxIdleConns)},
+        {key: "zinc.transport.max_idle_conns_per_host", env: "ZINC_MAX_IDLE_CONNS_PER_HOST", def: "32", usage: "connection pool size per host", value: (*intValue)(&c.ZincMaxIdleConnsPerHost)},
+
+        {key: "zinc.retry.max", env: "ZINC_RETRY_MAX", def: "2", usage: "extra attempts for read calls", value: (*intValue)(&c.ZincRetryMax)},
+        {key: "zinc.retry.backoff", env: "ZINC_RETRY_BACKOFF", def: "100ms", usage: "initial retry backoff", value: (*durationValue)(&c.ZincRetryBackoff)},
+        {key: "zinc.retry.max_backoff", env: "ZINC_RETRY_MAX_BACKOFF", def: "2s", usage: "maximum retry backoff", value: (*durationValue)(&c.ZincRetryMaxBackoff)},
+        {key: "zinc.breaker.threshold", env: "ZINC_BREAKER_THRESHOLD", def: "5", usage: "consecutive failures that open the circuit breaker", value: (*intValue)(&c.ZincBreakerThreshold)},
+        {key: "zinc.breaker.cooldown", env: "ZINC_BREAKER_COOLDOWN", def: "15s", usage: "time the circuit breaker stays open", value: (*durationValue)(&c.ZincBreakerCooldown)},
+
+        {key: "export.page_size", env: "EXPORT_PAGE_SIZE", def: "500", usage: "page size used by exports", value: (*intValue)(&c.ExportPageSize)},
+
+        {key: "cache.enabled", env: "CACHE_ENABLED", def: "true", usage: "cache search responses", value: (*boolValue)(&c.CacheEnabled)},
+        {key: "cache.max_bytes", env: "CACHE_MAX_BYTES", def: "67108864", usage: "maximum cache size in bytes", value: (*int64Value)(&c.CacheMaxBytes)},
+        {key: "cache.ttl", env: "CACHE_TTL", def: "5m", usage: "cached response lifetime", value: (*durationValue)(&c.CacheTTL)},
+        {key: "cache.indexer_role", env: "CACHE_INDEXER_ROLE", def: "indexer", usage: "role allowed, besides audit.admin_role, to read cache stats and post the index version", value: (*stringValue)(&c.CacheIndexerRole)},
+
+        {key: "folders.source", env: "FOLDERS_SOURCE", def: "index", usage: "index or filesystem", value: (*stringValue)(&c.FoldersSource)},
+        {key: "folders.root", env: "FOLDERS_ROOT", usage: "maildir root for the filesystem source", value: (*stringValue)(&c.FoldersRoot)},
+        {key: "folders.refresh_interval", env: "FOLDERS_REFRESH_INTERVAL", def: "10m", usage: "how often the cached folder tree is rebuilt (0 = on every request)", value: (*durationValue)(&c.FoldersRefreshInterval)},
+        {key: "folders.poll_interval", env: "FOLDERS_POLL_INTERVAL", def: "30s", usage: "how often the folder source is checked for changes (0 = never)", value: (*durationValue)(&c.FoldersPollInterval)},
+        {key: "folders.max_buckets", env: "FOLDERS_MAX_BUCKETS", def: "20000", usage: "maximum distinct folder paths aggregated from the index", value: (*intValue)(&c.FoldersMaxBuckets)},
+
+        {key: "ready.min_docs", env: "READY_MIN_DOCS", def: "1", usage: "minimum documents in the index for readiness", value: (*intValue)(&c.ReadyMinDocs)},
+
+        {key: "index.mapping_file", env: "INDEX_MAPPING_FILE", usage: "versioned index mapping checked against the index at startup (e.g. Backend/Mapping/emails.json; empty skips the check)", value: (*stringValue)(&c.IndexMappingFile)},
+        {key: "index.mapping_strict", env: "INDEX_MAPPING_STRICT", def: "false", usage: "refuse to start if the index lacks mapping fields or has other types", value: (*boolValue)(&c.IndexMappingStrict)},
+
+        {key: "tracing.exporter", env: "TRACING_EXPORTER", def: "none", usage: "none, stdout, file or otlp", value: (*stringValue)(&c.TracingExporter)},
+        {key: "tracing.file", env: "TRACING_FILE", def: "traces.jsonl", usage: "output file for the file exporter", value: (*stringValue)(&c.TracingFile)},
+        {key: "tracing.service_name", env: "TRACING_SERVICE_NAME", def: "email-search-server", usage: "service.name reported in traces", value: (*stringValue)(&c.TracingServiceName)},
+        {key: "tracing.sample_ratio", env: "TRACING_SAMPLE_RATIO", def: "1", usage: "fraction of traces sampled", value: (*floatValue)(&c.TracingSampleRatio)},
+
+        {key: "cors.api.allowed_origins", env: "CORS_API_ALLOWED_ORIGINS", def: "*", usage: "origins allowed to call the public API", value: (*listValue)(&c.CORSAPI.AllowedOrigins)},
+        {key: "cors.api.allowed_methods", env: "CORS_API_ALLOWED_METHODS", def: "GET,POST", usage: "methods allowed on the public API", value: (*listValue)(&c.CORSAPI.AllowedMethods)},
+        {key: "cors.api.allowed_headers", env: "CORS_API_ALLOWED_HEADERS", def: "Content-Type,Authorization,X-API-Key,X-Request-ID", usage: "request headers allowed on the public API", value: (*listValue)(&c.CORSAPI.AllowedHeaders)},
+        {key: "cors.api.exposed_headers", env: "CORS_API_EXPOSED_HEADERS", def: "X-Request-ID,Retry-After,Content-Disposition,X-RateLimit-Limit,X-RateLimit-Remaining", usage: "response headers readable by the browser", value: (*listValue)(&c.CORSAPI.ExposedHeaders)},
+        {key: "cors.api.allow_credentials", env: "CORS_API_ALLOW_CREDENTIALS", def: "false", usage: "allow cookies and credentials on the public API", value: (*boolValue)(&c.CORSAPI.AllowCredentials)},
+        {key: "cors.api.max_age", env: "CORS_API_MAX_AGE", def: "10m", usage: "how long browsers may cache a preflight", value: (*durationValue)(&c.CORSAPI.MaxAge)},
+        {key: "cors.admin.allowed_origins", env: "CORS_ADMIN_ALLOWED_ORIGINS", usage: "origins allowed to call admin endpoints (none by default)", value: (*listValue)(&c.CORSAdmin.AllowedOrigins)},
+        {key: "cors.admin.allowed_methods", env: "CORS_ADMIN_ALLOWED_METHODS", def: "GET,POST,PUT,DELETE", usage: "methods allowed on admin endpoints", value: (*listValue)(&c.CORSAdmin.AllowedMethods)},
+        {key: "cors.admin.allowed_headers", env: "CORS_ADMIN_ALLOWED_HEADERS", def: "Content-Type,Authorization,X-API-Key,X-Request-ID", usage: "request headers allowed on admin endpoints", value: (*listValue)(&c.CORSAdmin.AllowedHeaders)},
+        {key: "cors.admin.exposed_headers", env: "CORS_ADMIN_EXPOSED_HEADERS", def: "X-Request-ID,Retry-After", usage: "response headers readable by the browser", value: (*listValue)(&c.CORSAdmin.ExposedHeaders)},
+        {key: "cors.admin.allow_credentials", env: "CORS_ADMIN_ALLOW_CREDENTIALS", def: "false", usage: "allow cookies and credentials on admin endpoints", value: (*boolValue)(&c.CORSAdmin.AllowCredentials)},
+        {key: "cors.admin.max_age", env: "CORS_ADMIN_MAX_AGE", def: "10m", usage: "how long browsers may cache a preflight", value: (*durationValue)(&c.CORSAdmin.MaxAge)},
+
+        {key: "auth.enabled", env: "AUTH_ENABLED", def: "false", usage: "require credentials on /api", value: (*boolValue)(&c.AuthEnabled)},
+        {key: "auth.api_keys", env: "AUTH_API_KEYS", usage: "API keys as name:sha256hex[:role1|role2]", value: (*listValue)(&c.AuthAPIKeys)},
+        {key: "auth.jwt.hmac_secret", env: "AUTH_JWT_HMAC_SECRET", usage: "shared secret for HS256 tokens", secret: true, value: (*stringValue)(&c.AuthJWTHMACSecret)},
+        {key: "auth.jwt.jwks_file", env: "AUTH_JWT_JWKS_FILE", usage: "local JWKS file with RS256 (and oct) keys", value: (*stringValue)(&c.AuthJWTJWKSFile)},
+        {key: "auth.jwt.issuer", env: "AUTH_JWT_ISSUER", usage: "required iss claim", value: (*stringValue)(&c.AuthJWTIssuer)},
+        {key: "auth.jwt.audience", env: "AUTH_JWT_AUDIENCE", usage: "required aud claim", value: (*stringValue)(&c.AuthJWTAudience)},
+        {key: "auth.jwt.roles_claim", env: "AUTH_JWT_ROLES_CLAIM", def: "roles", usage: "claim holding the caller's roles", value: (*stringValue)(&c.AuthJWTRolesClaim)},
+        {key: "auth.jwt.leeway", env: "AUTH_JWT_LEEWAY", def: "30s", usage: "allowed clock skew for exp/nbf/iat", value: (*durationValue)(&c.AuthJWTLeeway)},
+
+        {key: "acl.file", env: "ACL_FILE", usage: "YAML rules mapping users and roles to custodians and folders", value: (*stringValue)(&c.ACLFile)},
+
+        {key: "ratelimit.enabled", env: "RATE_LIMIT_ENABLED", def: "true", usage: "limit requests per client", value: (*boolValue)(&c.RateLimitEnabled)},
+        {key: "ratelimit.search.rate", env: "RATE_LIMIT_SEARCH_RATE", def: "10", usage: "searches per second per client (0 = unlimited)", value: (*floatValue)(&c.RateLimitSearchRate)},
+        {key: "ratelimit.search.burst", env: "RATE_LIMIT_SEARCH_BURST", def: "20", usage: "search burst per client", value: (*intValue)(&c.RateLimitSearchBurst)},
+        {key: "ratelimit.export.rate", env: "RATE_LIMIT_EXPORT_RATE", def: "0.1", usage: "exports per second per client (0 = unlimited)", value: (*floatValue)(&c.RateLimitExportRate)},
+        {key: "ratelimit.export.burst", env: "RATE_LIMIT_EXPORT_BURST", def: "2", usage: "export burst per client", value: (*intValue)(&c.RateLimitExportBurst)},
+        {key: "ratelimit.admin.rate", env: "RATE_LIMIT_ADMIN_RATE", def: "2", usage: "admin requests per second per client (0 = unlimited)", value: (*floatValue)(&c.RateLimitAdminRate)},
+        {key: "ratelimit.admin.burst", env: "RATE_LIMIT_ADMIN_BURST", def: "10", usage: "admin burst per client", value: (*intValue)(&c.RateLimitAdminBurst)},
+        {key: "ratelimit.auth.rate", env: "RATE_LIMIT_AUTH_RATE", def: "0.1", usage: "failed authentications per second per client IP (0 = unlimited)", value: (*floatValue)(&c.RateLimitAuthRate)},
+        {key: "ratelimit.auth.burst", env: "RATE_LIMIT_AUTH_BURST", def: "10", usage: "failed authentication burst per client IP", value: (*intValue)(&c.RateLimitAuthBurst)},
+        {key: "ratelimit.trusted_proxies", env: "TRUSTED_PROXIES", usage: "proxy IPs or CIDRs whose X-Forwarded-For is trusted", value: (*listValue)(&c.TrustedProxies)},
+
+        {key: "audit.file", env: "AUDIT_FILE", def: "audit.jsonl", usage: "append-only audit log (empty disables it)", value: (*stringValue)(&c.AuditFile)},
+        {key: "audit.max_size_mb", env: "AUDIT_MAX_SIZE_MB", def: "100", usage: "rotate the audit log at this size", value: (*int64Value)(&c.AuditMaxSizeMB)},
+        {key: "audit.max_backups", env: "AUDIT_MAX_BACKUPS", def: "0", usage: "rotated audit files to keep (0 keeps all)", value: (*intValue)(&c.AuditMaxBackups)},
+        {key: "audit.zinc_index", env: "AUDIT_ZINC_INDEX", usage: "also write audit events to this ZincSearch index", value: (*stringValue)(&c.AuditZincIndex)},
+        {key: "audit.admin_role", env: "AUDIT_ADMIN_ROLE", def: "admin", usage: "role required for /api/admin endpoints", value: (*stringValue)(&c.AuditAdminRole)},
+
+        {key: "log.format", env: "LOG_FORMAT", def: "json", usage: "json or text", value: (*stringValue)(&c.LogFormat)},
+        {key: "log.level", env: "LOG_LEVEL", def: "info", usage: "debug, info, warn or error", value: (*stringValue)(&c.LogLevel)},
+        {key: "log.redaction", env: "LOG_REDACTION", def: "truncate", usage: "none, truncate, hash or redact", value: (*stringValue)(&c.LogRedaction)},
+        {key: "log.redact_max_len", env: "LOG_REDACT_MAX_LEN", def: "32", usage: "characters kept by the truncate policy", value: (*intValue)(&c.LogRedactMaxLen)},
+        {key: "log.redact_hash_key", env: "LOG_REDACT_HASH_KEY", usage: "HMAC key for the hash policy (random per process if empty)", secret: true, value: (*stringValue)(&c.LogRedactHashKey)},
+    }
+}
+
+func (s *setting) flagName() string {
+    return flagName(s.key)
+}
+
+func flagName(key string) string {
+    return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+func (s *setting) isBool() bool {
+    _, ok := s.value.(*boolValue)
+    return ok
+}
+
+func (s *setting) isList() bool {
+    _, ok := s.value.(*listValue)
+    return ok
+}
+
+// fileEnvs devuelve las variables con la ruta de un archivo del que leer el secreto.
+func (s *setting) fileEnvs() []string {
+    envs := []string{s.env + "_FILE"}
+    if s.key == "zinc.password" {
+        envs = append(envs, "ZINC_PASSWORD_FILE")
+    }
+    return envs
+}
+
+// loadFile lee el archivo YAML o TOML (según la extensión) y aplica sus valores. Las secciones
+// anidadas se aplanan a claves con puntos ("zinc: {url: ...}" o "[zinc] url = ..." -> "zinc.url").
+func (c *Config) loadFile(settings []*setting, file string) []error {
+    var unmarshal func([]byte, interface{}) error
+    switch strings.ToLower(filepath.Ext(file)) {
+    case ".yaml", ".yml":
+        unmarshal = yaml.Unmarshal
+    case ".toml":
+        unmarshal = toml.Unmarshal
+    default:
+        return []error{fmt.Errorf("config file %s: only YAML (.yaml, .yml) and TOML (.toml) files are supported", file)}
+    }
+    content, err := os.ReadFile(file)
+    if err != nil {
+        return []error{fmt.Errorf("config file: %w", err)}
+    }
+
+    var raw map[string]interface{}
+    if err := unmarshal(content, &raw); err != nil {
+        return []error{fmt.Errorf("config file %s: %w", file, err)}
+    }
+
+    values := make(map[string]string)
+    flatten("", raw, values)
+    return applyValues(settings, values, "config file: ")
+}
+
+func flatten(prefix string, raw map[string]interface{}, values map[string]string) {
+    for key, v := range raw {
+        if prefix != "" {
+            key = prefix + "." + key
+        }
+        switch v := v.(type) {
+        case map[string]interface{}:
+            flatten(key, v, values)
+        case []interface{}:
+            items := make([]string, len(v))
+            for i, item := range v {
+                items[i] = fmt.Sprint(item)
+            }
+            values[key] = strings.Join(items, ",")
+        case nil:
+            values[key] = ""
+        default:
+            values[key] = fmt.Sprint(v)
+        }
+    }
+}
+
+// flagRecorder guarda el valor de un flag para aplicarlo después del archivo y del entorno.
+type flagRecorder struct {
+    key    string
+    values map[string]string
+    isBool bool
+}
+
+func (f *flagRecorder) Set(value string) error {
+    f.values[f.key] = value
+    return nil
+}
+
+func (f *flagRecorder) String() string   { return "" }
+func (f *flagRecorder) IsBoolFlag() bool { return f.isBool }
+
+// Tipos de valor soportados.
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(strings.TrimSpace(s)); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+    n, err := strconv.Atoi(strings.TrimSpace(s))
+    if err != nil {
+        return fmt.Errorf("invalid integer %q", s)
+    }
+    *v = intValue(n)
+    return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+    n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid integer %q", s)
+    }
+    *v = int64Value(n)
+    return nil
+}
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+    n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+    if err != nil {
+        return fmt.Errorf("invalid number %q", s)
+    }
+    *v = floatValue(n)
+    return nil
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+    b, err := strconv.ParseBool(strings.TrimSpace(s))
+    if err != nil {
+        return fmt.Errorf("invalid boolean %q", s)
+    }
+    *v = boolValue(b)
+    return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+// listValue es una lista separada por comas (en YAML también puede escribirse como lista).
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+    *v = nil
+    for _, item := range strings.Split(s, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            *v = append(*v, item)
+        }
+    }
+    return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+    d, err := time.ParseDuration(strings.TrimSpace(s))
+    if err != nil {
+        return fmt.Errorf("invalid duration %q (use values like 500ms, 10s or 5m)", s)
+    }
+    *v = durationValue(d)
+    return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// sortedKeys devuelve las claves de la tabla ordenadas, para una salida estable.
+func sortedKeys(settings []*setting) []*setting {
+    sorted := append([]*setting(nil), settings...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+    return sorted
+}
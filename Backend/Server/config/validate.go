@@ -0,0 +1,233 @@
+package config
+
+//Validación de la configuración ya cargada. Se revisan todas las opciones y se devuelven
+//todos los problemas juntos, para poder corregirlos de una vez.
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Validate comprueba URLs, puertos, credenciales, tiempos y valores enumerados.
+func (c *Config) Validate() error {
+    var errs []error
+    fail := func(format string, args ...interface{}) {
+        errs = append(errs, fmt.Errorf(format, args...))
+    }
+
+    if u, err := url.Parse(c.ZincSearchURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        fail("zinc.url: %q must be an absolute http(s) URL", c.ZincSearchURL)
+    }
+    if c.ZincSearchUser == "" {
+        fail("zinc.user: ZincSearch user is required (ZINC_FIRST_ADMIN_USER)")
+    }
+    if c.ZincSearchPassword == "" {
+        fail("zinc.password: ZincSearch password is required (ZINC_FIRST_ADMIN_PASSWORD or ZINC_PASSWORD_FILE)")
+    }
+    if !strings.HasPrefix(c.EndpointIndex, "/") || c.IndexName() == "/" {
+        fail("zinc.index_endpoint: %q must be a path like /api/emails", c.EndpointIndex)
+    }
+    if port, err := strconv.Atoi(c.ServerPort); err != nil || port < 1 || port > 65535 {
+        fail("server.port: %q must be a number between 1 and 65535", c.ServerPort)
+    }
+
+    positive := map[string]time.Duration{
+        "server.read_timeout":         c.ServerReadTimeout,
+        "server.read_header_timeout":  c.ServerReadHeaderTimeout,
+        "server.write_timeout":        c.ServerWriteTimeout,
+        "server.idle_timeout":         c.ServerIdleTimeout,
+        "server.shutdown_timeout":     c.ShutdownTimeout,
+        "zinc.timeouts.search":        c.ZincTimeoutSearch,
+        "zinc.timeouts.export":        c.ZincTimeoutExport,
+        "zinc.timeouts.health":        c.ZincTimeoutHealth,
+        "zinc.timeouts.folders":       c.ZincTimeoutFolders,
+        "zinc.transport.dial_timeout": c.ZincDialTimeout,
+        "zinc.retry.backoff":          c.ZincRetryBackoff,
+        "zinc.retry.max_backoff":      c.ZincRetryMaxBackoff,
+        "zinc.breaker.cooldown":       c.ZincBreakerCooldown,
+        "cache.ttl":                   c.CacheTTL,
+    }
+    for _, s := range sortedKeys(c.settings()) {
+        if d, ok := positive[s.key]; ok && d <= 0 {
+            fail("%s: must be greater than zero", s.key)
+        }
+    }
+    if c.ServerReadHeaderTimeout > c.ServerReadTimeout {
+        fail("server.read_header_timeout: must not exceed server.read_timeout")
+    }
+
+    if c.ServerMaxHeaderBytes < 1024 {
+        fail("server.max_header_bytes: must be at least 1024")
+    }
+    if c.ExportPageSize < 1 {
+        fail("export.page_size: must be at least 1")
+    }
+    if c.ZincRetryMax < 0 {
+        fail("zinc.retry.max: must not be negative")
+    }
+    if c.ZincBreakerThreshold < 1 {
+        fail("zinc.breaker.threshold: must be at least 1")
+    }
+    if c.ZincMaxIdleConns < 0 || c.ZincMaxIdleConnsPerHost < 0 {
+        fail("zinc.transport: connection pool sizes must not be negative")
+    }
+    if c.CacheEnabled && c.CacheMaxBytes <= 0 {
+        fail("cache.max_bytes: must be greater than zero when the cache is enabled")
+    }
+    if c.ReadyMinDocs < 0 {
+        fail("ready.min_docs: must not be negative")
+    }
+
+    if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+        fail("tls: cert_file and key_file must be set together")
+    }
+    for key, file := range map[string]string{"tls.cert_file": c.TLSCertFile, "tls.key_file": c.TLSKeyFile} {
+        if file == "" {
+            continue
+        }
+        if _, err := os.Stat(file); err != nil {
+            fail("%s: %v", key, err)
+        }
+    }
+
+    errs = append(errs, validateCORS("cors.api", c.CORSAPI)...)
+    errs = append(errs, validateCORS("cors.admin", c.CORSAdmin)...)
+
+    if c.AuthEnabled && len(c.AuthAPIKeys) == 0 && c.AuthJWTHMACSecret == "" && c.AuthJWTJWKSFile == "" {
+        fail("auth: enabled but no api_keys, jwt.hmac_secret or jwt.jwks_file configured")
+    }
+    for _, entry := range c.AuthAPIKeys {
+        parts := strings.Split(entry, ":")
+        if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || len(parts[1]) != 64 || strings.Trim(strings.ToLower(parts[1]), "0123456789abcdef") != "" {
+            fail("auth.api_keys: entry for %q must be name:sha256hex[:role1|role2]", parts[0])
+        }
+    }
+    if c.AuthJWTHMACSecret != "" && len(c.AuthJWTHMACSecret) < 32 {
+        fail("auth.jwt.hmac_secret: must be at least 32 bytes")
+    }
+    if c.AuthJWTJWKSFile != "" {
+        if _, err := os.Stat(c.AuthJWTJWKSFile); err != nil {
+            fail("auth.jwt.jwks_file: %v", err)
+        }
+    }
+    if c.AuthJWTLeeway < 0 {
+        fail("auth.jwt.leeway: must not be negative")
+    }
+
+    if c.IndexMappingFile != "" {
+        if _, err := os.Stat(c.IndexMappingFile); err != nil {
+            fail("index.mapping_file: %v", err)
+        }
+    } else if c.IndexMappingStrict {
+        fail("index.mapping_strict: needs index.mapping_file")
+    }
+
+    if c.ACLFile != "" {
+        if !c.AuthEnabled {
+            fail("acl.file: access control needs authentication (auth.enabled)")
+        }
+        if _, err := os.Stat(c.ACLFile); err != nil {
+            fail("acl.file: %v", err)
+        }
+    }
+
+    for _, limit := range []struct {
+        key   string
+        rate  float64
+        burst int
+    }{
+        {"ratelimit.search", c.RateLimitSearchRate, c.RateLimitSearchBurst},
+        {"ratelimit.export", c.RateLimitExportRate, c.RateLimitExportBurst},
+        {"ratelimit.admin", c.RateLimitAdminRate, c.RateLimitAdminBurst},
+        {"ratelimit.auth", c.RateLimitAuthRate, c.RateLimitAuthBurst},
+    } {
+        if limit.rate < 0 {
+            fail("%s.rate: must not be negative", limit.key)
+        }
+        if limit.rate > 0 && limit.burst < 1 {
+            fail("%s.burst: must be at least 1", limit.key)
+        }
+    }
+    for _, proxy := range c.TrustedProxies {
+        if net.ParseIP(proxy) == nil {
+            if _, _, err := net.ParseCIDR(proxy); err != nil {
+                fail("ratelimit.trusted_proxies: %q is not an IP or CIDR", proxy)
+            }
+        }
+    }
+
+    if c.AuditMaxSizeMB < 0 || c.AuditMaxBackups < 0 {
+        fail("audit: max_size_mb and max_backups must not be negative")
+    }
+    if c.AuditZincIndex != "" && !validIndexName.MatchString(c.AuditZincIndex) {
+        fail("audit.zinc_index: %q is not a valid index name", c.AuditZincIndex)
+    }
+    if c.AuthEnabled && c.AuditAdminRole == "" {
+        fail("audit.admin_role: must not be empty when auth is enabled")
+    }
+
+    oneOf(&errs, "folders.source", c.FoldersSource, "index", "filesystem")
+    if c.FoldersMaxBuckets < 1 {
+        fail("folders.max_buckets: must be at least 1")
+    }
+    if c.FoldersRefreshInterval < 0 || c.FoldersPollInterval < 0 {
+        fail("folders.refresh_interval, folders.poll_interval: must not be negative")
+    }
+    if c.FoldersSource == "filesystem" && c.FoldersRoot != "" {
+        if info, err := os.Stat(c.FoldersRoot); err != nil || !info.IsDir() {
+            fail("folders.root: %q is not a readable directory", c.FoldersRoot)
+        }
+    }
+
+    oneOf(&errs, "tracing.exporter", c.TracingExporter, "none", "stdout", "file", "otlp")
+    if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+        fail("tracing.sample_ratio: must be between 0 and 1")
+    }
+    oneOf(&errs, "log.format", c.LogFormat, "json", "text")
+    oneOf(&errs, "log.level", strings.ToLower(c.LogLevel), "debug", "info", "warn", "warning", "error")
+    oneOf(&errs, "log.redaction", c.LogRedaction, "none", "truncate", "hash", "redact")
+
+    return errors.Join(errs...)
+}
+
+func validateCORS(key string, p CORSPolicy) []error {
+    var errs []error
+    for _, origin := range p.AllowedOrigins {
+        if origin == "*" {
+            if p.AllowCredentials {
+                errs = append(errs, fmt.Errorf("%s.allowed_origins: \"*\" cannot be combined with allow_credentials; list the origins instead", key))
+            }
+            continue
+        }
+        u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+            errs = append(errs, fmt.Errorf("%s.allowed_origins: %q must look like https://app.example.com or https://*.example.com", key, origin))
+        }
+    }
+    for _, method := range p.AllowedMethods {
+        if method != strings.ToUpper(method) || strings.ContainsAny(method, " /") {
+            errs = append(errs, fmt.Errorf("%s.allowed_methods: %q is not an HTTP method", key, method))
+        }
+    }
+    if p.MaxAge < 0 {
+        errs = append(errs, fmt.Errorf("%s.max_age: must not be negative", key))
+    }
+    return errs
+}
+
+var validIndexName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func oneOf(errs *[]error, key, value string, allowed ...string) {
+    for _, a := range allowed {
+        if value == a {
+            return
+        }
+    }
+    *errs = append(*errs, fmt.Errorf("%s: %q must be one of %s", key, value, strings.Join(allowed, ", ")))
+}
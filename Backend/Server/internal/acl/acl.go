@@ -0,0 +1,220 @@
+package acl
+
+//Control de acceso por custodio. Las reglas (un archivo YAML) asignan a cada usuario o rol los
+//buzones (custodios) y carpetas que puede ver. El middleware calcula el Scope del principal
+//autenticado y lo guarda en el contexto; los servicios lo aplican a búsquedas, exportaciones,
+//lectura de correos y listado de carpetas.
+//
+//Formato del archivo:
+//
+//    rules:
+//      - roles: [reviewer-team-a]
+//        custodians: [allen-p, arnold-j]
+//      - subjects: [alice]
+//        folders: [lay-k/inbox, lay-k/sent]
+//      - roles: [admin]
+//        custodians: ["*"]
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "server/internal/auth"
+    "server/internal/models"
+)
+
+// ErrNoAccess indica que el principal no tiene ningún custodio ni carpeta asignados.
+var ErrNoAccess = errors.New("no mailboxes assigned to this user")
+
+// Rule asigna custodios y carpetas ("custodio/carpeta") a usuarios (sujetos) y roles.
+type Rule struct {
+    Subjects   []string `yaml:"subjects"`
+    Roles      []string `yaml:"roles"`
+    Custodians []string `yaml:"custodians"`
+    Folders    []string `yaml:"folders"`
+}
+
+// Policy es el conjunto de reglas cargado del archivo.
+type Policy struct {
+    Rules []Rule `yaml:"rules"`
+}
+
+// Load lee y valida el archivo de reglas.
+func Load(file string) (*Policy, error) {
+    content, err := os.ReadFile(file)
+    if err != nil {
+        return nil, fmt.Errorf("acl: %w", err)
+    }
+    var policy Policy
+    decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+    decoder.KnownFields(true)
+    if err := decoder.Decode(&policy); err != nil {
+        return nil, fmt.Errorf("acl %s: %w", file, err)
+    }
+
+    var errs []error
+    for i, rule := range policy.Rules {
+        if len(rule.Subjects) == 0 && len(rule.Roles) == 0 {
+            errs = append(errs, fmt.Errorf("acl %s: rule %d has no subjects or roles", file, i+1))
+        }
+        if len(rule.Custodians) == 0 && len(rule.Folders) == 0 {
+            errs = append(errs, fmt.Errorf("acl %s: rule %d grants no custodians or folders", file, i+1))
+        }
+        for _, folder := range rule.Folders {
+            if custodian, sub, ok := strings.Cut(folder, "/"); !ok || custodian == "" || sub == "" {
+                errs = append(errs, fmt.Errorf("acl %s: rule %d: folder %q must be custodian/folder", file, i+1, folder))
+            }
+        }
+    }
+    if err := errors.Join(errs...); err != nil {
+        return nil, err
+    }
+    return &policy, nil
+}
+
+// ScopeFor une los custodios y carpetas de todas las reglas que aplican al principal. Un
+// principal sin reglas obtiene un Scope vacío, que no da acceso a nada.
+func (p *Policy) ScopeFor(principal *auth.Principal) Scope {
+    if p == nil {
+        return Unrestricted
+    }
+    if principal == nil {
+        return Scope{}
+    }
+
+    custodians := make(map[string]bool)
+    folders := make(map[string]bool)
+    for _, rule := range p.Rules {
+        if !rule.appliesTo(principal) {
+            continue
+        }
+        for _, c := range rule.Custodians {
+            if c == "*" {
+                return Unrestricted
+            }
+            custodians[c] = true
+        }
+        for _, f := range rule.Folders {
+            folders[strings.Trim(f, "/")] = true
+        }
+    }
+
+    scope := Scope{}
+    for c := range custodians {
+        scope.Custodians = append(scope.Custodians, c)
+    }
+    for f := range folders {
+        // Una carpeta dentro de un custodio ya permitido no añade nada.
+        if custodian, _, _ := strings.Cut(f, "/"); !custodians[custodian] {
+            scope.Folders = append(scope.Folders, f)
+        }
+    }
+    sort.Strings(scope.Custodians)
+    sort.Strings(scope.Folders)
+    return scope
+}
+
+func (r Rule) appliesTo(principal *auth.Principal) bool {
+    for _, s := range r.Subjects {
+        if s == principal.Subject {
+            return true
+        }
+    }
+    for _, role := range r.Roles {
+        if principal.HasRole(role) {
+            return true
+        }
+    }
+    return false
+}
+
+// Scope es lo que un principal puede ver: todo (All) o una lista de custodios completos y de
+// carpetas sueltas ("custodio/carpeta", que incluye sus subcarpetas).
+type Scope struct {
+    All        bool
+    Custodians []string
+    Folders    []string
+}
+
+// Unrestricted es el Scope sin restricciones (ACL desactivada o regla con "*").
+var Unrestricted = Scope{All: true}
+
+// Empty indica que el Scope no da acceso a ningún buzón.
+func (s Scope) Empty() bool {
+    return !s.All && len(s.Custodians) == 0 && len(s.Folders) == 0
+}
+
+// AllowsCustodian indica si se puede ver al menos parte del buzón del custodio.
+func (s Scope) AllowsCustodian(custodian string) bool {
+    if s.All || contains(s.Custodians, custodian) {
+        return true
+    }
+    for _, f := range s.Folders {
+        if strings.HasPrefix(f, custodian+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// AllowsFolder indica si se puede ver la carpeta (o subcarpeta) folder del custodio.
+func (s Scope) AllowsFolder(custodian, folder string) bool {
+    if s.All || contains(s.Custodians, custodian) {
+        return true
+    }
+    path := custodian + "/" + folder
+    for _, f := range s.Folders {
+        if path == f || strings.HasPrefix(path, f+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// AllowsPath comprueba el campo "folder" de un correo indexado.
+func (s Scope) AllowsPath(path string) bool {
+    if s.All {
+        return true
+    }
+    custodian, folder := models.ParseFolderPath(path)
+    return custodian != "" && s.AllowsFolder(custodian, folder)
+}
+
+// Key identifica el Scope en claves de caché: dos principales con el mismo alcance comparten
+// resultados, y uno con otro alcance nunca ve los del primero.
+func (s Scope) Key() string {
+    if s.All {
+        return "*"
+    }
+    return strings.Join(s.Custodians, ",") + ";" + strings.Join(s.Folders, ",")
+}
+
+func contains(list []string, value string) bool {
+    for _, item := range list {
+        if item == value {
+            return true
+        }
+    }
+    return false
+}
+
+type contextKey struct{}
+
+// WithScope devuelve un contexto con el alcance de la solicitud.
+func WithScope(ctx context.Context, scope Scope) context.Context {
+    return context.WithValue(ctx, contextKey{}, scope)
+}
+
+// FromContext devuelve el alcance de la solicitud. Sin ACL configurada no hay Scope en el
+// contexto y no se restringe nada.
+func FromContext(ctx context.Context) Scope {
+    if scope, ok := ctx.Value(contextKey{}).(Scope); ok {
+        return scope
+    }
+    return Unrestricted
+}
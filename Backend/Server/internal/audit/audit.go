@@ -0,0 +1,215 @@
+package audit
+
+//Registro de auditoría: quién buscó qué y qué correos vio o exportó. Cada evento se añade a un
+//archivo JSON-lines (con rotación por tamaño) y, opcionalmente, a un índice de ZincSearch
+//dedicado. Los servicios llaman a Record con el contexto de la solicitud, del que se toman el
+//principal autenticado y el request ID.
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "server/config"
+    "server/internal/auth"
+    "server/internal/logging"
+    "server/internal/metrics"
+    "server/internal/zinc"
+)
+
+// Acciones auditadas.
+const (
+    ActionSearch = "search"
+    ActionView   = "view"
+    ActionExport = "export"
+)
+
+// Resultados de una acción auditada.
+const (
+    OutcomeOK       = "ok"
+    OutcomeDenied   = "denied"
+    OutcomeNotFound = "not_found"
+    OutcomeError    = "error"
+)
+
+// Query es la búsqueda normalizada tal como se ejecutó.
+type Query struct {
+    Term       string   `json:"term,omitempty"`
+    Field      string   `json:"field,omitempty"`
+    Custodian  string   `json:"custodian,omitempty"`
+    FolderPath string   `json:"folder_path,omitempty"`
+    From       int      `json:"from,omitempty"`
+    Size       int      `json:"size,omitempty"`
+    Format     string   `json:"format,omitempty"`
+    Columns    []string `json:"columns,omitempty"`
+}
+
+// Event es una entrada del registro de auditoría.
+type Event struct {
+    Time        time.Time `json:"time"`
+    RequestID   string    `json:"request_id,omitempty"`
+    Principal   string    `json:"principal"`
+    AuthMethod  string    `json:"auth_method,omitempty"`
+    Action      string    `json:"action"`
+    Outcome     string    `json:"outcome"`
+    Query       *Query    `json:"query,omitempty"`
+    Hits        int       `json:"hits"`
+    DocumentIDs []string  `json:"document_ids,omitempty"`
+}
+
+// NormalizeTerm quita los espacios sobrantes del término, igual que la clave de caché.
+func NormalizeTerm(term string) string {
+    return strings.Join(strings.Fields(term), " ")
+}
+
+// Sink guarda eventos.
+type Sink interface {
+    Write(ctx context.Context, event Event) error
+    Close() error
+}
+
+// Log reparte cada evento entre los destinos configurados.
+type Log struct {
+    file  *FileSink
+    sinks []Sink
+}
+
+var defaultLog atomic.Pointer[Log]
+
+// Setup crea el registro de auditoría configurado y lo instala como registro por defecto.
+// Devuelve nil si no hay ningún destino configurado.
+func Setup(cfg *config.Config, client *zinc.Client) (*Log, error) {
+    l := &Log{}
+    if cfg.AuditFile != "" {
+        file, err := NewFileSink(cfg.AuditFile, cfg.AuditMaxSizeMB*1024*1024, cfg.AuditMaxBackups)
+        if err != nil {
+            return nil, err
+        }
+        l.file = file
+        l.sinks = append(l.sinks, file)
+    }
+    if cfg.AuditZincIndex != "" {
+        // Un índice de auditoría con problemas no debe abrir el circuito de las búsquedas.
+        l.sinks = append(l.sinks, NewZincSink(client.WithOwnBreaker(), cfg.AuditZincIndex))
+    }
+    if len(l.sinks) == 0 {
+        return nil, nil
+    }
+    defaultLog.Store(l)
+    return l, nil
+}
+
+// Default devuelve el registro instalado por Setup, o nil si la auditoría está desactivada.
+func Default() *Log {
+    return defaultLog.Load()
+}
+
+// SetDefault instala l como registro por defecto (nil lo desactiva).
+func SetDefault(l *Log) {
+    defaultLog.Store(l)
+}
+
+// Record completa el evento con la hora, el principal y el request ID del contexto y lo
+// escribe en el registro por defecto. Un fallo al escribir se registra en los logs y en las
+// métricas, pero no interrumpe la solicitud.
+func Record(ctx context.Context, event Event) {
+    l := Default()
+    if l == nil {
+        return
+    }
+
+    event.Time = time.Now().UTC()
+    event.RequestID = logging.RequestID(ctx)
+    event.Principal = "anonymous"
+    if principal := auth.FromContext(ctx); principal != nil {
+        event.Principal = principal.Subject
+        event.AuthMethod = principal.Method
+    }
+    if event.Outcome == "" {
+        event.Outcome = OutcomeOK
+    }
+    metrics.AuditEvents.WithLabelValues(event.Action, event.Outcome).Inc()
+
+    // El evento se guarda aunque el cliente ya se haya desconectado.
+    ctx = context.WithoutCancel(ctx)
+    for _, sink := range l.sinks {
+        if err := sink.Write(ctx, event); err != nil {
+            metrics.AuditErrors.Inc()
+            slog.ErrorContext(ctx, "cannot write audit event", "action", event.Action, "error", err)
+        }
+    }
+}
+
+// Outcome clasifica el error de una acción para el registro.
+func Outcome(err error, denied, notFound error) string {
+    switch {
+    case err == nil:
+        return OutcomeOK
+    case errors.Is(err, denied):
+        return OutcomeDenied
+    case errors.Is(err, notFound):
+        return OutcomeNotFound
+    }
+    return OutcomeError
+}
+
+// Search devuelve los eventos más recientes que cumplen filter, del más nuevo al más antiguo.
+// Se leen del archivo local, que es la copia completa del registro.
+func (l *Log) Search(filter Filter) ([]Event, error) {
+    if l == nil || l.file == nil {
+        return nil, errors.New("audit file is not configured")
+    }
+    return l.file.Search(filter)
+}
+
+// Close cierra todos los destinos.
+func (l *Log) Close() error {
+    if l == nil {
+        return nil
+    }
+    var errs []error
+    for _, sink := range l.sinks {
+        errs = append(errs, sink.Close())
+    }
+    return errors.Join(errs...)
+}
+
+// Filter selecciona eventos en Search. Los campos vacíos no filtran.
+type Filter struct {
+    Principal  string
+    Action     string
+    RequestID  string
+    DocumentID string
+    Since      time.Time
+    Until      time.Time
+    Limit      int
+}
+
+func (f Filter) matches(e Event) bool {
+    if f.Principal != "" && e.Principal != f.Principal {
+        return false
+    }
+    if f.Action != "" && e.Action != f.Action {
+        return false
+    }
+    if f.RequestID != "" && e.RequestID != f.RequestID {
+        return false
+    }
+    if !f.Since.IsZero() && e.Time.Before(f.Since) {
+        return false
+    }
+    if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+        return false
+    }
+    if f.DocumentID != "" {
+        for _, id := range e.DocumentIDs {
+            if id == f.DocumentID {
+                return true
+            }
+        }
+        return false
+    }
+    return true
+}
@@ -0,0 +1,176 @@
+package audit
+
+//Destino de auditoría en un archivo JSON-lines. El archivo solo se abre en modo de añadir y,
+//al superar el tamaño máximo, se renombra con la fecha (audit-20240101T120000Z.jsonl) y se
+//empieza uno nuevo. Las copias más antiguas que MaxBackups se eliminan.
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+type FileSink struct {
+    path       string
+    maxBytes   int64
+    maxBackups int
+
+    mu   sync.Mutex
+    file *os.File
+    size int64
+}
+
+// NewFileSink abre (o crea) el archivo de auditoría. maxBytes <= 0 desactiva la rotación y
+// maxBackups <= 0 conserva todas las copias rotadas.
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+    f := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+    if err := f.open(); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+func (f *FileSink) open() error {
+    if dir := filepath.Dir(f.path); dir != "." {
+        if err := os.MkdirAll(dir, 0o750); err != nil {
+            return fmt.Errorf("audit: %w", err)
+        }
+    }
+    file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+    if err != nil {
+        return fmt.Errorf("audit: %w", err)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return fmt.Errorf("audit: %w", err)
+    }
+    f.file, f.size = file, info.Size()
+    return nil
+}
+
+func (f *FileSink) Write(_ context.Context, event Event) error {
+    line, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    line = append(line, '\n')
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if f.file == nil {
+        return fmt.Errorf("audit: file is closed")
+    }
+    if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxBytes {
+        if err := f.rotate(); err != nil {
+            return err
+        }
+    }
+    n, err := f.file.Write(line)
+    f.size += int64(n)
+    return err
+}
+
+// rotate renombra el archivo actual y abre uno nuevo. Debe llamarse con f.mu tomado.
+func (f *FileSink) rotate() error {
+    if err := f.file.Close(); err != nil {
+        return fmt.Errorf("audit: %w", err)
+    }
+    f.file = nil
+
+    ext := filepath.Ext(f.path)
+    rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().UTC().Format("20060102T150405.000000000Z"), ext)
+    if err := os.Rename(f.path, rotated); err != nil {
+        return fmt.Errorf("audit: %w", err)
+    }
+    if err := f.open(); err != nil {
+        return err
+    }
+
+    if f.maxBackups > 0 {
+        backups := f.backups()
+        for len(backups) > f.maxBackups {
+            os.Remove(backups[0])
+            backups = backups[1:]
+        }
+    }
+    return nil
+}
+
+// backups devuelve las copias rotadas, de la más antigua a la más reciente.
+func (f *FileSink) backups() []string {
+    ext := filepath.Ext(f.path)
+    matches, _ := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+    sort.Strings(matches)
+    return matches
+}
+
+// Search lee el archivo actual y las copias rotadas, de la más reciente a la más antigua, y
+// devuelve hasta filter.Limit eventos que cumplen el filtro, del más nuevo al más antiguo.
+func (f *FileSink) Search(filter Filter) ([]Event, error) {
+    f.mu.Lock()
+    files := append(f.backups(), f.path)
+    f.mu.Unlock()
+
+    var events []Event
+    for i := len(files) - 1; i >= 0; i-- {
+        matched, err := searchFile(files[i], filter)
+        if err != nil {
+            return nil, err
+        }
+        // Dentro de un archivo los eventos están en orden cronológico.
+        for j := len(matched) - 1; j >= 0; j-- {
+            events = append(events, matched[j])
+            if filter.Limit > 0 && len(events) >= filter.Limit {
+                return events, nil
+            }
+        }
+    }
+    return events, nil
+}
+
+func searchFile(path string, filter Filter) ([]Event, error) {
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("audit: %w", err)
+    }
+    defer file.Close()
+
+    var events []Event
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    for scanner.Scan() {
+        var event Event
+        if json.Unmarshal(scanner.Bytes(), &event) != nil {
+            continue
+        }
+        if filter.matches(event) {
+            events = append(events, event)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("audit %s: %w", path, err)
+    }
+    return events, nil
+}
+
+func (f *FileSink) Close() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.file == nil {
+        return nil
+    }
+    err := f.file.Close()
+    f.file = nil
+    return err
+}
@@ -0,0 +1,103 @@
+package audit
+
+//Destino de auditoría en un índice de ZincSearch dedicado, útil para consultar el registro con
+//las herramientas de Zinc. El archivo local sigue siendo la copia de referencia. Los eventos
+//se envían en segundo plano desde una cola acotada, para que un índice lento o caído no añada
+//latencia a las solicitudes; si la cola se llena el evento se descarta (y queda en el archivo).
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "net/http"
+    "sync"
+    "time"
+
+    "server/internal/metrics"
+    "server/internal/zinc"
+)
+
+// zincQueueSize es el número de eventos pendientes de enviar que caben en la cola.
+const zincQueueSize = 1024
+
+// zincDrainTimeout es lo que Close espera a que se envíen los eventos pendientes.
+const zincDrainTimeout = 5 * time.Second
+
+var errZincQueueFull = errors.New("audit zinc queue is full, event dropped")
+
+type ZincSink struct {
+    client *zinc.Client
+    index  string
+
+    mu     sync.RWMutex
+    closed bool
+    events chan Event
+    done   chan struct{}
+}
+
+// NewZincSink crea el destino y arranca el envío en segundo plano. El cliente debería tener su
+// propio circuit breaker (zinc.Client.WithOwnBreaker), para no compartirlo con las búsquedas.
+func NewZincSink(client *zinc.Client, index string) *ZincSink {
+    z := &ZincSink{
+        client: client,
+        index:  index,
+        events: make(chan Event, zincQueueSize),
+        done:   make(chan struct{}),
+    }
+    go z.run()
+    return z
+}
+
+// Write encola el evento sin esperar a ZincSearch.
+func (z *ZincSink) Write(ctx context.Context, event Event) error {
+    z.mu.RLock()
+    defer z.mu.RUnlock()
+    if z.closed {
+        return errors.New("audit zinc sink is closed")
+    }
+    select {
+    case z.events <- event:
+        return nil
+    default:
+        return errZincQueueFull
+    }
+}
+
+func (z *ZincSink) run() {
+    defer close(z.done)
+    for event := range z.events {
+        if err := z.send(event); err != nil {
+            metrics.AuditErrors.Inc()
+            slog.Error("cannot write audit event to zinc", "index", z.index, "action", event.Action,
+                "request_id", event.RequestID, "error", err)
+        }
+    }
+}
+
+func (z *ZincSink) send(event Event) error {
+    body, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    _, err = z.client.Do(context.Background(), zinc.OpAudit, http.MethodPost, "/api/"+z.index+"/_doc", body)
+    return err
+}
+
+// Close deja de aceptar eventos y espera, con un límite, a que se envíen los pendientes.
+func (z *ZincSink) Close() error {
+    z.mu.Lock()
+    if z.closed {
+        z.mu.Unlock()
+        return nil
+    }
+    z.closed = true
+    close(z.events)
+    z.mu.Unlock()
+
+    select {
+    case <-z.done:
+        return nil
+    case <-time.After(zincDrainTimeout):
+        return errors.New("audit zinc sink: timed out sending pending events")
+    }
+}
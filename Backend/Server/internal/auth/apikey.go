@@ -0,0 +1,87 @@
+package auth
+
+//API keys estáticas. En la configuración solo se guarda el SHA-256 de cada clave, nunca la
+//clave en claro. Cada entrada tiene la forma "nombre:sha256hex" o "nombre:sha256hex:rol1|rol2".
+//La clave se envía en la cabecera X-API-Key o como "Authorization: Bearer <clave>".
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+type apiKey struct {
+    name  string
+    hash  [sha256.Size]byte
+    roles []string
+}
+
+// APIKeys autentica solicitudes con una de las claves configuradas.
+type APIKeys struct {
+    keys []apiKey
+}
+
+// NewAPIKeys interpreta las entradas "nombre:sha256hex[:roles]" de la configuración.
+func NewAPIKeys(entries []string) (*APIKeys, error) {
+    a := &APIKeys{}
+    for _, entry := range entries {
+        key, err := parseAPIKey(entry)
+        if err != nil {
+            return nil, err
+        }
+        a.keys = append(a.keys, key)
+    }
+    return a, nil
+}
+
+func parseAPIKey(entry string) (apiKey, error) {
+    parts := strings.Split(entry, ":")
+    if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+        return apiKey{}, fmt.Errorf("api key %q: expected name:sha256hex[:role1|role2]", entry)
+    }
+    sum, err := hex.DecodeString(parts[1])
+    if err != nil || len(sum) != sha256.Size {
+        return apiKey{}, fmt.Errorf("api key %q: hash must be 64 hex characters (sha256 of the key)", parts[0])
+    }
+    key := apiKey{name: parts[0]}
+    copy(key.hash[:], sum)
+    if len(parts) == 3 && parts[2] != "" {
+        key.roles = strings.Split(parts[2], "|")
+    }
+    return key, nil
+}
+
+// HashAPIKey devuelve el hash con el que se configura una clave.
+func HashAPIKey(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return hex.EncodeToString(sum[:])
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+    key := r.Header.Get(APIKeyHeader)
+    if key == "" {
+        if token := bearerToken(r); token != "" && !looksLikeJWT(token) {
+            key = token
+        }
+    }
+    if key == "" {
+        return nil, ErrNoCredentials
+    }
+
+    sum := sha256.Sum256([]byte(key))
+    // Se comparan todas las claves en tiempo constante para no revelar cuál coincide.
+    var match *apiKey
+    for i := range a.keys {
+        if subtle.ConstantTimeCompare(sum[:], a.keys[i].hash[:]) == 1 {
+            match = &a.keys[i]
+        }
+    }
+    if match == nil {
+        return nil, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+    }
+    return &Principal{Subject: match.name, Method: MethodAPIKey, Roles: match.roles}, nil
+}
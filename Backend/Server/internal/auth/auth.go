@@ -0,0 +1,121 @@
+package auth
+
+//Autenticación de las solicitudes a la API. Un Authenticator identifica al llamador a partir
+//de la solicitud (una API key o un token JWT) y devuelve el Principal, que se guarda en el
+//contexto para que la autorización y la auditoría sepan quién hace cada petición.
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "server/config"
+)
+
+// Métodos de autenticación con los que se puede identificar un Principal.
+const (
+    MethodAPIKey = "api_key"
+    MethodJWT    = "jwt"
+)
+
+var (
+    // ErrNoCredentials indica que la solicitud no trae credenciales para este autenticador.
+    ErrNoCredentials = errors.New("no credentials")
+    // ErrInvalidCredentials indica credenciales presentes pero incorrectas, caducadas o mal formadas.
+    ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal es la identidad autenticada de quien hace la solicitud.
+type Principal struct {
+    Subject string                 `json:"subject"`
+    Method  string                 `json:"method"`
+    Roles   []string               `json:"roles,omitempty"`
+    Claims  map[string]interface{} `json:"-"`
+}
+
+// HasRole indica si el principal tiene el rol indicado.
+func (p *Principal) HasRole(role string) bool {
+    for _, r := range p.Roles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+// Authenticator identifica al llamador. Devuelve ErrNoCredentials si la solicitud no trae
+// credenciales que le correspondan, para que se pruebe el siguiente autenticador.
+type Authenticator interface {
+    Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain prueba los autenticadores en orden y devuelve el primer resultado que no sea
+// ErrNoCredentials.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+    for _, a := range c {
+        principal, err := a.Authenticate(r)
+        if errors.Is(err, ErrNoCredentials) {
+            continue
+        }
+        return principal, err
+    }
+    return nil, ErrNoCredentials
+}
+
+// New construye los autenticadores configurados: API keys y/o JWT. Devuelve nil si la
+// autenticación está desactivada.
+func New(cfg *config.Config) (Authenticator, error) {
+    if !cfg.AuthEnabled {
+        return nil, nil
+    }
+
+    var chain Chain
+    if len(cfg.AuthAPIKeys) > 0 {
+        keys, err := NewAPIKeys(cfg.AuthAPIKeys)
+        if err != nil {
+            return nil, err
+        }
+        chain = append(chain, keys)
+    }
+    if cfg.AuthJWTHMACSecret != "" || cfg.AuthJWTJWKSFile != "" {
+        verifier, err := NewJWTVerifier(cfg)
+        if err != nil {
+            return nil, err
+        }
+        chain = append(chain, verifier)
+    }
+    if len(chain) == 0 {
+        return nil, fmt.Errorf("auth is enabled but no API keys or JWT keys are configured")
+    }
+    return chain, nil
+}
+
+type contextKey struct{}
+
+// WithPrincipal devuelve un contexto que lleva el principal autenticado.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+    return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext devuelve el principal de la solicitud, o nil si no se autenticó.
+func FromContext(ctx context.Context) *Principal {
+    p, _ := ctx.Value(contextKey{}).(*Principal)
+    return p
+}
+
+// bearerToken devuelve el token de "Authorization: Bearer <token>", si lo hay.
+func bearerToken(r *http.Request) string {
+    scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+    if !ok || !strings.EqualFold(scheme, "Bearer") {
+        return ""
+    }
+    return strings.TrimSpace(token)
+}
+
+// looksLikeJWT distingue un JWT (tres partes separadas por puntos) de una API key.
+func looksLikeJWT(token string) bool {
+    return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,175 @@
+package auth
+
+//Verificación de tokens JWT enviados como "Authorization: Bearer <token>". Se aceptan HS256,
+//con un secreto compartido, y RS256, con las claves públicas de un archivo JWKS local. El
+//sujeto del token ("sub") es el Principal y sus roles salen del claim configurado.
+import (
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "math/big"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/golang-jwt/jwt/v5"
+
+    "server/config"
+)
+
+// JWTVerifier valida tokens firmados con las claves configuradas.
+type JWTVerifier struct {
+    hmacKeys   map[string][]byte
+    rsaKeys    map[string]*rsa.PublicKey
+    parser     *jwt.Parser
+    rolesClaim string
+}
+
+// NewJWTVerifier carga el secreto HS256 y el archivo JWKS de la configuración.
+func NewJWTVerifier(cfg *config.Config) (*JWTVerifier, error) {
+    v := &JWTVerifier{
+        hmacKeys:   make(map[string][]byte),
+        rsaKeys:    make(map[string]*rsa.PublicKey),
+        rolesClaim: cfg.AuthJWTRolesClaim,
+    }
+    if cfg.AuthJWTHMACSecret != "" {
+        v.hmacKeys[""] = []byte(cfg.AuthJWTHMACSecret)
+    }
+    if cfg.AuthJWTJWKSFile != "" {
+        if err := v.loadJWKS(cfg.AuthJWTJWKSFile); err != nil {
+            return nil, err
+        }
+    }
+
+    opts := []jwt.ParserOption{
+        jwt.WithValidMethods([]string{"HS256", "RS256"}),
+        jwt.WithExpirationRequired(),
+        jwt.WithLeeway(cfg.AuthJWTLeeway),
+    }
+    if cfg.AuthJWTIssuer != "" {
+        opts = append(opts, jwt.WithIssuer(cfg.AuthJWTIssuer))
+    }
+    if cfg.AuthJWTAudience != "" {
+        opts = append(opts, jwt.WithAudience(cfg.AuthJWTAudience))
+    }
+    v.parser = jwt.NewParser(opts...)
+    return v, nil
+}
+
+type jwks struct {
+    Keys []struct {
+        Kty string `json:"kty"`
+        Kid string `json:"kid"`
+        Alg string `json:"alg"`
+        Use string `json:"use"`
+        N   string `json:"n"`
+        E   string `json:"e"`
+        K   string `json:"k"`
+    } `json:"keys"`
+}
+
+func (v *JWTVerifier) loadJWKS(file string) error {
+    content, err := os.ReadFile(file)
+    if err != nil {
+        return fmt.Errorf("jwks: %w", err)
+    }
+    var set jwks
+    if err := json.Unmarshal(content, &set); err != nil {
+        return fmt.Errorf("jwks %s: %w", file, err)
+    }
+
+    for _, key := range set.Keys {
+        if key.Use != "" && key.Use != "sig" {
+            continue
+        }
+        switch key.Kty {
+        case "RSA":
+            n, errN := base64.RawURLEncoding.DecodeString(key.N)
+            e, errE := base64.RawURLEncoding.DecodeString(key.E)
+            if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+                return fmt.Errorf("jwks %s: invalid RSA key %q", file, key.Kid)
+            }
+            v.rsaKeys[key.Kid] = &rsa.PublicKey{
+                N: new(big.Int).SetBytes(n),
+                E: int(new(big.Int).SetBytes(e).Int64()),
+            }
+        case "oct":
+            k, err := base64.RawURLEncoding.DecodeString(key.K)
+            if err != nil || len(k) == 0 {
+                return fmt.Errorf("jwks %s: invalid oct key %q", file, key.Kid)
+            }
+            v.hmacKeys[key.Kid] = k
+        default:
+            return fmt.Errorf("jwks %s: unsupported key type %q", file, key.Kty)
+        }
+    }
+    if len(v.rsaKeys)+len(v.hmacKeys) == 0 {
+        return fmt.Errorf("jwks %s: no signing keys", file)
+    }
+    return nil
+}
+
+func (v *JWTVerifier) Authenticate(r *http.Request) (*Principal, error) {
+    token := bearerToken(r)
+    if token == "" || !looksLikeJWT(token) {
+        return nil, ErrNoCredentials
+    }
+
+    claims := jwt.MapClaims{}
+    if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+    }
+    subject, err := claims.GetSubject()
+    if err != nil || subject == "" {
+        return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+    }
+    return &Principal{
+        Subject: subject,
+        Method:  MethodJWT,
+        Roles:   rolesFromClaim(claims[v.rolesClaim]),
+        Claims:  claims,
+    }, nil
+}
+
+// key elige la clave de verificación según el algoritmo y el "kid" del token. Una clave RSA
+// nunca se usa como secreto HMAC, lo que evita la confusión de algoritmos.
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+    kid, _ := token.Header["kid"].(string)
+    switch token.Method.Alg() {
+    case "HS256":
+        if key, ok := v.hmacKeys[kid]; ok {
+            return key, nil
+        }
+        if key, ok := v.hmacKeys[""]; ok {
+            return key, nil
+        }
+    case "RS256":
+        if key, ok := v.rsaKeys[kid]; ok {
+            return key, nil
+        }
+        if kid == "" && len(v.rsaKeys) == 1 {
+            for _, key := range v.rsaKeys {
+                return key, nil
+            }
+        }
+    }
+    return nil, fmt.Errorf("no key for alg %s and kid %q", token.Method.Alg(), kid)
+}
+
+// rolesFromClaim acepta una lista de roles o una cadena separada por espacios (como "scope").
+func rolesFromClaim(claim interface{}) []string {
+    switch v := claim.(type) {
+    case string:
+        return strings.Fields(v)
+    case []interface{}:
+        roles := make([]string, 0, len(v))
+        for _, item := range v {
+            if s, ok := item.(string); ok {
+                roles = append(roles, s)
+            }
+        }
+        return roles
+    }
+    return nil
+}
@@ -0,0 +1,120 @@
+package cache
+
+//Caché LRU en memoria con caducidad (TTL) y límite de tamaño en bytes. Se usa para guardar
+//respuestas de ZincSearch ya serializadas; cuando se supera el límite se descartan primero
+//las entradas usadas hace más tiempo.
+import (
+    "container/list"
+    "sync"
+    "time"
+)
+
+type Cache struct {
+    mu       sync.Mutex
+    maxBytes int64
+    ttl      time.Duration
+    ll       *list.List
+    items    map[string]*list.Element
+    bytes    int64
+
+    hits      uint64
+    misses    uint64
+    evictions uint64
+}
+
+type entry struct {
+    key       string
+    value     []byte
+    expiresAt time.Time
+}
+
+// Stats resume el uso de la caché.
+type Stats struct {
+    Hits      uint64 `json:"hits"`
+    Misses    uint64 `json:"misses"`
+    Evictions uint64 `json:"evictions"`
+    Entries   int    `json:"entries"`
+    Bytes     int64  `json:"bytes"`
+    MaxBytes  int64  `json:"max_bytes"`
+}
+
+func New(maxBytes int64, ttl time.Duration) *Cache {
+    return &Cache{
+        maxBytes: maxBytes,
+        ttl:      ttl,
+        ll:       list.New(),
+        items:    make(map[string]*list.Element),
+    }
+}
+
+// Get devuelve el valor guardado para key si existe y no ha caducado.
+func (c *Cache) Get(key string) ([]byte, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if el, ok := c.items[key]; ok {
+        e := el.Value.(*entry)
+        if time.Now().Before(e.expiresAt) {
+            c.ll.MoveToFront(el)
+            c.hits++
+            return e.value, true
+        }
+        c.removeElement(el)
+    }
+    c.misses++
+    return nil, false
+}
+
+// Set guarda value bajo key. Los valores más grandes que la caché completa no se guardan.
+func (c *Cache) Set(key string, value []byte) {
+    size := int64(len(key) + len(value))
+    if size > c.maxBytes {
+        return
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if el, ok := c.items[key]; ok {
+        c.removeElement(el)
+    }
+    el := c.ll.PushFront(&entry{key: key, value: value, expiresAt: time.Now().Add(c.ttl)})
+    c.items[key] = el
+    c.bytes += size
+
+    for c.bytes > c.maxBytes {
+        c.removeElement(c.ll.Back())
+        c.evictions++
+    }
+}
+
+// Purge vacía la caché (por ejemplo, cuando cambia la versión del índice).
+func (c *Cache) Purge() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.ll.Init()
+    c.items = make(map[string]*list.Element)
+    c.bytes = 0
+}
+
+func (c *Cache) Stats() Stats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    return Stats{
+        Hits:      c.hits,
+        Misses:    c.misses,
+        Evictions: c.evictions,
+        Entries:   c.ll.Len(),
+        Bytes:     c.bytes,
+        MaxBytes:  c.maxBytes,
+    }
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+    e := el.Value.(*entry)
+    c.ll.Remove(el)
+    delete(c.items, e.key)
+    c.bytes -= int64(len(e.key) + len(e.value))
+}
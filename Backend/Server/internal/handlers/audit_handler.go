@@ -0,0 +1,72 @@
+package handlers
+
+//Consulta del registro de auditoría para administradores (GET /api/admin/audit). Filtra por
+//principal, acción, request ID, ID de correo y rango de fechas, y devuelve los eventos más
+//recientes primero.
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "server/internal/audit"
+)
+
+const (
+    defaultAuditLimit = 100
+    maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+    log *audit.Log
+}
+
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+    return &AuditHandler{log: log}
+}
+
+func (h *AuditHandler) Handle(w http.ResponseWriter, r *http.Request) {
+    if h.log == nil {
+        writeError(w, r, http.StatusNotFound, "Audit log is disabled")
+        return
+    }
+
+    q := r.URL.Query()
+    filter := audit.Filter{
+        Principal:  q.Get("principal"),
+        Action:     q.Get("action"),
+        RequestID:  q.Get("request_id"),
+        DocumentID: q.Get("document_id"),
+        Limit:      defaultAuditLimit,
+    }
+    for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+        if value := q.Get(name); value != "" {
+            t, err := time.Parse(time.RFC3339, value)
+            if err != nil {
+                writeError(w, r, http.StatusBadRequest, "Invalid "+name+": use RFC 3339 (2001-05-14T00:00:00Z)")
+                return
+            }
+            *target = t
+        }
+    }
+    if value := q.Get("limit"); value != "" {
+        limit, err := strconv.Atoi(value)
+        if err != nil || limit < 1 || limit > maxAuditLimit {
+            writeError(w, r, http.StatusBadRequest, "Invalid limit: must be between 1 and "+strconv.Itoa(maxAuditLimit))
+            return
+        }
+        filter.Limit = limit
+    }
+
+    events, err := h.log.Search(filter)
+    if err != nil {
+        writeServiceError(w, r, err)
+        return
+    }
+    if events == nil {
+        events = []audit.Event{}
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "count":  len(events),
+        "events": events,
+    })
+}
@@ -0,0 +1,54 @@
+package handlers
+
+//Expone las estadísticas de la caché de búsquedas y recibe del indexador la versión del
+//índice. Cuando la versión cambia, el servicio de búsqueda invalida la caché.
+import (
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "strings"
+
+    "server/internal/services"
+)
+
+type CacheHandler struct {
+    searchService *services.SearchService
+}
+
+func NewCacheHandler(searchService *services.SearchService) *CacheHandler {
+    return &CacheHandler{searchService: searchService}
+}
+
+type indexVersionRequest struct {
+    Version string `json:"version"`
+}
+
+// HandleStats responde con los aciertos, fallos y ocupación de la caché.
+func (h *CacheHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+    stats, enabled := h.searchService.CacheStats()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "enabled":       enabled,
+        "index_version": h.searchService.IndexVersion(),
+        "stats":         stats,
+    })
+}
+
+// HandleIndexVersion recibe {"version": "..."} del indexador al terminar una indexación.
+func (h *CacheHandler) HandleIndexVersion(w http.ResponseWriter, r *http.Request) {
+    var req indexVersionRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Version) == "" {
+        writeError(w, r, http.StatusBadRequest, "Invalid request payload")
+        return
+    }
+
+    invalidated := h.searchService.SetIndexVersion(strings.TrimSpace(req.Version))
+    slog.InfoContext(r.Context(), "index version reported", "index_version", req.Version, "cache_invalidated", invalidated)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "index_version": h.searchService.IndexVersion(),
+        "invalidated":   invalidated,
+    })
+}
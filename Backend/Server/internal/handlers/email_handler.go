@@ -0,0 +1,37 @@
+package handlers
+
+//Devuelve un correo por su ID (GET /api/emails/{id}). El servicio de búsqueda comprueba que el
+//correo esté dentro del alcance del usuario; si no lo está, responde 404 como si no existiera.
+import (
+    "encoding/json"
+    "net/http"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/internal/services"
+)
+
+type EmailHandler struct {
+    searchService *services.SearchService
+}
+
+func NewEmailHandler(searchService *services.SearchService) *EmailHandler {
+    return &EmailHandler{searchService: searchService}
+}
+
+func (h *EmailHandler) Handle(w http.ResponseWriter, r *http.Request) {
+    id := chi.URLParam(r, "id")
+    if id == "" {
+        writeError(w, r, http.StatusBadRequest, "Missing email id")
+        return
+    }
+
+    hit, err := h.searchService.GetEmail(r.Context(), id)
+    if err != nil {
+        writeServiceError(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(hit)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+//Traduce los errores de la capa de servicios a respuestas HTTP y define el formato común de
+//los errores de la API:
+//
+//    {"error": {"status": 400, "message": "Invalid request payload", "request_id": "..."}}
+//
+//El request ID permite relacionar la respuesta con las líneas de log de la solicitud.
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "net/http"
+    "strconv"
+
+    "server/internal/acl"
+    "server/internal/logging"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+// ErrorBody es el contenido del envoltorio de error.
+type ErrorBody struct {
+    Status    int    `json:"status"`
+    Message   string `json:"message"`
+    RequestID string `json:"request_id,omitempty"`
+}
+
+type errorEnvelope struct {
+    Error ErrorBody `json:"error"`
+}
+
+// writeError responde con el envoltorio de error estándar.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(errorEnvelope{Error: ErrorBody{
+        Status:    status,
+        Message:   message,
+        RequestID: logging.RequestID(r.Context()),
+    }})
+}
+
+// WriteError permite a los middlewares (autenticación, límites) responder con el mismo formato.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+    writeError(w, r, status, message)
+}
+
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+    var circuitErr *zinc.CircuitOpenError
+    switch {
+    case r.Context().Err() != nil:
+        // El cliente canceló la solicitud o se desconectó: no hay a quién responder.
+        slog.InfoContext(r.Context(), "request cancelled by client", "error", err)
+        return
+    case errors.Is(err, acl.ErrNoAccess):
+        writeError(w, r, http.StatusForbidden, "No mailboxes are assigned to this user")
+    case errors.Is(err, services.ErrNotFound):
+        writeError(w, r, http.StatusNotFound, "Not found")
+    case errors.Is(err, services.ErrInvalidSearch), errors.Is(err, services.ErrInvalidFolderQuery):
+        writeError(w, r, http.StatusBadRequest, err.Error())
+    case errors.As(err, &circuitErr):
+        // ZincSearch no está sano: se indica al cliente cuándo volver a intentarlo.
+        retryAfter := int(circuitErr.RetryAfter.Seconds() + 0.999)
+        if retryAfter < 1 {
+            retryAfter = 1
+        }
+        slog.WarnContext(r.Context(), "zinc circuit breaker open", "retry_after", retryAfter)
+        w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+        writeError(w, r, http.StatusServiceUnavailable, "Service unavailable")
+    case errors.Is(err, context.DeadlineExceeded):
+        slog.WarnContext(r.Context(), "zinc request timed out", "error", err)
+        writeError(w, r, http.StatusGatewayTimeout, "Gateway timeout")
+    default:
+        slog.ErrorContext(r.Context(), "service error", "error", err)
+        writeError(w, r, http.StatusInternalServerError, "Internal server error")
+    }
+}
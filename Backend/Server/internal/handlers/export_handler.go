@@ -0,0 +1,109 @@
+package handlers
+
+//Gestiona las solicitudes de exportación. Acepta los parámetros por query string (GET) o como
+//JSON (POST), valida el formato y las columnas, y transmite los resultados al cliente a medida
+//que el servicio los va obteniendo de ZincSearch.
+import (
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "server/internal/models"
+    "server/internal/services"
+)
+
+type ExportHandler struct {
+    exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+    return &ExportHandler{exportService: exportService}
+}
+
+func (h *ExportHandler) Handle(w http.ResponseWriter, r *http.Request) {
+    var req models.ExportRequest
+    if r.Method == http.MethodPost {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            writeError(w, r, http.StatusBadRequest, "Invalid request payload")
+            return
+        }
+    } else {
+        query := r.URL.Query()
+        req.Term = query.Get("term")
+        req.Field = query.Get("field")
+        req.Custodian = query.Get("custodian")
+        req.FolderPath = query.Get("folder_path")
+        req.Format = query.Get("format")
+        if columns := query.Get("columns"); columns != "" {
+            req.Columns = strings.Split(columns, ",")
+        }
+    }
+
+    if err := h.exportService.Validate(&req); err != nil {
+        writeError(w, r, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    ew := &exportResponseWriter{
+        w:            w,
+        rc:           http.NewResponseController(w),
+        contentType:  h.exportService.ContentType(req.Format),
+        fileName:     h.exportService.FileName(req.Format),
+        writeTimeout: h.exportService.WriteTimeout(),
+    }
+    ew.extendDeadline()
+    err := h.exportService.Export(r.Context(), ew, req)
+    if err == nil {
+        return
+    }
+    if !ew.started {
+        writeServiceError(w, r, err)
+        return
+    }
+    // Ya se enviaron datos: solo se puede cortar la respuesta y dejar constancia.
+    slog.ErrorContext(r.Context(), "export aborted after streaming started", "format", req.Format, "error", err)
+}
+
+// exportResponseWriter retrasa el envío de las cabeceras hasta la primera escritura, de forma
+// que un fallo antes de tener datos todavía pueda responderse con un código de error. Después
+// de cada escritura vacía la respuesta para que el cliente reciba los datos en streaming.
+type exportResponseWriter struct {
+    w            http.ResponseWriter
+    rc           *http.ResponseController
+    contentType  string
+    fileName     string
+    writeTimeout time.Duration
+    started      bool
+}
+
+func (e *exportResponseWriter) Write(p []byte) (int, error) {
+    if !e.started {
+        e.started = true
+        e.w.Header().Set("Content-Type", e.contentType)
+        e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.fileName))
+        e.w.Header().Set("X-Content-Type-Options", "nosniff")
+        e.w.WriteHeader(http.StatusOK)
+    }
+    return e.w.Write(p)
+}
+
+// Flush envía al cliente lo escrito hasta ahora; el servicio lo llama al terminar cada página.
+// También renueva el plazo de escritura para la página siguiente.
+func (e *exportResponseWriter) Flush() {
+    if !e.started {
+        return
+    }
+    e.rc.Flush()
+    e.extendDeadline()
+}
+
+// extendDeadline renueva el plazo de escritura de la conexión. Si el ResponseWriter no lo
+// soporta (por ejemplo, en tests) se ignora.
+func (e *exportResponseWriter) extendDeadline() {
+    if e.writeTimeout > 0 {
+        e.rc.SetWriteDeadline(time.Now().Add(e.writeTimeout))
+    }
+}
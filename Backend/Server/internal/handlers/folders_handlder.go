@@ -3,6 +3,8 @@ package handlers
 import (
     "encoding/json"
     "net/http"
+    "strconv"
+    "strings"
 
     "server/internal/services"
 )
@@ -15,11 +17,48 @@ func NewFoldersHandler(folderService *services.FolderService) *FoldersHandler {
     return &FoldersHandler{folderService: folderService}
 }
 
-// Handle gestiona la solicitud GET y responde con la estructura de folders.
+// Handle gestiona la solicitud GET y responde con el árbol de carpetas. Los parámetros opcionales
+// root (ruta de la carpeta, por ejemplo "allen-p/inbox") y depth (niveles por debajo de root)
+// permiten pedir subárboles a medida que el cliente los despliega.
 func (h *FoldersHandler) Handle(w http.ResponseWriter, r *http.Request) {
-    folders := h.folderService.GetFolders()
+    depth := 0
+    if value := r.URL.Query().Get("depth"); value != "" {
+        var err error
+        if depth, err = strconv.Atoi(value); err != nil || depth < 0 {
+            writeError(w, r, http.StatusBadRequest, "Invalid depth parameter")
+            return
+        }
+    }
+
+    folders, err := h.folderService.GetFolders(r.Context(), r.URL.Query().Get("root"), depth)
+    if err != nil {
+        writeServiceError(w, r, err)
+        return
+    }
+
+    // El árbol depende del usuario (su alcance), así que solo lo puede guardar el navegador y
+    // debe revalidarlo; si no ha cambiado se responde 304 sin cuerpo.
+    w.Header().Set("ETag", folders.ETag)
+    w.Header().Set("Last-Modified", folders.RefreshedAt.UTC().Format(http.TimeFormat))
+    w.Header().Set("Cache-Control", "private, no-cache")
+    if etagMatches(r.Header.Get("If-None-Match"), folders.ETag) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+
     w.Header().Set("Content-Type", "application/json")
-    if err := json.NewEncoder(w).Encode(folders); err != nil {
-        http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+    if err := json.NewEncoder(w).Encode(folders.Root); err != nil {
+        writeError(w, r, http.StatusInternalServerError, "Error encoding JSON")
+    }
+}
+
+// etagMatches indica si la cabecera If-None-Match incluye etag (comparación débil, RFC 9110).
+func etagMatches(header, etag string) bool {
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+            return true
+        }
     }
+    return false
 }
\ No newline at end of file
@@ -0,0 +1,57 @@
+package handlers
+
+//Expone el estado del servidor y de sus dependencias: liveness (el proceso responde),
+//readiness (ZincSearch, el índice y la carpeta de correos están disponibles) y el estado del
+//circuit breaker del cliente de ZincSearch.
+import (
+    "encoding/json"
+    "net/http"
+
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+type HealthHandler struct {
+    zincClient    *zinc.Client
+    healthService *services.HealthService
+}
+
+func NewHealthHandler(zincClient *zinc.Client, healthService *services.HealthService) *HealthHandler {
+    return &HealthHandler{zincClient: zincClient, healthService: healthService}
+}
+
+// HandleLiveness responde 200 mientras el proceso pueda atender solicitudes.
+func (h *HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleReadiness ejecuta las comprobaciones de disponibilidad y responde 503 si alguna falla.
+func (h *HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+    readiness := h.healthService.Readiness(r.Context())
+
+    status := http.StatusOK
+    if !readiness.Ready {
+        status = http.StatusServiceUnavailable
+    }
+    writeJSON(w, status, readiness)
+}
+
+// HandleZinc responde con el estado del circuit breaker. Devuelve 503 mientras el circuito no
+// está cerrado para que un balanceador pueda usarlo directamente.
+func (h *HealthHandler) HandleZinc(w http.ResponseWriter, r *http.Request) {
+    status := h.zincClient.Breaker().Status()
+
+    code := http.StatusOK
+    if status.State != zinc.StateClosed {
+        code = http.StatusServiceUnavailable
+    }
+    writeJSON(w, code, map[string]interface{}{
+        "breaker": status,
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
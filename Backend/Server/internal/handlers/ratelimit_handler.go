@@ -0,0 +1,59 @@
+package handlers
+
+//Consulta y cambio en caliente de los límites de solicitudes (GET y PUT
+///api/admin/ratelimits). El cuerpo del PUT indica solo las clases que cambian:
+//
+//    {"export": {"rate": 0.05, "burst": 1}}
+import (
+    "encoding/json"
+    "log/slog"
+    "net/http"
+
+    "server/internal/ratelimit"
+)
+
+type RateLimitHandler struct {
+    limiter *ratelimit.Limiter
+}
+
+func NewRateLimitHandler(limiter *ratelimit.Limiter) *RateLimitHandler {
+    return &RateLimitHandler{limiter: limiter}
+}
+
+func (h *RateLimitHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+    if h.limiter == nil {
+        writeError(w, r, http.StatusNotFound, "Rate limiting is disabled")
+        return
+    }
+    writeJSON(w, http.StatusOK, h.limiter.Budgets())
+}
+
+func (h *RateLimitHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+    if h.limiter == nil {
+        writeError(w, r, http.StatusNotFound, "Rate limiting is disabled")
+        return
+    }
+
+    var budgets map[string]ratelimit.Budget
+    if err := json.NewDecoder(r.Body).Decode(&budgets); err != nil || len(budgets) == 0 {
+        writeError(w, r, http.StatusBadRequest, "Invalid request payload")
+        return
+    }
+    // Se valida todo antes de aplicar nada, para no dejar cambios a medias.
+    current := h.limiter.Budgets()
+    for name, budget := range budgets {
+        if _, ok := current[name]; !ok {
+            writeError(w, r, http.StatusBadRequest, "Unknown rate limit class: "+name)
+            return
+        }
+        if err := budget.Validate(); err != nil {
+            writeError(w, r, http.StatusBadRequest, name+": "+err.Error())
+            return
+        }
+    }
+    for name, budget := range budgets {
+        h.limiter.SetBudget(name, budget)
+        slog.InfoContext(r.Context(), "rate limit updated", "class", name, "rate", budget.Rate, "burst", budget.Burst)
+    }
+    writeJSON(w, http.StatusOK, h.limiter.Budgets())
+}
@@ -22,13 +22,13 @@ func NewSearchHandler(searchService *services.SearchService) *SearchHandler {
 func (h *SearchHandler) Handle(w http.ResponseWriter, r *http.Request) {
     var req models.SearchRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request payload", http.StatusBadRequest)
+        writeError(w, r, http.StatusBadRequest, "Invalid request payload")
         return
     }
 
-    result, err := h.searchService.Search(req)
+    result, err := h.searchService.Search(r.Context(), req)
     if err != nil {
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServiceError(w, r, err)
         return
     }
 
@@ -0,0 +1,57 @@
+package handlers
+
+//Responde con la información de compilación del servidor. La versión, el commit y la fecha se
+//inyectan con -ldflags al compilar; lo que falte se completa con debug.ReadBuildInfo.
+import (
+    "net/http"
+    "runtime"
+    "runtime/debug"
+)
+
+// BuildInfo describe el binario en ejecución.
+type BuildInfo struct {
+    Version   string `json:"version"`
+    Commit    string `json:"commit"`
+    BuildDate string `json:"build_date"`
+    Modified  bool   `json:"modified,omitempty"`
+    GoVersion string `json:"go_version"`
+    Module    string `json:"module,omitempty"`
+}
+
+type VersionHandler struct {
+    info BuildInfo
+}
+
+// NewVersionHandler combina los valores recibidos por ldflags con los metadatos que Go guarda
+// en el binario (revisión y fecha del commit de VCS) cuando los primeros no se indicaron.
+func NewVersionHandler(info BuildInfo) *VersionHandler {
+    info.GoVersion = runtime.Version()
+    if buildInfo, ok := debug.ReadBuildInfo(); ok {
+        info.Module = buildInfo.Main.Path
+        if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+            info.Version = buildInfo.Main.Version
+        }
+        for _, setting := range buildInfo.Settings {
+            switch setting.Key {
+            case "vcs.revision":
+                if info.Commit == "" {
+                    info.Commit = setting.Value
+                }
+            case "vcs.time":
+                if info.BuildDate == "" {
+                    info.BuildDate = setting.Value
+                }
+            case "vcs.modified":
+                info.Modified = setting.Value == "true"
+            }
+        }
+    }
+    if info.Version == "" {
+        info.Version = "dev"
+    }
+    return &VersionHandler{info: info}
+}
+
+func (h *VersionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, h.info)
+}
@@ -0,0 +1,155 @@
+package logging
+
+//Configura el logger estructurado (log/slog) del servidor. Todas las líneas salen en JSON (o
+//texto para desarrollo) con nivel, y las que se emiten con un contexto incluyen el request ID
+//y el trace ID de la solicitud. También define la política de redacción que se aplica a los
+//términos de búsqueda y a los cuerpos antes de escribirlos en el log.
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "log/slog"
+    "strings"
+    "sync/atomic"
+    "unicode/utf8"
+
+    "go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// Modos de redacción soportados.
+const (
+    RedactNone     = "none"     // se registra el valor completo
+    RedactTruncate = "truncate" // se registran los primeros MaxLen caracteres
+    RedactHash     = "hash"     // se registra un HMAC corto, útil para agrupar búsquedas iguales
+    RedactFull     = "redact"   // solo se registra la longitud
+)
+
+// Policy decide cómo aparecen en el log los datos sensibles (términos y cuerpos de correo).
+// HashKey es la clave del HMAC del modo hash: sin clave, un hash sin sal de un término corto se
+// revierte probando candidatos. Si está vacía se usa una clave aleatoria del proceso, y los
+// valores solo se pueden agrupar dentro de una misma ejecución.
+type Policy struct {
+    Mode    string
+    MaxLen  int
+    HashKey []byte
+}
+
+// policy se lee en cada línea de log desde cualquier goroutine y Setup la puede reemplazar.
+var policy atomic.Pointer[Policy]
+
+// processHashKey es la clave del modo hash cuando no se configura ninguna.
+var processHashKey = newHashKey()
+
+func init() {
+    policy.Store(&Policy{Mode: RedactTruncate, MaxLen: 32, HashKey: processHashKey})
+}
+
+func newHashKey() []byte {
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        panic("logging: cannot generate the redaction hash key: " + err.Error())
+    }
+    return key
+}
+
+// Setup crea el logger con el formato ("json" o "text") y nivel indicados, lo instala como
+// logger por defecto (también para el paquete log) y fija la política de redacción.
+func Setup(w io.Writer, format, level string, redaction Policy) *slog.Logger {
+    opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+    var handler slog.Handler
+    if format == "text" {
+        handler = slog.NewTextHandler(w, opts)
+    } else {
+        handler = slog.NewJSONHandler(w, opts)
+    }
+
+    if len(redaction.HashKey) == 0 {
+        redaction.HashKey = processHashKey
+    }
+    policy.Store(&redaction)
+    logger := slog.New(&contextHandler{Handler: handler})
+    slog.SetDefault(logger)
+    return logger
+}
+
+// ParseLevel acepta debug, info, warn y error; cualquier otro valor equivale a info.
+func ParseLevel(level string) slog.Level {
+    switch strings.ToLower(level) {
+    case "debug":
+        return slog.LevelDebug
+    case "warn", "warning":
+        return slog.LevelWarn
+    case "error":
+        return slog.LevelError
+    }
+    return slog.LevelInfo
+}
+
+// WithRequestID guarda el request ID en el contexto.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+    return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// RequestID devuelve el request ID del contexto, o "" si no hay.
+func RequestID(ctx context.Context) string {
+    requestID, _ := ctx.Value(contextKey{}).(string)
+    return requestID
+}
+
+// Redact aplica la política de redacción a un valor sensible.
+func Redact(value string) slog.Value {
+    p := policy.Load()
+    switch p.Mode {
+    case RedactNone:
+        return slog.StringValue(value)
+    case RedactHash:
+        mac := hmac.New(sha256.New, p.HashKey)
+        mac.Write([]byte(value))
+        return slog.StringValue("hmac:" + hex.EncodeToString(mac.Sum(nil)[:8]))
+    case RedactFull:
+        return slog.GroupValue(slog.Int("redacted_len", len(value)))
+    }
+    return slog.StringValue(truncate(value, p.MaxLen))
+}
+
+// Sensitive construye un atributo redactado, para usar como slog.Attr en una llamada de log.
+func Sensitive(key, value string) slog.Attr {
+    return slog.Attr{Key: key, Value: Redact(value)}
+}
+
+func truncate(value string, maxLen int) string {
+    if maxLen <= 0 || utf8.RuneCountInString(value) <= maxLen {
+        return value
+    }
+    runes := []rune(value)
+    return string(runes[:maxLen]) + "…"
+}
+
+// contextHandler añade a cada registro el request ID y el trace ID del contexto, si existen.
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+    if requestID := RequestID(ctx); requestID != "" {
+        record.AddAttrs(slog.String("request_id", requestID))
+    }
+    if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+        record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+    }
+    return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+    return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
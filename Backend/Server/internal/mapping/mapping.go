@@ -0,0 +1,158 @@
+package mapping
+
+//Mapping versionado del índice de correos (Backend/Mapping/emails.json). El indexador lo usa
+//para crear el índice y añadirle campos; el servidor lo lee al arrancar para comprobar que el
+//índice de ZincSearch tiene los campos y tipos que esperan las búsquedas, los filtros y el
+//árbol de carpetas. El indexador no tiene módulo propio y no puede importar este paquete, así
+//que Backend/Indexer/indexer.go tiene una copia (indexMapping, loadMapping, diffMapping); un
+//cambio aquí debe hacerse también allí. Los tests de ambos lados comprueban que leen el
+//archivo igual.
+//
+//Formato del archivo:
+//
+//    {
+//      "version": 1,
+//      "settings": {"analysis": {"analyzer": {"email_text": {"type": "standard"}}}},
+//      "mappings": {"properties": {
+//        "custodian": {"type": "keyword", "index": true, "aggregatable": true},
+//        "body": {"type": "text", "index": true, "store": true, "analyzer": "email_text"}
+//      }}
+//    }
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Types son los tipos de campo que admite ZincSearch.
+var Types = []string{"text", "keyword", "date", "numeric", "bool"}
+
+// Property es la definición de un campo. Index lo hace buscable; Store guarda su valor en el
+// índice (necesario para resaltarlo); el resto de banderas activan ordenación, agregaciones y
+// resaltado.
+type Property struct {
+    Type           string `json:"type"`
+    Index          bool   `json:"index"`
+    Store          bool   `json:"store"`
+    Sortable       bool   `json:"sortable"`
+    Aggregatable   bool   `json:"aggregatable"`
+    Highlightable  bool   `json:"highlightable"`
+    Analyzer       string `json:"analyzer,omitempty"`
+    SearchAnalyzer string `json:"search_analyzer,omitempty"`
+    Format         string `json:"format,omitempty"`
+}
+
+// Mapping es el contenido del archivo.
+type Mapping struct {
+    Version  int             `json:"version"`
+    Settings json.RawMessage `json:"settings,omitempty"`
+    Mappings struct {
+        Properties map[string]Property `json:"properties"`
+    } `json:"mappings"`
+}
+
+// Load lee y valida el archivo de mapping.
+func Load(file string) (*Mapping, error) {
+    content, err := os.ReadFile(file)
+    if err != nil {
+        return nil, fmt.Errorf("mapping: %w", err)
+    }
+    var m Mapping
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&m); err != nil {
+        return nil, fmt.Errorf("mapping %s: %w", file, err)
+    }
+
+    var errs []error
+    if m.Version < 1 {
+        errs = append(errs, fmt.Errorf("mapping %s: version must be a positive integer", file))
+    }
+    if len(m.Mappings.Properties) == 0 {
+        errs = append(errs, fmt.Errorf("mapping %s: no fields declared", file))
+    }
+    for _, field := range m.Fields() {
+        if !isType(m.Mappings.Properties[field].Type) {
+            errs = append(errs, fmt.Errorf("mapping %s: field %q has unknown type %q", file, field, m.Mappings.Properties[field].Type))
+        }
+    }
+    if err := errors.Join(errs...); err != nil {
+        return nil, err
+    }
+    return &m, nil
+}
+
+// Fields devuelve los nombres de los campos ordenados.
+func (m *Mapping) Fields() []string {
+    fields := make([]string, 0, len(m.Mappings.Properties))
+    for field := range m.Mappings.Properties {
+        fields = append(fields, field)
+    }
+    sort.Strings(fields)
+    return fields
+}
+
+// Diff es la comparación entre el mapping del archivo y el de un índice. Missing son los campos
+// que el índice no tiene; Conflicts, los que tienen otro tipo; Differences, otras diferencias
+// de un campo (analizador, formato, banderas). Ni el tipo ni el resto de atributos de un campo
+// existente se pueden cambiar sin recrear el índice.
+type Diff struct {
+    Missing     []string `json:"missing,omitempty"`
+    Conflicts   []string `json:"conflicts,omitempty"`
+    Differences []string `json:"differences,omitempty"`
+}
+
+// Compatible indica que el índice tiene todos los campos con el tipo esperado.
+func (d Diff) Compatible() bool {
+    return len(d.Missing) == 0 && len(d.Conflicts) == 0
+}
+
+// Compare compara el mapping con las propiedades de un índice.
+func (m *Mapping) Compare(live map[string]Property) Diff {
+    var diff Diff
+    for _, field := range m.Fields() {
+        expected := m.Mappings.Properties[field]
+        actual, ok := live[field]
+        switch {
+        case !ok:
+            diff.Missing = append(diff.Missing, field)
+        case actual.Type != expected.Type:
+            diff.Conflicts = append(diff.Conflicts, fmt.Sprintf("%s: type %q, expected %q", field, actual.Type, expected.Type))
+        case actual != expected:
+            diff.Differences = append(diff.Differences, field+": "+strings.Join(changes(actual, expected), ", "))
+        }
+    }
+    return diff
+}
+
+func changes(actual, expected Property) []string {
+    var changes []string
+    compare := func(name string, actual, expected any) {
+        if actual != expected {
+            changes = append(changes, fmt.Sprintf("%s %v (expected %v)", name, actual, expected))
+        }
+    }
+    compare("index", actual.Index, expected.Index)
+    compare("store", actual.Store, expected.Store)
+    compare("sortable", actual.Sortable, expected.Sortable)
+    compare("aggregatable", actual.Aggregatable, expected.Aggregatable)
+    compare("highlightable", actual.Highlightable, expected.Highlightable)
+    compare("analyzer", strconv.Quote(actual.Analyzer), strconv.Quote(expected.Analyzer))
+    compare("search_analyzer", strconv.Quote(actual.SearchAnalyzer), strconv.Quote(expected.SearchAnalyzer))
+    compare("format", strconv.Quote(actual.Format), strconv.Quote(expected.Format))
+    return changes
+}
+
+func isType(t string) bool {
+    for _, known := range Types {
+        if t == known {
+            return true
+        }
+    }
+    return false
+}
\ No newline at end of file
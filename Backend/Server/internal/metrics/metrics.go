@@ -0,0 +1,177 @@
+package metrics
+
+//Define las métricas Prometheus del servidor y el registro en el que se publican. Las métricas
+//HTTP las alimenta el middleware del router; las de ZincSearch, el cliente de Zinc; y las de
+//búsqueda y carpetas, los servicios correspondientes. El endpoint /metrics sirve este registro.
+import (
+    "net/http"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+
+    "server/internal/cache"
+)
+
+const namespace = "emailsearch"
+
+// Registry contiene todas las métricas del servidor, incluidas las del runtime de Go y del proceso.
+var Registry = prometheus.NewRegistry()
+
+var (
+    HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "http_requests_total",
+        Help:      "HTTP requests handled, by route pattern, method and status code.",
+    }, []string{"route", "method", "status"})
+
+    HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "http_request_duration_seconds",
+        Help:      "HTTP request latency, by route pattern, method and status code.",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"route", "method", "status"})
+
+    HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "http_requests_in_flight",
+        Help:      "HTTP requests currently being served.",
+    })
+
+    ZincDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "zinc_request_duration_seconds",
+        Help:      "Latency of each call (attempt) to ZincSearch, by operation and result.",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"operation", "result"})
+
+    ZincErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "zinc_errors_total",
+        Help:      "Failed calls to ZincSearch, by operation and reason.",
+    }, []string{"operation", "reason"})
+
+    ZincRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "zinc_retries_total",
+        Help:      "Retried calls to ZincSearch, by operation.",
+    }, []string{"operation"})
+
+    SearchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "search_duration_seconds",
+        Help:      "Time spent by SearchService, by kind (search or export page) and source (cache or zinc).",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"kind", "source"})
+
+    FolderScanDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "folder_scan_duration_seconds",
+        Help:      "Time spent by FolderService building the folder list.",
+        Buckets:   prometheus.DefBuckets,
+    })
+
+    FolderCount = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "folders",
+        Help:      "Number of custodian folders returned by the last folder scan.",
+    })
+
+    FolderLastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "folders_last_refresh_timestamp_seconds",
+        Help:      "Unix time of the last successful read of the folder source.",
+    })
+
+    AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "auth_failures_total",
+        Help:      "Requests rejected by authentication, by reason (missing or invalid).",
+    }, []string{"reason"})
+
+    RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "rate_limited_total",
+        Help:      "Requests rejected with 429, by rate limit class.",
+    }, []string{"class"})
+
+    AuditEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "audit_events_total",
+        Help:      "Audit events recorded, by action and outcome.",
+    }, []string{"action", "outcome"})
+
+    AuditErrors = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "audit_write_errors_total",
+        Help:      "Audit events that could not be written to one of the sinks.",
+    })
+)
+
+func init() {
+    Registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        HTTPRequests,
+        HTTPDuration,
+        HTTPInFlight,
+        ZincDuration,
+        ZincErrors,
+        ZincRetries,
+        SearchDuration,
+        FolderScanDuration,
+        FolderCount,
+        FolderLastRefresh,
+        AuthFailures,
+        RateLimited,
+        AuditEvents,
+        AuditErrors,
+    )
+}
+
+// Handler sirve las métricas en el formato de exposición de Prometheus.
+func Handler() http.Handler {
+    return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterCache publica las estadísticas de una caché. stats se consulta en cada scrape; el
+// segundo valor que devuelve indica si la caché está activa.
+func RegisterCache(name string, stats func() (cache.Stats, bool)) {
+    Registry.MustRegister(&cacheCollector{name: name, stats: stats})
+}
+
+type cacheCollector struct {
+    name  string
+    stats func() (cache.Stats, bool)
+}
+
+var (
+    cacheHitsDesc      = prometheus.NewDesc(namespace+"_cache_hits_total", "Cache hits.", []string{"cache"}, nil)
+    cacheMissesDesc    = prometheus.NewDesc(namespace+"_cache_misses_total", "Cache misses.", []string{"cache"}, nil)
+    cacheEvictionsDesc = prometheus.NewDesc(namespace+"_cache_evictions_total", "Entries evicted to stay under the size limit.", []string{"cache"}, nil)
+    cacheEntriesDesc   = prometheus.NewDesc(namespace+"_cache_entries", "Entries currently cached.", []string{"cache"}, nil)
+    cacheBytesDesc     = prometheus.NewDesc(namespace+"_cache_bytes", "Bytes currently cached.", []string{"cache"}, nil)
+    cacheMaxBytesDesc  = prometheus.NewDesc(namespace+"_cache_max_bytes", "Configured cache size limit in bytes.", []string{"cache"}, nil)
+)
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- cacheHitsDesc
+    ch <- cacheMissesDesc
+    ch <- cacheEvictionsDesc
+    ch <- cacheEntriesDesc
+    ch <- cacheBytesDesc
+    ch <- cacheMaxBytesDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+    stats, enabled := c.stats()
+    if !enabled {
+        return
+    }
+    ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), c.name)
+    ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), c.name)
+    ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), c.name)
+    ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), c.name)
+    ch <- prometheus.MustNewConstMetric(cacheBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), c.name)
+    ch <- prometheus.MustNewConstMetric(cacheMaxBytesDesc, prometheus.GaugeValue, float64(stats.MaxBytes), c.name)
+}
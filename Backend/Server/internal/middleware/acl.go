@@ -0,0 +1,25 @@
+package middleware
+
+//Middleware de control de acceso. Calcula el alcance (custodios y carpetas visibles) del
+//principal autenticado y lo guarda en el contexto, donde lo aplican los servicios.
+import (
+    "log/slog"
+    "net/http"
+
+    "server/internal/acl"
+    "server/internal/auth"
+)
+
+// AccessControl aplica las reglas de policy. Con policy nil (ACL desactivada) no restringe nada.
+func AccessControl(policy *acl.Policy) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if policy == nil {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            scope := policy.ScopeFor(auth.FromContext(r.Context()))
+            slog.DebugContext(r.Context(), "access scope", "all", scope.All, "custodians", len(scope.Custodians), "folders", len(scope.Folders))
+            next.ServeHTTP(w, r.WithContext(acl.WithScope(r.Context(), scope)))
+        })
+    }
+}
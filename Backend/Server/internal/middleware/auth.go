@@ -0,0 +1,69 @@
+package middleware
+
+//Middleware de autenticación. Identifica al llamador con el Authenticator configurado, guarda
+//el Principal en el contexto y rechaza con 401 las solicitudes sin credenciales válidas.
+import (
+    "errors"
+    "log/slog"
+    "net/http"
+    "slices"
+
+    "server/internal/auth"
+    "server/internal/handlers"
+    "server/internal/metrics"
+)
+
+// Authenticate exige credenciales válidas. Con authenticator nil (autenticación desactivada)
+// deja pasar todas las solicitudes sin principal.
+func Authenticate(authenticator auth.Authenticator) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if authenticator == nil {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            // Los preflight CORS no llevan credenciales.
+            if r.Method == http.MethodOptions {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            principal, err := authenticator.Authenticate(r)
+            if err != nil {
+                reason, challenge := "missing", `Bearer realm="email-search"`
+                if !errors.Is(err, auth.ErrNoCredentials) {
+                    reason, challenge = "invalid", `Bearer realm="email-search", error="invalid_token"`
+                }
+                metrics.AuthFailures.WithLabelValues(reason).Inc()
+                slog.InfoContext(r.Context(), "authentication failed", "reason", reason, "error", err)
+                w.Header().Set("WWW-Authenticate", challenge)
+                handlers.WriteError(w, r, http.StatusUnauthorized, "Unauthorized")
+                return
+            }
+
+            slog.DebugContext(r.Context(), "authenticated", "principal", principal.Subject, "method", principal.Method)
+            next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+        })
+    }
+}
+
+// RequireRole limita las rutas a principales con alguno de los roles indicados y responde 403 al
+// resto. Con la autenticación desactivada (authenticator nil) nadie puede tener el rol, así que
+// las rutas responden 404 como si no existieran.
+func RequireRole(authenticator auth.Authenticator, roles ...string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if authenticator == nil {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                handlers.WriteError(w, r, http.StatusNotFound, "Not found")
+            })
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            principal := auth.FromContext(r.Context())
+            if principal == nil || !slices.ContainsFunc(roles, principal.HasRole) {
+                slog.InfoContext(r.Context(), "missing role", "roles", roles)
+                handlers.WriteError(w, r, http.StatusForbidden, "Forbidden")
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
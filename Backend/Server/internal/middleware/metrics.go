@@ -0,0 +1,39 @@
+package middleware
+
+//Middleware que alimenta las métricas HTTP: solicitudes en curso, y por cada solicitud su ruta
+//(el patrón de chi, no la URL concreta, para no disparar la cardinalidad), método, código de
+//respuesta y duración.
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    chiMiddleware "github.com/go-chi/chi/v5/middleware"
+
+    "server/internal/metrics"
+)
+
+func Metrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        metrics.HTTPInFlight.Inc()
+        defer metrics.HTTPInFlight.Dec()
+
+        ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+        next.ServeHTTP(ww, r)
+
+        route := "unmatched"
+        if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+            route = rctx.RoutePattern()
+        }
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+        labels := []string{route, r.Method, strconv.Itoa(status)}
+
+        metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+        metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+    })
+}
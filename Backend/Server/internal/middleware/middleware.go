@@ -1,20 +1,135 @@
 package middleware
 
-//Implementa funcionalidades de middleware, como EnableCors, que añade los encabezados 
-//necesarios para permitir solicitudes CORS. Esto es útil para que clientes alojados en 
-//otros dominios puedan acceder a la API sin problemas.
-import "net/http"
-
-func EnableCors(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-        if r.Method == "OPTIONS" {
-            w.WriteHeader(http.StatusOK)
-            return
+//Implementa el middleware CORS, que añade los encabezados necesarios para que clientes
+//alojados en otros dominios puedan acceder a la API. La política (orígenes, métodos,
+//encabezados, credenciales y max-age) viene de la configuración y puede ser distinta para
+//cada grupo de rutas, de modo que los endpoints de administración no queden abiertos a
+//cualquier origen.
+import (
+    "net/http"
+    "strconv"
+    "strings"
+
+    "server/config"
+)
+
+// CORSGroup asocia un prefijo de ruta con una política CORS.
+type CORSGroup struct {
+    Prefix string
+    Policy config.CORSPolicy
+}
+
+// CORS aplica a cada solicitud la política del grupo con el prefijo más largo que coincida con
+// su ruta. Las rutas que no pertenecen a ningún grupo no reciben encabezados CORS.
+//
+// Se instala antes del enrutado para poder responder los preflight (OPTIONS) de rutas que
+// solo declaran GET o POST.
+func CORS(groups ...CORSGroup) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            group := matchGroup(groups, r.URL.Path)
+            if group == nil || len(group.Policy.AllowedOrigins) == 0 {
+                next.ServeHTTP(w, r)
+                return
+            }
+            policy := &group.Policy
+
+            // La respuesta depende del Origin salvo que se permita cualquier origen sin
+            // credenciales; las cachés intermedias deben saberlo.
+            if !allowsAnyOrigin(policy) {
+                w.Header().Add("Vary", "Origin")
+            }
+
+            origin := r.Header.Get("Origin")
+            preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+            if origin == "" {
+                next.ServeHTTP(w, r)
+                return
+            }
+            if !originAllowed(policy, origin) {
+                if preflight {
+                    w.WriteHeader(http.StatusNoContent)
+                    return
+                }
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            if allowsAnyOrigin(policy) {
+                w.Header().Set("Access-Control-Allow-Origin", "*")
+            } else {
+                w.Header().Set("Access-Control-Allow-Origin", origin)
+            }
+            if policy.AllowCredentials {
+                w.Header().Set("Access-Control-Allow-Credentials", "true")
+            }
+
+            if preflight {
+                w.Header().Add("Vary", "Access-Control-Request-Method")
+                w.Header().Add("Vary", "Access-Control-Request-Headers")
+                if !contains(policy.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+                    w.WriteHeader(http.StatusNoContent)
+                    return
+                }
+                w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+                if len(policy.AllowedHeaders) > 0 {
+                    w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+                }
+                if policy.MaxAge > 0 {
+                    w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+                }
+                w.WriteHeader(http.StatusNoContent)
+                return
+            }
+
+            if len(policy.ExposedHeaders) > 0 {
+                w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func matchGroup(groups []CORSGroup, path string) *CORSGroup {
+    var best *CORSGroup
+    for i := range groups {
+        if strings.HasPrefix(path, groups[i].Prefix) && (best == nil || len(groups[i].Prefix) > len(best.Prefix)) {
+            best = &groups[i]
+        }
+    }
+    return best
+}
+
+func allowsAnyOrigin(policy *config.CORSPolicy) bool {
+    return !policy.AllowCredentials && contains(policy.AllowedOrigins, "*")
+}
+
+// originAllowed compara el origen con la lista de la política. "https://*.example.com" acepta
+// cualquier subdominio de example.com (pero no example.com) con el mismo esquema y puerto.
+func originAllowed(policy *config.CORSPolicy, origin string) bool {
+    origin = strings.ToLower(origin)
+    for _, allowed := range policy.AllowedOrigins {
+        allowed = strings.ToLower(allowed)
+        if allowed == "*" || allowed == origin {
+            return true
+        }
+        scheme, host, ok := strings.Cut(allowed, "://*.")
+        if !ok || !strings.HasPrefix(origin, scheme+"://") {
+            continue
+        }
+        sub := strings.TrimPrefix(origin, scheme+"://")
+        if strings.HasSuffix(sub, "."+host) && !strings.ContainsAny(strings.TrimSuffix(sub, "."+host), "/:@") {
+            return true
+        }
+    }
+    return false
+}
+
+func contains(list []string, value string) bool {
+    for _, item := range list {
+        if strings.EqualFold(item, value) {
+            return true
         }
-        next.ServeHTTP(w, r)
-    })
+    }
+    return false
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package middleware
+
+//Middleware de limitación de solicitudes. Cobra cada solicitud al bucket de su cliente en la
+//clase de rutas indicada y responde 429 con Retry-After cuando el presupuesto se agota. Los
+//fallos de autenticación se cobran aparte a la IP del cliente, antes de autenticar.
+import (
+    "log/slog"
+    "math"
+    "net/http"
+    "strconv"
+
+    chiMiddleware "github.com/go-chi/chi/v5/middleware"
+
+    "server/internal/handlers"
+    "server/internal/metrics"
+    "server/internal/ratelimit"
+)
+
+// RateLimit aplica el presupuesto de className. Con limiter nil no limita nada.
+func RateLimit(limiter *ratelimit.Limiter, proxies ratelimit.TrustedProxies, className string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if limiter == nil {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            key := proxies.Key(r)
+            decision := limiter.Allow(className, key)
+            if decision.Limit > 0 {
+                w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+                w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+            }
+            if !decision.Allowed {
+                tooManyRequests(w, r, className, key, decision)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// LimitFailedAuth va antes de Authenticate: cada respuesta 401 consume un token del bucket de
+// la IP en ClassAuth y, agotado, las solicitudes de esa IP reciben 429 sin llegar a validar
+// credenciales. Las solicitudes autenticadas no consumen nada, así que varios usuarios detrás
+// de la misma IP no se estorban. Con limiter nil no limita nada.
+func LimitFailedAuth(limiter *ratelimit.Limiter, proxies ratelimit.TrustedProxies) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if limiter == nil {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            key := "ip:" + proxies.ClientIP(r)
+            if decision := limiter.Check(ratelimit.ClassAuth, key); !decision.Allowed {
+                tooManyRequests(w, r, ratelimit.ClassAuth, key, decision)
+                return
+            }
+            ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+            next.ServeHTTP(ww, r)
+            if ww.Status() == http.StatusUnauthorized {
+                limiter.Allow(ratelimit.ClassAuth, key)
+            }
+        })
+    }
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, className, key string, decision ratelimit.Decision) {
+    retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+    if retryAfter < 1 {
+        retryAfter = 1
+    }
+    metrics.RateLimited.WithLabelValues(className).Inc()
+    slog.InfoContext(r.Context(), "rate limited", "class", className, "client", key, "retry_after", retryAfter)
+    w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+    handlers.WriteError(w, r, http.StatusTooManyRequests, "Too many requests")
+}
@@ -0,0 +1,66 @@
+package middleware
+
+//Middlewares de identificación y registro de solicitudes. RequestID asigna a cada solicitud un
+//identificador (o reutiliza el X-Request-ID del llamador si es válido), lo devuelve en la
+//respuesta y lo guarda en el contexto para que aparezca en todos los logs y errores.
+//RequestLogger reemplaza al logger de chi con una línea estructurada por solicitud.
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "log/slog"
+    "net/http"
+    "regexp"
+    "time"
+
+    chiMiddleware "github.com/go-chi/chi/v5/middleware"
+
+    "server/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limita los IDs aceptados del cliente para que no se puedan inyectar datos
+// arbitrarios en los logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requestID := r.Header.Get(RequestIDHeader)
+        if !validRequestID.MatchString(requestID) {
+            requestID = newRequestID()
+        }
+        w.Header().Set(RequestIDHeader, requestID)
+        next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+    })
+}
+
+func newRequestID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+func RequestLogger(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+        next.ServeHTTP(ww, r)
+
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+        level := slog.LevelInfo
+        if status >= http.StatusInternalServerError {
+            level = slog.LevelError
+        }
+        slog.LogAttrs(r.Context(), level, "http request",
+            slog.String("method", r.Method),
+            slog.String("path", r.URL.Path),
+            slog.Int("status", status),
+            slog.Int("bytes", ww.BytesWritten()),
+            slog.Duration("duration", time.Since(start)),
+            slog.String("remote_addr", r.RemoteAddr),
+        )
+    })
+}
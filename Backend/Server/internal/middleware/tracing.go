@@ -0,0 +1,53 @@
+package middleware
+
+//Middleware que abre un span por solicitud HTTP. Continúa la traza del llamador si trae la
+//cabecera traceparent, nombra el span con el patrón de ruta de chi y devuelve el traceparent
+//del span en la respuesta para que el cliente pueda localizar la traza.
+import (
+    "net/http"
+
+    "github.com/go-chi/chi/v5"
+    chiMiddleware "github.com/go-chi/chi/v5/middleware"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
+
+    "server/internal/tracing"
+)
+
+func Tracing(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        propagator := otel.GetTextMapPropagator()
+        ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+        ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                attribute.String("http.request.method", r.Method),
+                attribute.String("url.path", r.URL.Path),
+                attribute.String("client.address", r.RemoteAddr),
+            ),
+        )
+        defer span.End()
+
+        propagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+        ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+        next.ServeHTTP(ww, r.WithContext(ctx))
+
+        if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+            span.SetName(r.Method + " " + rctx.RoutePattern())
+            span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+        }
+        status := ww.Status()
+        if status == 0 {
+            status = http.StatusOK
+        }
+        span.SetAttributes(attribute.Int("http.response.status_code", status))
+        if status >= http.StatusInternalServerError {
+            span.SetStatus(codes.Error, http.StatusText(status))
+        }
+    })
+}
@@ -0,0 +1,17 @@
+package models
+
+//Define la solicitud de exportación de resultados. Reutiliza el término y el campo de la
+//búsqueda normal, y añade el formato de salida y las columnas (solo aplican a CSV).
+type ExportRequest struct {
+    Term       string   `json:"term"`
+    Field      string   `json:"field"`
+    Custodian  string   `json:"custodian"`
+    FolderPath string   `json:"folder_path"`
+    Format     string   `json:"format"`
+    Columns    []string `json:"columns"`
+}
+
+// SearchRequest devuelve la búsqueda equivalente a la exportación, sin paginación.
+func (r ExportRequest) SearchRequest() SearchRequest {
+    return SearchRequest{Term: r.Term, Field: r.Field, Custodian: r.Custodian, FolderPath: r.FolderPath}
+}
@@ -0,0 +1,59 @@
+package models
+
+//Define el árbol de carpetas que devuelve /api/folders. Cada nodo es una carpeta del dataset
+//("allen-p", "allen-p/inbox", ...) con el número de correos que contiene directamente y el total
+//incluyendo sus subcarpetas, para que el cliente pueda mostrar el tamaño de cada una.
+import "strings"
+
+type FolderNode struct {
+    Name string `json:"name"`
+    Path string `json:"path"`
+    // Count son los correos guardados directamente en la carpeta; Total incluye además los de
+    // todas sus subcarpetas.
+    Count int `json:"count"`
+    Total int `json:"total"`
+    // HasChildren indica si la carpeta tiene subcarpetas aunque Children venga vacío porque el
+    // árbol se recortó con depth; el cliente puede pedirlas después con root=Path.
+    HasChildren bool          `json:"has_children"`
+    Children    []*FolderNode `json:"children,omitempty"`
+}
+
+// Find devuelve el nodo con la ruta path ("allen-p/inbox") dentro del árbol, o nil si no existe.
+// La ruta vacía es el propio nodo.
+func (n *FolderNode) Find(path string) *FolderNode {
+    node := n
+    for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+        if name == "" {
+            continue
+        }
+        var next *FolderNode
+        for _, child := range node.Children {
+            if child.Name == name {
+                next = child
+                break
+            }
+        }
+        if next == nil {
+            return nil
+        }
+        node = next
+    }
+    return node
+}
+
+// Prune elimina los nodos que están a más de depth niveles por debajo de n. Con depth 0 no
+// recorta nada.
+func (n *FolderNode) Prune(depth int) {
+    if depth <= 0 {
+        return
+    }
+    if depth == 1 {
+        for _, child := range n.Children {
+            child.Children = nil
+        }
+        return
+    }
+    for _, child := range n.Children {
+        child.Prune(depth - 1)
+    }
+}
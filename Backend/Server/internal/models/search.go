@@ -1,11 +1,28 @@
 package models
 
 //Define la estructura de la solicitud de búsqueda y la consulta de búsqueda de ZincSearch.
+import "strings"
+
 type SearchRequest struct {
     Term  string `json:"term"`
     From  int    `json:"from"`
     Size  int    `json:"size"`
     Field string `json:"field"`
+    // Filtros exactos sobre los campos keyword que escribe el indexador: el buzón ("allen-p") y
+    // la carpeta ("allen-p/inbox"). Vacíos, no filtran.
+    Custodian  string `json:"custodian,omitempty"`
+    FolderPath string `json:"folder_path,omitempty"`
+}
+
+// HasFilters indica si la solicitud tiene algún filtro exacto.
+func (r SearchRequest) HasFilters() bool {
+    return r.Custodian != "" || r.FolderPath != ""
+}
+
+// NormalizeFilters quita los espacios y las barras sobrantes de los filtros exactos.
+func (r *SearchRequest) NormalizeFilters() {
+    r.Custodian = strings.Trim(strings.TrimSpace(r.Custodian), "/")
+    r.FolderPath = strings.Trim(strings.TrimSpace(r.FolderPath), "/")
 }
 
 type ZincSearchQuery struct {
@@ -14,9 +31,83 @@ type ZincSearchQuery struct {
     From        int     `json:"from"`
     MaxResults  int     `json:"max_results"`
     Source      []string `json:"_source"`
+    SortFields  []string `json:"sort_fields,omitempty"`
+    Aggs        map[string]Aggregation `json:"aggs,omitempty"`
+}
+
+// Aggregation es una agregación de ZincSearch (por ejemplo, {"agg_type": "term", "field":
+// "folder_path", "size": 1000} para contar documentos por valor de un campo keyword).
+type Aggregation struct {
+    AggType string `json:"agg_type"`
+    Field   string `json:"field"`
+    Size    int    `json:"size,omitempty"`
+}
+
+// AggregationResponse contiene los buckets de las agregaciones de una respuesta.
+type AggregationResponse struct {
+    Aggregations map[string]struct {
+        Buckets []struct {
+            Key      string `json:"key"`
+            DocCount int    `json:"doc_count"`
+        } `json:"buckets"`
+    } `json:"aggregations"`
 }
 
 type Query struct {
     Term  string `json:"term"`
     Field string `json:"field"`
-}
\ No newline at end of file
+}
+
+// Email refleja los campos de un correo tal como los guarda el indexador en ZincSearch.
+type Email struct {
+    MessageID string `json:"message_id"`
+    Date      string `json:"date"`
+    From      string `json:"from"`
+    To        string `json:"to"`
+    Subject   string `json:"subject"`
+    Body      string `json:"body"`
+    Folder    string `json:"folder"`
+    // Campos keyword normalizados: custodio ("allen-p"), carpeta ("allen-p/inbox"), último
+    // nivel de la carpeta ("inbox") y nombre del archivo ("12."). Los correos indexados con
+    // versiones anteriores del indexador no los tienen.
+    Custodian  string `json:"custodian,omitempty"`
+    FolderPath string `json:"folder_path,omitempty"`
+    FolderLeaf string `json:"folder_leaf,omitempty"`
+    FileName   string `json:"file_name,omitempty"`
+}
+
+// ZincSearchResponse contiene solo la parte de la respuesta de ZincSearch que el servidor
+// necesita interpretar (el resto se reenvía tal cual al cliente).
+type ZincSearchResponse struct {
+    Hits struct {
+        Total struct {
+            Value int `json:"value"`
+        } `json:"total"`
+        Hits []Hit `json:"hits"`
+    } `json:"hits"`
+}
+
+type Hit struct {
+    ID     string `json:"_id"`
+    Source Email  `json:"_source"`
+}
+
+
+// ParseFolderPath separa el campo "folder" que guarda el indexador (la ruta del archivo, por
+// ejemplo "enron_mail_20110402/maildir/allen-p/inbox/1.") en el custodio ("allen-p") y la
+// carpeta dentro de su buzón ("inbox"). Devuelve cadenas vacías si la ruta no tiene esa forma.
+func ParseFolderPath(path string) (custodian, folder string) {
+    segments := strings.Split(strings.ReplaceAll(path, "\\", "/"), "/")
+    start := 1
+    for i, segment := range segments {
+        if segment == "maildir" {
+            start = i + 1
+            break
+        }
+    }
+    // Hace falta al menos el custodio y el archivo.
+    if start >= len(segments)-1 {
+        return "", ""
+    }
+    return segments[start], strings.Join(segments[start+1:len(segments)-1], "/")
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+//Identificación del cliente al que se cobra cada solicitud: el principal autenticado si lo hay
+//y, si no, la IP del cliente. Detrás de un proxy de confianza la IP se toma de
+//X-Forwarded-For (o X-Real-IP); de cualquier otro origen esas cabeceras se ignoran, porque el
+//cliente podría falsificarlas para repartir su consumo entre IPs inventadas.
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "strings"
+
+    "server/internal/auth"
+)
+
+// TrustedProxies es una lista de redes cuyos encabezados de reenvío se aceptan.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies interpreta IPs sueltas y rangos CIDR.
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+    var proxies TrustedProxies
+    for _, entry := range entries {
+        if !strings.Contains(entry, "/") {
+            if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+                entry += "/32"
+            } else {
+                entry += "/128"
+            }
+        }
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+        }
+        proxies = append(proxies, network)
+    }
+    return proxies, nil
+}
+
+func (t TrustedProxies) contains(ip net.IP) bool {
+    for _, network := range t {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// ClientIP devuelve la IP del cliente. Recorre X-Forwarded-For de derecha a izquierda
+// saltándose los proxies de confianza; la primera dirección que no lo es es el cliente.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    remote := net.ParseIP(host)
+    if remote == nil || !t.contains(remote) {
+        return host
+    }
+
+    if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+        hops := strings.Split(strings.Join(forwarded, ","), ",")
+        for i := len(hops) - 1; i >= 0; i-- {
+            ip := net.ParseIP(strings.TrimSpace(hops[i]))
+            if ip == nil {
+                break
+            }
+            if !t.contains(ip) || i == 0 {
+                return ip.String()
+            }
+        }
+    }
+    if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+        return ip.String()
+    }
+    return host
+}
+
+// Key devuelve la clave del bucket: "key:<nombre>" para API keys, "user:<sujeto>" para JWT y
+// "ip:<dirección>" para solicitudes sin autenticar.
+func (t TrustedProxies) Key(r *http.Request) string {
+    if principal := auth.FromContext(r.Context()); principal != nil {
+        if principal.Method == auth.MethodAPIKey {
+            return "key:" + principal.Subject
+        }
+        return "user:" + principal.Subject
+    }
+    return "ip:" + t.ClientIP(r)
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+//Limitación de solicitudes con token buckets. Cada clase de rutas (búsqueda, exportación,
+//administración) tiene su propio presupuesto, y los fallos de autenticación otro aparte: una tasa sostenida (solicitudes por segundo) y
+//una ráfaga máxima. Cada cliente (API key, usuario o IP) tiene un bucket por clase. Los
+//presupuestos se pueden cambiar en caliente; los buckets existentes se ajustan al momento.
+import (
+    "fmt"
+    "math"
+    "sort"
+    "sync"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+// Clases de rutas con presupuesto propio.
+const (
+    ClassSearch = "search"
+    ClassExport = "export"
+    ClassAdmin  = "admin"
+    // ClassAuth se cobra por IP a cada autenticación fallida, para frenar la prueba de claves.
+    ClassAuth = "auth"
+)
+
+// idleTimeout es el tiempo sin solicitudes tras el que se olvida el bucket de un cliente.
+const idleTimeout = 10 * time.Minute
+
+// Budget es el presupuesto de una clase. Rate <= 0 desactiva el límite.
+type Budget struct {
+    Rate  float64 `json:"rate"`
+    Burst int     `json:"burst"`
+}
+
+// Validate comprueba que el presupuesto se puede aplicar.
+func (b Budget) Validate() error {
+    if math.IsNaN(b.Rate) || math.IsInf(b.Rate, 0) {
+        return fmt.Errorf("rate must be a number")
+    }
+    if b.Rate > 0 && b.Burst < 1 {
+        return fmt.Errorf("burst must be at least 1")
+    }
+    return nil
+}
+
+type bucket struct {
+    limiter  *rate.Limiter
+    lastSeen time.Time
+}
+
+type class struct {
+    budget  Budget
+    buckets map[string]*bucket
+}
+
+// Limiter guarda los presupuestos y los buckets de todos los clientes.
+type Limiter struct {
+    mu        sync.Mutex
+    classes   map[string]*class
+    lastSweep time.Time
+    now       func() time.Time
+}
+
+func New(budgets map[string]Budget) *Limiter {
+    l := &Limiter{classes: make(map[string]*class), now: time.Now}
+    for name, budget := range budgets {
+        l.classes[name] = &class{budget: budget, buckets: make(map[string]*bucket)}
+    }
+    return l
+}
+
+// Decision es el resultado de Allow.
+type Decision struct {
+    Allowed bool
+    // Limit es la ráfaga de la clase y Remaining las solicitudes que quedan en el bucket.
+    Limit     int
+    Remaining int
+    // RetryAfter es lo que falta para que haya un token disponible (solo si no se permite).
+    RetryAfter time.Duration
+}
+
+// Allow consume un token del bucket de key en la clase indicada. Las clases desconocidas o
+// sin límite siempre se permiten.
+func (l *Limiter) Allow(className, key string) Decision {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := l.now()
+    l.sweep(now)
+
+    c, ok := l.classes[className]
+    if !ok || c.budget.Rate <= 0 {
+        return Decision{Allowed: true}
+    }
+
+    b, ok := c.buckets[key]
+    if !ok {
+        b = &bucket{limiter: rate.NewLimiter(rate.Limit(c.budget.Rate), c.budget.Burst)}
+        c.buckets[key] = b
+    }
+    b.lastSeen = now
+
+    reservation := b.limiter.ReserveN(now, 1)
+    if delay := reservation.DelayFrom(now); delay > 0 {
+        reservation.CancelAt(now)
+        return Decision{Limit: c.budget.Burst, RetryAfter: delay}
+    }
+    return Decision{
+        Allowed:   true,
+        Limit:     c.budget.Burst,
+        Remaining: int(b.limiter.TokensAt(now)),
+    }
+}
+
+// Check indica si el bucket de key tiene un token disponible sin consumirlo.
+func (l *Limiter) Check(className, key string) Decision {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    c, ok := l.classes[className]
+    if !ok || c.budget.Rate <= 0 {
+        return Decision{Allowed: true}
+    }
+    b, ok := c.buckets[key]
+    if !ok {
+        return Decision{Allowed: true, Limit: c.budget.Burst, Remaining: c.budget.Burst}
+    }
+    tokens := b.limiter.TokensAt(l.now())
+    if tokens < 1 {
+        wait := time.Duration((1 - tokens) / c.budget.Rate * float64(time.Second))
+        return Decision{Limit: c.budget.Burst, RetryAfter: wait}
+    }
+    return Decision{Allowed: true, Limit: c.budget.Burst, Remaining: int(tokens)}
+}
+
+// sweep olvida los buckets inactivos. Se ejecuta como mucho una vez por minuto.
+func (l *Limiter) sweep(now time.Time) {
+    if now.Sub(l.lastSweep) < time.Minute {
+        return
+    }
+    l.lastSweep = now
+    for _, c := range l.classes {
+        for key, b := range c.buckets {
+            if now.Sub(b.lastSeen) > idleTimeout {
+                delete(c.buckets, key)
+            }
+        }
+    }
+}
+
+// Budgets devuelve los presupuestos actuales por clase.
+func (l *Limiter) Budgets() map[string]Budget {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    budgets := make(map[string]Budget, len(l.classes))
+    for name, c := range l.classes {
+        budgets[name] = c.budget
+    }
+    return budgets
+}
+
+// Classes devuelve los nombres de las clases, ordenados.
+func (l *Limiter) Classes() []string {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    names := make([]string, 0, len(l.classes))
+    for name := range l.classes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// SetBudget cambia el presupuesto de una clase existente y lo aplica a los buckets actuales.
+func (l *Limiter) SetBudget(className string, budget Budget) error {
+    if err := budget.Validate(); err != nil {
+        return fmt.Errorf("%s: %w", className, err)
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    c, ok := l.classes[className]
+    if !ok {
+        return fmt.Errorf("unknown rate limit class %q", className)
+    }
+    c.budget = budget
+    now := l.now()
+    for _, b := range c.buckets {
+        b.limiter.SetLimitAt(now, rate.Limit(budget.Rate))
+        b.limiter.SetBurstAt(now, budget.Burst)
+    }
+    return nil
+}
@@ -0,0 +1,357 @@
+package services
+
+//Contiene la lógica para exportar todos los resultados de una búsqueda (no solo una página).
+//Pagina internamente contra ZincSearch mediante SearchService.Scan y escribe cada correo en
+//el formato pedido (CSV, NDJSON, mbox o un zip de archivos .eml) a medida que llega, de modo
+//que la memoria usada depende del tamaño de página y no del total de resultados.
+import (
+    "archive/zip"
+    "bufio"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "net/mail"
+    "regexp"
+    "strings"
+    "time"
+
+    "server/config"
+    "server/internal/acl"
+    "server/internal/audit"
+    "server/internal/models"
+)
+
+// Formatos de exportación soportados.
+const (
+    FormatCSV    = "csv"
+    FormatNDJSON = "ndjson"
+    FormatMbox   = "mbox"
+    FormatEML    = "eml"
+)
+
+// ErrInvalidExport indica que la solicitud de exportación no es válida (formato o columnas).
+var ErrInvalidExport = errors.New("invalid export request")
+
+// ExportColumns son las columnas que se pueden pedir en el CSV, en el orden por defecto.
+var ExportColumns = []string{"id", "message_id", "date", "from", "to", "subject", "folder", "custodian", "folder_path", "body"}
+
+var exportContentTypes = map[string]string{
+    FormatCSV:    "text/csv; charset=utf-8",
+    FormatNDJSON: "application/x-ndjson",
+    FormatMbox:   "application/mbox",
+    FormatEML:    "application/zip",
+}
+
+var exportExtensions = map[string]string{
+    FormatCSV:    "csv",
+    FormatNDJSON: "ndjson",
+    FormatMbox:   "mbox",
+    FormatEML:    "zip",
+}
+
+type ExportService struct {
+    searchService *SearchService
+    pageSize      int
+    writeTimeout  time.Duration
+}
+
+func NewExportService(config *config.Config, searchService *SearchService) *ExportService {
+    return &ExportService{
+        searchService: searchService,
+        pageSize:      config.ExportPageSize,
+        writeTimeout:  config.ServerWriteTimeout,
+    }
+}
+
+// WriteTimeout es el plazo de escritura que se concede a cada página de la exportación. Una
+// exportación completa puede durar mucho más que el WriteTimeout del servidor, así que el
+// handler lo renueva después de cada página en lugar de aplicarlo a toda la respuesta.
+func (s *ExportService) WriteTimeout() time.Duration {
+    return s.writeTimeout
+}
+
+// Validate normaliza el formato y las columnas de la solicitud. Devuelve un error que envuelve
+// ErrInvalidExport si algo no es válido.
+func (s *ExportService) Validate(req *models.ExportRequest) error {
+    req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+    if req.Format == "" {
+        req.Format = FormatCSV
+    }
+    if _, ok := exportContentTypes[req.Format]; !ok {
+        return fmt.Errorf("%w: unknown format %q", ErrInvalidExport, req.Format)
+    }
+
+    if len(req.Columns) == 0 {
+        req.Columns = ExportColumns
+        return nil
+    }
+    for i, column := range req.Columns {
+        column = strings.ToLower(strings.TrimSpace(column))
+        if !isExportColumn(column) {
+            return fmt.Errorf("%w: unknown column %q", ErrInvalidExport, column)
+        }
+        req.Columns[i] = column
+    }
+    return nil
+}
+
+// ContentType devuelve el Content-Type de la respuesta para un formato ya validado.
+func (s *ExportService) ContentType(format string) string {
+    return exportContentTypes[format]
+}
+
+// FileName devuelve el nombre de archivo sugerido para la descarga.
+func (s *ExportService) FileName(format string) string {
+    return fmt.Sprintf("emails-%s.%s", time.Now().UTC().Format("20060102-150405"), exportExtensions[format])
+}
+
+// Export ejecuta la búsqueda de req y escribe todos los resultados en w. La solicitud debe
+// haber pasado por Validate. Si ctx se cancela (por ejemplo, el cliente se desconecta) la
+// exportación se detiene en la siguiente página.
+func (s *ExportService) Export(ctx context.Context, w io.Writer, req models.ExportRequest) error {
+    ew, err := newEmailWriter(w, req)
+    if err != nil {
+        return err
+    }
+
+    // Cada página escrita se audita con los IDs de sus correos; si la exportación falla, se
+    // registra además un evento con el resultado.
+    query := &audit.Query{
+        Term:       audit.NormalizeTerm(req.Term),
+        Field:      req.Field,
+        Custodian:  req.Custodian,
+        FolderPath: req.FolderPath,
+        Format:     req.Format,
+        Columns:    req.Columns,
+    }
+    err = s.searchService.Scan(ctx, req.SearchRequest(), s.pageSize, func(hits []models.Hit) error {
+        ids := make([]string, 0, len(hits))
+        for _, hit := range hits {
+            if err := ew.WriteEmail(hit); err != nil {
+                return fmt.Errorf("error writing export: %w", err)
+            }
+            ids = append(ids, hit.ID)
+        }
+        if err := ew.Flush(); err != nil {
+            return err
+        }
+        if f, ok := w.(http.Flusher); ok {
+            f.Flush()
+        }
+        audit.Record(ctx, audit.Event{Action: audit.ActionExport, Query: query, Hits: len(ids), DocumentIDs: ids})
+        return nil
+    })
+    if err == nil {
+        err = ew.Close()
+    }
+    if err != nil {
+        audit.Record(ctx, audit.Event{Action: audit.ActionExport, Outcome: audit.Outcome(err, acl.ErrNoAccess, ErrNotFound), Query: query})
+    }
+    return err
+}
+
+// emailWriter escribe correos en un formato de exportación concreto.
+type emailWriter interface {
+    WriteEmail(hit models.Hit) error
+    // Flush vacía lo escrito hasta el momento; se llama al final de cada página.
+    Flush() error
+    // Close escribe lo que falte para que el archivo quede completo.
+    Close() error
+}
+
+func newEmailWriter(w io.Writer, req models.ExportRequest) (emailWriter, error) {
+    switch req.Format {
+    case FormatCSV:
+        return &csvWriter{w: csv.NewWriter(w), columns: req.Columns}, nil
+    case FormatNDJSON:
+        bw := bufio.NewWriter(w)
+        return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+    case FormatMbox:
+        return &mboxWriter{w: bufio.NewWriter(w)}, nil
+    case FormatEML:
+        return &emlZipWriter{zw: zip.NewWriter(w)}, nil
+    }
+    return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidExport, req.Format)
+}
+
+func isExportColumn(column string) bool {
+    for _, c := range ExportColumns {
+        if c == column {
+            return true
+        }
+    }
+    return false
+}
+
+func columnValue(hit models.Hit, column string) string {
+    switch column {
+    case "id":
+        return hit.ID
+    case "message_id":
+        return hit.Source.MessageID
+    case "date":
+        return hit.Source.Date
+    case "from":
+        return hit.Source.From
+    case "to":
+        return hit.Source.To
+    case "subject":
+        return hit.Source.Subject
+    case "folder":
+        return hit.Source.Folder
+    case "custodian":
+        return hit.Source.Custodian
+    case "folder_path":
+        return hit.Source.FolderPath
+    case "body":
+        return hit.Source.Body
+    }
+    return ""
+}
+
+// csvWriter escribe la cabecera de forma perezosa, así un error en la primera página no deja
+// una respuesta a medio escribir.
+type csvWriter struct {
+    w             *csv.Writer
+    columns       []string
+    headerWritten bool
+}
+
+func (c *csvWriter) writeHeader() error {
+    if c.headerWritten {
+        return nil
+    }
+    c.headerWritten = true
+    return c.w.Write(c.columns)
+}
+
+func (c *csvWriter) WriteEmail(hit models.Hit) error {
+    if err := c.writeHeader(); err != nil {
+        return err
+    }
+    record := make([]string, len(c.columns))
+    for i, column := range c.columns {
+        record[i] = columnValue(hit, column)
+    }
+    return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+    c.w.Flush()
+    return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+    if err := c.writeHeader(); err != nil {
+        return err
+    }
+    return c.Flush()
+}
+
+type ndjsonWriter struct {
+    w   *bufio.Writer
+    enc *json.Encoder
+}
+
+// ndjsonLine incluye el id del documento junto a los campos del correo.
+type ndjsonLine struct {
+    ID string `json:"_id"`
+    models.Email
+}
+
+func (n *ndjsonWriter) WriteEmail(hit models.Hit) error {
+    return n.enc.Encode(ndjsonLine{ID: hit.ID, Email: hit.Source})
+}
+
+func (n *ndjsonWriter) Flush() error { return n.w.Flush() }
+func (n *ndjsonWriter) Close() error { return n.w.Flush() }
+
+// mboxWriter genera un único archivo mbox (variante mboxrd: las líneas que empiezan por
+// "From " con cero o más ">" delante se escapan con un ">" adicional).
+type mboxWriter struct {
+    w *bufio.Writer
+}
+
+var mboxFromLine = regexp.MustCompile(`(?m)^(>*From )`)
+
+func (m *mboxWriter) WriteEmail(hit models.Hit) error {
+    sender := "MAILER-DAEMON"
+    if addr, err := mail.ParseAddress(hit.Source.From); err == nil {
+        sender = addr.Address
+    }
+    fmt.Fprintf(m.w, "From %s %s\n", sender, parseEmailDate(hit.Source.Date).Format(time.ANSIC))
+    writeHeaders(m.w, hit, "\n")
+    m.w.WriteString("\n")
+    m.w.WriteString(mboxFromLine.ReplaceAllString(hit.Source.Body, ">$1"))
+    _, err := m.w.WriteString("\n\n")
+    return err
+}
+
+func (m *mboxWriter) Flush() error { return m.w.Flush() }
+func (m *mboxWriter) Close() error { return m.w.Flush() }
+
+// emlZipWriter escribe un archivo .eml por correo dentro de un zip. archive/zip escribe cada
+// entrada en streaming, así que no hace falta tener el zip completo en memoria.
+type emlZipWriter struct {
+    zw    *zip.Writer
+    count int
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (e *emlZipWriter) WriteEmail(hit models.Hit) error {
+    e.count++
+    name := unsafeFileChars.ReplaceAllString(hit.ID, "_")
+    if name == "" {
+        name = "email"
+    }
+    f, err := e.zw.CreateHeader(&zip.FileHeader{
+        Name:     fmt.Sprintf("%06d_%s.eml", e.count, name),
+        Method:   zip.Deflate,
+        Modified: parseEmailDate(hit.Source.Date),
+    })
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    writeHeaders(w, hit, "\r\n")
+    w.WriteString("\r\n")
+    w.WriteString(strings.ReplaceAll(hit.Source.Body, "\n", "\r\n"))
+    w.WriteString("\r\n")
+    return w.Flush()
+}
+
+func (e *emlZipWriter) Flush() error { return e.zw.Flush() }
+func (e *emlZipWriter) Close() error { return e.zw.Close() }
+
+// writeHeaders escribe las cabeceras RFC 5322 del correo con el fin de línea indicado.
+func writeHeaders(w *bufio.Writer, hit models.Hit, eol string) {
+    header := func(name, value string) {
+        if value == "" {
+            return
+        }
+        w.WriteString(name + ": " + mime.QEncoding.Encode("utf-8", value) + eol)
+    }
+    header("Message-ID", hit.Source.MessageID)
+    header("Date", hit.Source.Date)
+    header("From", hit.Source.From)
+    header("To", hit.Source.To)
+    header("Subject", hit.Source.Subject)
+    header("X-Folder", hit.Source.Folder)
+    w.WriteString("MIME-Version: 1.0" + eol)
+    w.WriteString("Content-Type: text/plain; charset=utf-8" + eol)
+}
+
+// parseEmailDate interpreta la fecha del correo; si no es válida usa el epoch para que la
+// línea "From " del mbox siga siendo correcta.
+func parseEmailDate(value string) time.Time {
+    if t, err := mail.ParseDate(value); err == nil {
+        return t
+    }
+    return time.Unix(0, 0).UTC()
+}
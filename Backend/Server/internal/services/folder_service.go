@@ -1,67 +1,519 @@
 package services
 
+//Construye el árbol de carpetas para /api/folders, con el número de correos de cada carpeta.
+//Por defecto sale del propio índice: una agregación por términos sobre el campo folder_path
+//("allen-p/inbox") que escribe el indexador, así que funciona aunque el servidor no tenga acceso
+//a los archivos originales.
+//Como alternativa se puede leer del sistema de archivos (folders.source = filesystem) a partir
+//de una raíz configurable.
+//Leer el origen es caro (miles de carpetas en disco), así que el resultado se guarda en memoria y
+//se renueva periódicamente o cuando se detecta un cambio; cada solicitud solo aplica su alcance.
 import (
-    "log"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "hash/fnv"
+    "io/fs"
+    "log/slog"
+    "net/http"
     "os"
     "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "golang.org/x/sync/singleflight"
+
+    "server/config"
+    "server/internal/acl"
+    "server/internal/metrics"
+    "server/internal/models"
+    "server/internal/tracing"
+    "server/internal/zinc"
 )
 
-type FolderService struct{}
+// Orígenes del listado de carpetas.
+const (
+    FolderSourceIndex      = "index"
+    FolderSourceFilesystem = "filesystem"
+)
+
+// folderPathField es el campo keyword con la carpeta normalizada de cada correo.
+const folderPathField = "folder_path"
+
+type FolderService struct {
+    config *config.Config
+    client *zinc.Client
 
-func NewFolderService() *FolderService {
-    return &FolderService{}
+    // snapshot guarda el número de correos de cada carpeta (sin aplicar el alcance) de la
+    // última lectura del origen; group evita que varias solicitudes lo lean a la vez.
+    snapshot atomic.Pointer[folderSnapshot]
+    group    singleflight.Group
 }
 
-// GetFolders recorre la carpeta "enron_mail_20110402" y devuelve un mapa donde cada llave es el nombre de una persona 
-// y el valor es un slice con los nombres de las subcarpetas (por ejemplo, "contacts", "all_documents", etc.).
-func (s *FolderService) GetFolders() map[string][]string {
-    folders := make(map[string][]string)
+// folderSnapshot es una lectura completa del origen de carpetas.
+type folderSnapshot struct {
+    counts      map[string]int
+    version     string
+    refreshedAt time.Time
+    // signature resume el estado del origen al leerlo (fechas de modificación de las carpetas o
+    // número de documentos del índice) para detectar cambios sin volver a leerlo entero.
+    signature string
+}
 
-    // Obtener el directorio de trabajo actual.
-    cwd, err := os.Getwd()
-    if err != nil {
-        log.Println("Error obteniendo directorio de trabajo:", err)
-        return folders
+// FolderTree es la respuesta de GetFolders: el árbol pedido, un ETag que cambia si cambia su
+// contenido y la fecha de la lectura del origen de la que sale.
+type FolderTree struct {
+    Root        *models.FolderNode
+    ETag        string
+    RefreshedAt time.Time
+}
+
+func NewFolderService(config *config.Config, client *zinc.Client) *FolderService {
+    return &FolderService{config: config, client: client}
+}
+
+// ErrInvalidFolderQuery indica que los parámetros del árbol de carpetas no son válidos.
+var ErrInvalidFolderQuery = errors.New("invalid folder query")
+
+// GetFolders devuelve el árbol de carpetas (custodios, sus carpetas y todas las subcarpetas) con
+// el número de correos de cada una. root ("allen-p/inbox") devuelve solo ese subárbol y depth,
+// si es mayor que cero, limita los niveles por debajo de él. Solo se incluyen las carpetas dentro
+// del alcance de la solicitud (acl.Scope); las carpetas intermedias aparecen sin sus correos
+// propios si solo se tiene acceso a alguna subcarpeta. Si root no existe o queda fuera del
+// alcance devuelve ErrNotFound.
+//
+// El árbol sale de la última lectura del origen mientras tenga menos de folders.refresh_interval;
+// con un intervalo de 0 el origen se lee en cada llamada.
+func (s *FolderService) GetFolders(ctx context.Context, root string, depth int) (tree *FolderTree, err error) {
+    if depth < 0 {
+        return nil, fmt.Errorf("%w: depth must not be negative", ErrInvalidFolderQuery)
     }
 
-    // Ajusta la ruta según tu estructura.
-    // Si se ejecuta desde Backend/Server/cmd, sube dos niveles y entra a Indexer/enron_mail_20110402
-    baseDir := filepath.Join(cwd, "..", "..", "Indexer", "enron_mail_20110402")
+    ctx, span := tracing.Tracer().Start(ctx, "FolderService.GetFolders", trace.WithAttributes(
+        attribute.String("folders.source", s.config.FoldersSource),
+        attribute.String("folders.root", root),
+        attribute.Int("folders.depth", depth),
+    ))
+    defer func() {
+        if err != nil {
+            span.RecordError(err)
+        }
+        span.End()
+    }()
 
-    // Si existe un directorio "maildir" dentro de enron_mail_20110402, asumimos que es donde están los nombres.
-    // En ese caso, actualizamos la ruta base.
-    maildirPath := filepath.Join(baseDir, "maildir")
-    if info, err := os.Stat(maildirPath); err == nil && info.IsDir() {
-        baseDir = maildirPath
+    snapshot, err := s.current(ctx)
+    if err != nil {
+        return nil, err
+    }
+    span.SetAttributes(attribute.String("folders.refreshed_at", snapshot.refreshedAt.Format(time.RFC3339)))
+
+    scope := acl.FromContext(ctx)
+    node := buildFolderTree(snapshot.counts, scope).Find(root)
+    if node == nil {
+        return nil, fmt.Errorf("%w: folder %q", ErrNotFound, root)
     }
+    node.Prune(depth)
+
+    // El ETag depende de la lectura del origen y de todo lo que cambia la respuesta.
+    etag := fnv.New64a()
+    fmt.Fprintf(etag, "%s|%s|%s|%d", snapshot.version, scope.Key(), node.Path, depth)
+    return &FolderTree{
+        Root:        node,
+        ETag:        fmt.Sprintf(`"%x"`, etag.Sum64()),
+        RefreshedAt: snapshot.refreshedAt,
+    }, nil
+}
 
-    // Leer los directorios principales (cada persona)
-    personDirs, err := os.ReadDir(baseDir)
+// current devuelve la lectura vigente del origen, leyéndolo de nuevo si no hay ninguna o si ha
+// caducado. Si la nueva lectura falla pero hay una anterior, se sigue usando la anterior.
+func (s *FolderService) current(ctx context.Context) (*folderSnapshot, error) {
+    snapshot := s.snapshot.Load()
+    if snapshot != nil && s.config.FoldersRefreshInterval > 0 && time.Since(snapshot.refreshedAt) < s.config.FoldersRefreshInterval {
+        return snapshot, nil
+    }
+    fresh, err := s.refresh(ctx)
     if err != nil {
-        log.Println("Error leyendo baseDir:", err)
-        return folders
+        if snapshot != nil && ctx.Err() == nil {
+            slog.WarnContext(ctx, "folder refresh failed, serving previous folder tree", "refreshed_at", snapshot.refreshedAt, "error", err)
+            return snapshot, nil
+        }
+        return nil, err
+    }
+    return fresh, nil
+}
+
+// Refresh vuelve a leer el origen de carpetas y reemplaza la lectura vigente.
+func (s *FolderService) Refresh(ctx context.Context) error {
+    _, err := s.refresh(ctx)
+    return err
+}
+
+// RefreshIfChanged compara el estado del origen con el de la última lectura y, si ha cambiado
+// (o no hay ninguna), lo vuelve a leer. Devuelve true si hubo una lectura nueva.
+func (s *FolderService) RefreshIfChanged(ctx context.Context) (bool, error) {
+    snapshot := s.snapshot.Load()
+    if snapshot != nil {
+        signature, err := s.signature(ctx, snapshot.counts)
+        if err != nil {
+            return false, err
+        }
+        if signature == snapshot.signature {
+            return false, nil
+        }
+        slog.InfoContext(ctx, "folder source changed, refreshing folder tree")
+    }
+    if _, err := s.refresh(ctx); err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// RefreshedAt devuelve la fecha de la última lectura del origen (cero si aún no hay ninguna).
+func (s *FolderService) RefreshedAt() time.Time {
+    if snapshot := s.snapshot.Load(); snapshot != nil {
+        return snapshot.refreshedAt
     }
+    return time.Time{}
+}
 
-    for _, personEntry := range personDirs {
-        if personEntry.IsDir() {
-            personName := personEntry.Name()
-            personFolderPath := filepath.Join(baseDir, personName)
+// Run mantiene el árbol al día hasta que ctx se cancela: lo lee al arrancar, lo vuelve a leer
+// cada folders.refresh_interval y cada folders.poll_interval comprueba si el origen ha cambiado.
+// Con la caché desactivada (refresh_interval 0) no hace nada.
+func (s *FolderService) Run(ctx context.Context) {
+    if s.config.FoldersRefreshInterval <= 0 {
+        return
+    }
+    if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+        slog.Warn("initial folder scan failed", "error", err)
+    }
 
-            // Leer las subcarpetas dentro de la carpeta de la persona.
-            subEntries, err := os.ReadDir(personFolderPath)
-            if err != nil {
-                log.Printf("No se pudo leer '%s': %v", personFolderPath, err)
-                continue
+    refresh := time.NewTicker(s.config.FoldersRefreshInterval)
+    defer refresh.Stop()
+    var poll <-chan time.Time
+    if s.config.FoldersPollInterval > 0 {
+        ticker := time.NewTicker(s.config.FoldersPollInterval)
+        defer ticker.Stop()
+        poll = ticker.C
+    }
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-refresh.C:
+            if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+                slog.Warn("scheduled folder refresh failed", "error", err)
             }
+        case <-poll:
+            if _, err := s.RefreshIfChanged(ctx); err != nil && ctx.Err() == nil {
+                slog.Warn("folder change detection failed", "error", err)
+            }
+        }
+    }
+}
+
+// refresh lee el origen completo y guarda la lectura. Las lecturas simultáneas se agrupan en una.
+// La lectura no depende del contexto de quien la pide: si un cliente se desconecta, el resto de
+// los que esperan la misma lectura no se ven afectados.
+func (s *FolderService) refresh(ctx context.Context) (*folderSnapshot, error) {
+    ch := s.group.DoChan("refresh", func() (interface{}, error) {
+        return s.load(context.WithoutCancel(ctx))
+    })
+    select {
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    case result := <-ch:
+        if result.Err != nil {
+            return nil, result.Err
+        }
+        return result.Val.(*folderSnapshot), nil
+    }
+}
+
+func (s *FolderService) load(ctx context.Context) (snapshot *folderSnapshot, err error) {
+    ctx, span := tracing.Tracer().Start(ctx, "FolderService.Refresh", trace.WithAttributes(
+        attribute.String("folders.source", s.config.FoldersSource),
+    ))
+    start := time.Now()
+    defer func() {
+        metrics.FolderScanDuration.Observe(time.Since(start).Seconds())
+        if err != nil {
+            span.RecordError(err)
+        }
+        span.End()
+    }()
 
-            var subFolders []string
-            for _, subEntry := range subEntries {
-                if subEntry.IsDir() {
-                    subFolders = append(subFolders, subEntry.Name())
-                }
+    // La firma se toma antes de leer: si el origen cambia durante la lectura, la siguiente
+    // comprobación lo detecta.
+    var counts map[string]int
+    var signature string
+    if s.config.FoldersSource == FolderSourceFilesystem {
+        if counts, err = s.filesystemCounts(ctx); err == nil {
+            signature, err = s.signature(ctx, counts)
+        }
+    } else {
+        if signature, err = s.signature(ctx, nil); err == nil {
+            counts, err = s.indexCounts(ctx)
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    paths := make([]string, 0, len(counts))
+    custodians := make(map[string]bool)
+    for path := range counts {
+        paths = append(paths, path)
+        custodian, _, _ := strings.Cut(path, "/")
+        custodians[custodian] = true
+    }
+    sort.Strings(paths)
+    version := fnv.New64a()
+    for _, path := range paths {
+        fmt.Fprintf(version, "%s=%d\n", path, counts[path])
+    }
+
+    snapshot = &folderSnapshot{
+        counts:      counts,
+        version:     fmt.Sprintf("%x", version.Sum64()),
+        refreshedAt: time.Now(),
+        signature:   signature,
+    }
+    s.snapshot.Store(snapshot)
+    metrics.FolderCount.Set(float64(len(custodians)))
+    metrics.FolderLastRefresh.SetToCurrentTime()
+    span.SetAttributes(attribute.Int("folders.custodians", len(custodians)), attribute.Int("folders.paths", len(paths)))
+    return snapshot, nil
+}
+
+// signature resume el estado del origen. En el sistema de archivos son las fechas de
+// modificación de la raíz y de cada carpeta conocida (añadir o quitar un correo o una subcarpeta
+// cambia la de su carpeta), lo que cuesta un stat por carpeta en lugar de listar todos los
+// archivos. En el índice es el número de documentos.
+func (s *FolderService) signature(ctx context.Context, counts map[string]int) (string, error) {
+    if s.config.FoldersSource != FolderSourceFilesystem {
+        body, err := s.client.Do(ctx, zinc.OpFolders, http.MethodGet, "/api/index/"+s.config.IndexName(), nil)
+        if err != nil {
+            return "", err
+        }
+        var index struct {
+            Stats struct {
+                DocNum int `json:"doc_num"`
+            } `json:"stats"`
+        }
+        if err := json.Unmarshal(body, &index); err != nil {
+            return "", fmt.Errorf("error decoding index stats: %w", err)
+        }
+        return strconv.Itoa(index.Stats.DocNum), nil
+    }
+
+    baseDir, err := s.baseDir()
+    if err != nil {
+        return "", err
+    }
+    paths := make([]string, 0, len(counts)+1)
+    paths = append(paths, ".")
+    for path := range counts {
+        paths = append(paths, path)
+    }
+    sort.Strings(paths)
+
+    hash := fnv.New64a()
+    for _, path := range paths {
+        if err := ctx.Err(); err != nil {
+            return "", err
+        }
+        if info, err := os.Stat(filepath.Join(baseDir, filepath.FromSlash(path))); err != nil {
+            fmt.Fprintf(hash, "%s:missing\n", path)
+        } else {
+            fmt.Fprintf(hash, "%s:%d\n", path, info.ModTime().UnixNano())
+        }
+    }
+    return fmt.Sprintf("%x", hash.Sum64()), nil
+}
+
+// buildFolderTree arma el árbol a partir del número de correos de cada ruta. Las rutas fuera del
+// alcance se descartan antes de sumar, así que los totales solo cuentan correos visibles.
+func buildFolderTree(counts map[string]int, scope acl.Scope) *models.FolderNode {
+    root := &models.FolderNode{}
+    for path, count := range counts {
+        custodian, folder, _ := strings.Cut(path, "/")
+        if custodian == "" || !scope.AllowsFolder(custodian, folder) {
+            continue
+        }
+        node := root
+        node.Total += count
+        for _, name := range strings.Split(path, "/") {
+            node = folderChild(node, name)
+            node.Total += count
+        }
+        node.Count += count
+    }
+    sortFolderTree(root)
+    return root
+}
+
+func folderChild(node *models.FolderNode, name string) *models.FolderNode {
+    for _, child := range node.Children {
+        if child.Name == name {
+            return child
+        }
+    }
+    path := name
+    if node.Path != "" {
+        path = node.Path + "/" + name
+    }
+    child := &models.FolderNode{Name: name, Path: path}
+    node.Children = append(node.Children, child)
+    node.HasChildren = true
+    return child
+}
+
+func sortFolderTree(node *models.FolderNode) {
+    sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].Name < node.Children[j].Name })
+    for _, child := range node.Children {
+        sortFolderTree(child)
+    }
+}
+
+// indexCounts agrega folder_path en ZincSearch: cada bucket es una carpeta con su número de
+// correos. Las carpetas que solo contienen subcarpetas no aparecen, buildFolderTree las crea.
+func (s *FolderService) indexCounts(ctx context.Context) (map[string]int, error) {
+    buckets, err := s.folderBuckets(ctx, s.config.FoldersMaxBuckets)
+    if err != nil {
+        return nil, err
+    }
+    if len(buckets) >= s.config.FoldersMaxBuckets {
+        slog.WarnContext(ctx, "folder aggregation truncated; raise folders.max_buckets", "buckets", len(buckets))
+    }
+    counts := make(map[string]int, len(buckets))
+    for path, count := range buckets {
+        if path = strings.Trim(path, "/"); path != "" {
+            counts[path] += count
+        }
+    }
+    return counts, nil
+}
+
+// folderBuckets devuelve los valores distintos de folder_path del índice (hasta size) con el
+// número de documentos de cada uno. Si devuelve size valores, la lista puede estar truncada.
+func (s *FolderService) folderBuckets(ctx context.Context, size int) (map[string]int, error) {
+    query := models.ZincSearchQuery{
+        SearchType: "matchall",
+        MaxResults: 0,
+        Source:     []string{},
+        Aggs: map[string]models.Aggregation{
+            "folders": {AggType: "term", Field: folderPathField, Size: size},
+        },
+    }
+    jsonQuery, err := json.Marshal(query)
+    if err != nil {
+        return nil, fmt.Errorf("error marshaling query: %w", err)
+    }
+
+    bodyBytes, err := s.client.Do(ctx, zinc.OpFolders, http.MethodPost, s.config.EndpointIndex+"/_search", jsonQuery)
+    if err != nil {
+        return nil, err
+    }
+
+    var response models.AggregationResponse
+    if err := json.Unmarshal(bodyBytes, &response); err != nil {
+        return nil, fmt.Errorf("error decoding response: %w", err)
+    }
+    buckets := response.Aggregations["folders"].Buckets
+    counts := make(map[string]int, len(buckets))
+    for _, bucket := range buckets {
+        counts[bucket.Key] = bucket.DocCount
+    }
+    return counts, nil
+}
+
+// filesystemCounts recorre la carpeta de correos y cuenta los archivos de cada carpeta, incluidas
+// las vacías. Si ctx se cancela a mitad del recorrido devuelve ctx.Err().
+func (s *FolderService) filesystemCounts(ctx context.Context) (map[string]int, error) {
+    counts := make(map[string]int)
+
+    baseDir, err := s.baseDir()
+    if err != nil {
+        slog.ErrorContext(ctx, "error obteniendo directorio de trabajo", "error", err)
+        return counts, nil
+    }
+
+    err = filepath.WalkDir(baseDir, func(path string, entry fs.DirEntry, err error) error {
+        if ctxErr := ctx.Err(); ctxErr != nil {
+            return ctxErr
+        }
+        if err != nil {
+            if path == baseDir {
+                slog.ErrorContext(ctx, "error leyendo baseDir", "dir", baseDir, "error", err)
+                return fs.SkipDir
             }
-            folders[personName] = subFolders
+            slog.WarnContext(ctx, "no se pudo leer la carpeta", "dir", path, "error", err)
+            return nil
+        }
+        dir := path
+        if !entry.IsDir() {
+            dir = filepath.Dir(path)
+        }
+        rel, err := filepath.Rel(baseDir, dir)
+        if err != nil || rel == "." {
+            return nil
+        }
+        rel = filepath.ToSlash(rel)
+        if entry.IsDir() {
+            counts[rel] += 0
+        } else if entry.Type().IsRegular() {
+            counts[rel]++
         }
+        return nil
+    })
+    return counts, err
+}
+
+// CheckSource comprueba que el origen del listado está disponible: que la agregación sobre
+// folder_path funciona en el índice, o que la carpeta de correos se puede leer. Lo usa la
+// comprobación de disponibilidad (readiness) del servidor; pide un solo bucket, así que no avisa
+// de que la lista esté truncada.
+func (s *FolderService) CheckSource(ctx context.Context) error {
+    if s.config.FoldersSource != FolderSourceFilesystem {
+        _, err := s.folderBuckets(ctx, 1)
+        return err
+    }
+    baseDir, err := s.baseDir()
+    if err != nil {
+        return err
+    }
+    if _, err := os.ReadDir(baseDir); err != nil {
+        return err
+    }
+    return nil
+}
+
+// baseDir devuelve la carpeta que contiene una subcarpeta por persona. Es folders.root o, si no
+// está configurada, la ruta histórica relativa a Backend/Server/cmd.
+func (s *FolderService) baseDir() (string, error) {
+    baseDir := s.config.FoldersRoot
+    if baseDir == "" {
+        // Obtener el directorio de trabajo actual.
+        cwd, err := os.Getwd()
+        if err != nil {
+            return "", err
+        }
+        // Si se ejecuta desde Backend/Server/cmd, sube dos niveles y entra a Indexer/enron_mail_20110402
+        baseDir = filepath.Join(cwd, "..", "..", "Indexer", "enron_mail_20110402")
+    }
+
+    // Si existe un directorio "maildir" dentro de la raíz, asumimos que es donde están los nombres.
+    // En ese caso, actualizamos la ruta base.
+    maildirPath := filepath.Join(baseDir, "maildir")
+    if info, err := os.Stat(maildirPath); err == nil && info.IsDir() {
+        baseDir = maildirPath
     }
-    return folders
-}
\ No newline at end of file
+    return baseDir, nil
+}
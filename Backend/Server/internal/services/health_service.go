@@ -0,0 +1,184 @@
+package services
+
+//Reúne las comprobaciones de disponibilidad (readiness) del servidor: que ZincSearch responde,
+//que el índice de correos existe y tiene documentos, y que el origen del listado de carpetas
+//(el índice o la carpeta de correos) está disponible.
+//Cada comprobación se informa por separado para que sea fácil ver cuál falla. Si hay un mapping
+//versionado configurado, también compara el índice con él (al arrancar y en los detalles del
+//índice).
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "server/config"
+    "server/internal/mapping"
+    "server/internal/zinc"
+)
+
+type HealthService struct {
+    config        *config.Config
+    client        *zinc.Client
+    folderService *FolderService
+    mapping       *mapping.Mapping
+    shuttingDown  atomic.Bool
+}
+
+// Check es el resultado de una comprobación individual.
+type Check struct {
+    Name     string                 `json:"name"`
+    OK       bool                   `json:"ok"`
+    Error    string                 `json:"error,omitempty"`
+    Duration string                 `json:"duration"`
+    Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// Readiness agrupa todas las comprobaciones; Ready es true solo si todas pasan.
+type Readiness struct {
+    Ready  bool    `json:"ready"`
+    Checks []Check `json:"checks"`
+}
+
+func NewHealthService(config *config.Config, client *zinc.Client, folderService *FolderService) *HealthService {
+    return &HealthService{
+        config:        config,
+        client:        client,
+        folderService: folderService,
+    }
+}
+
+// SetMapping configura el mapping con el que se compara el índice.
+func (s *HealthService) SetMapping(m *mapping.Mapping) {
+    s.mapping = m
+}
+
+// CheckMapping compara el índice con el mapping configurado.
+func (s *HealthService) CheckMapping(ctx context.Context) (mapping.Diff, error) {
+    body, err := s.client.Do(ctx, zinc.OpHealth, http.MethodGet, "/api/index/"+s.config.IndexName(), nil)
+    if err != nil {
+        if indexMissing(err) {
+            return mapping.Diff{}, fmt.Errorf("index %q does not exist", s.config.IndexName())
+        }
+        return mapping.Diff{}, err
+    }
+    var index indexInfo
+    if err := json.Unmarshal(body, &index); err != nil {
+        return mapping.Diff{}, fmt.Errorf("error decoding index mapping: %w", err)
+    }
+    return s.mapping.Compare(index.Mappings.Properties), nil
+}
+
+// indexInfo es la parte de la respuesta de /api/index/<índice> que usan las comprobaciones.
+type indexInfo struct {
+    Mappings struct {
+        Properties map[string]mapping.Property `json:"properties"`
+    } `json:"mappings"`
+    Stats struct {
+        DocNum int `json:"doc_num"`
+    } `json:"stats"`
+}
+
+// SetShuttingDown marca el servidor como en apagado: a partir de ese momento Readiness falla
+// para que el orquestador deje de enviar tráfico mientras se drenan las conexiones.
+func (s *HealthService) SetShuttingDown() {
+    s.shuttingDown.Store(true)
+}
+
+// Readiness ejecuta las comprobaciones en orden y devuelve el resultado de todas.
+func (s *HealthService) Readiness(ctx context.Context) Readiness {
+    if s.shuttingDown.Load() {
+        return Readiness{Ready: false, Checks: []Check{{Name: "shutdown", Error: "server is shutting down"}}}
+    }
+    checks := []Check{
+        runCheck("zinc", func(details map[string]interface{}) error {
+            details["breaker"] = s.client.Breaker().Status().State
+            _, err := s.client.Do(ctx, zinc.OpHealth, http.MethodGet, "/healthz", nil)
+            return err
+        }),
+        runCheck("index", func(details map[string]interface{}) error {
+            return s.checkIndex(ctx, details)
+        }),
+        runCheck("folders", func(details map[string]interface{}) error {
+            details["source"] = s.config.FoldersSource
+            if refreshedAt := s.folderService.RefreshedAt(); !refreshedAt.IsZero() {
+                details["refreshed_at"] = refreshedAt.UTC().Format(time.RFC3339)
+            }
+            return s.folderService.CheckSource(ctx)
+        }),
+    }
+
+    readiness := Readiness{Ready: true, Checks: checks}
+    for _, check := range checks {
+        if !check.OK {
+            readiness.Ready = false
+        }
+    }
+    return readiness
+}
+
+// checkIndex verifica que el índice existe y tiene al menos ReadyMinDocs documentos. Las
+// diferencias con el mapping se informan en los detalles pero no impiden estar listo.
+func (s *HealthService) checkIndex(ctx context.Context, details map[string]interface{}) error {
+    indexName := s.config.IndexName()
+    details["index"] = indexName
+
+    body, err := s.client.Do(ctx, zinc.OpHealth, http.MethodGet, "/api/index/"+indexName, nil)
+    if err != nil {
+        if indexMissing(err) {
+            return fmt.Errorf("index %q does not exist", indexName)
+        }
+        return err
+    }
+
+    var index indexInfo
+    if err := json.Unmarshal(body, &index); err != nil {
+        return fmt.Errorf("error decoding index stats: %w", err)
+    }
+
+    details["doc_count"] = index.Stats.DocNum
+    if s.mapping != nil {
+        details["mapping_version"] = s.mapping.Version
+        if diff := s.mapping.Compare(index.Mappings.Properties); !diff.Compatible() {
+            details["mapping_diff"] = diff
+        }
+    }
+    if index.Stats.DocNum < s.config.ReadyMinDocs {
+        return fmt.Errorf("index %q has %d documents, expected at least %d", indexName, index.Stats.DocNum, s.config.ReadyMinDocs)
+    }
+    return nil
+}
+
+// indexMissing indica si el error de ZincSearch significa que el índice no existe. Según la
+// versión, ZincSearch responde 404 o 400 con "index ... does not exist".
+func indexMissing(err error) bool {
+    var statusErr *zinc.StatusError
+    if !errors.As(err, &statusErr) {
+        return false
+    }
+    return statusErr.StatusCode == http.StatusNotFound ||
+        statusErr.StatusCode == http.StatusBadRequest && strings.Contains(statusErr.Body, "does not exist")
+}
+
+func runCheck(name string, fn func(details map[string]interface{}) error) Check {
+    start := time.Now()
+    details := make(map[string]interface{})
+    err := fn(details)
+
+    check := Check{
+        Name:     name,
+        OK:       err == nil,
+        Duration: time.Since(start).String(),
+    }
+    if err != nil {
+        check.Error = err.Error()
+    }
+    if len(details) > 0 {
+        check.Details = details
+    }
+    return check
+}
@@ -4,32 +4,408 @@ package services
 //Contiene la lógica de negocio para ejecutar búsquedas. A partir de la solicitud 
 //(por ejemplo, models.SearchRequest), construye la consulta en JSON, realiza la solicitud HTTP 
 //a ZincSearch, maneja la respuesta (incluyendo errores y lectura del cuerpo) y retorna 
-//los resultados al manejador.
+//los resultados al manejador. Las búsquedas normales pasan por una caché LRU en memoria y las
+//búsquedas idénticas concurrentes se agrupan en una sola llamada a ZincSearch. Si la solicitud
+//tiene un alcance restringido (acl.Scope), cada consulta lleva un filtro obligatorio por
+//custodio o carpeta y los resultados se vuelven a comprobar antes de devolverlos.
 import (
-    "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
-    "io/ioutil"
-    "log"
+    "log/slog"
     "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+    "golang.org/x/sync/singleflight"
 
     "server/config"
+    "server/internal/acl"
+    "server/internal/audit"
+    "server/internal/cache"
+    "server/internal/logging"
+    "server/internal/metrics"
     "server/internal/models"
+    "server/internal/tracing"
+    "server/internal/zinc"
+)
+
+// defaultScanPageSize es el tamaño de página usado por Scan cuando no se indica otro.
+const defaultScanPageSize = 500
+
+// scanSortFields ordena las páginas de Scan. Sin un orden estable, from/size puede repetir u
+// omitir documentos entre páginas cuando varios tienen la misma puntuación.
+var scanSortFields = []string{"_id"}
+
+var (
+    // ErrInvalidSearch indica una solicitud de búsqueda mal formada.
+    ErrInvalidSearch = errors.New("invalid search")
+    // ErrNotFound indica que el correo no existe o está fuera del alcance del usuario.
+    ErrNotFound = errors.New("not found")
 )
 
+// validField limita los nombres de campo que pueden aparecer en una consulta con filtros.
+var validField = regexp.MustCompile(`^[A-Za-z0-9_.]{1,64}$`)
+
 type SearchService struct {
     config *config.Config
-    client *http.Client
+    client *zinc.Client
+    // cache es nil si la caché está desactivada.
+    cache *cache.Cache
+    group singleflight.Group
+
+    mu           sync.RWMutex
+    indexVersion string
 }
 
-func NewSearchService(config *config.Config) *SearchService {
-    return &SearchService{
+func NewSearchService(config *config.Config, client *zinc.Client) *SearchService {
+    s := &SearchService{
         config: config,
-        client: &http.Client{},
+        client: client,
+    }
+    if config.CacheEnabled {
+        s.cache = cache.New(config.CacheMaxBytes, config.CacheTTL)
+    }
+    return s
+}
+
+// Search devuelve la respuesta de ZincSearch para req, usando la caché si está activa. Si hay
+// varias búsquedas idénticas en curso solo una llega a ZincSearch y el resto espera su
+// resultado; cada llamador deja de esperar en cuanto se cancela su propio contexto.
+func (s *SearchService) Search(ctx context.Context, req models.SearchRequest) (result []byte, err error) {
+    req.NormalizeFilters()
+    ctx, span := s.startSpan(ctx, "SearchService.Search", req)
+    defer func() {
+        // La respuesta se decodifica una sola vez, y solo si la auditoría o la traza la usan.
+        var summary *searchSummary
+        if err == nil && (span.IsRecording() || audit.Default() != nil) {
+            summary = summarize(result)
+        }
+        auditSearch(ctx, req, summary, err)
+        endSpan(span, summary, err)
+    }()
+
+    scope := acl.FromContext(ctx)
+    if err := checkScope(req, scope); err != nil {
+        return nil, err
+    }
+
+    start := time.Now()
+    if s.cache == nil {
+        defer observeSearch("search", "zinc", start)
+        return s.search(ctx, req, scope)
+    }
+
+    key := s.cacheKey(req, scope)
+    if cached, ok := s.cache.Get(key); ok {
+        span.SetAttributes(attribute.Bool("search.cache_hit", true))
+        observeSearch("search", "cache", start)
+        return cached, nil
+    }
+    span.SetAttributes(attribute.Bool("search.cache_hit", false))
+    defer observeSearch("search", "zinc", start)
+
+    // La llamada compartida no depende de la cancelación de quien la inició, para que su
+    // desconexión no haga fallar al resto; el tiempo máximo de la operación sigue aplicando.
+    results := s.group.DoChan(key, func() (interface{}, error) {
+        bodyBytes, err := s.search(context.WithoutCancel(ctx), req, scope)
+        if err == nil {
+            s.cache.Set(key, bodyBytes)
+        }
+        return bodyBytes, err
+    })
+
+    select {
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    case res := <-results:
+        if res.Err != nil {
+            return nil, res.Err
+        }
+        return res.Val.([]byte), nil
+    }
+}
+
+// search ejecuta la búsqueda directamente contra ZincSearch.
+func (s *SearchService) search(ctx context.Context, req models.SearchRequest, scope acl.Scope) ([]byte, error) {
+    query := buildQuery(req, scope)
+
+    // Convert query to JSON
+    jsonQuery, err := json.Marshal(query)
+
+    if err != nil {
+        return nil, fmt.Errorf("error marshaling query: %w", err)
+    }
+
+    // Log outgoing request. El término pasa por la política de redacción.
+    slog.DebugContext(ctx, "sending search to zinc",
+        logging.Sensitive("term", req.Term),
+        slog.String("field", query.Query.Field),
+        slog.Int("from", query.From),
+        slog.Int("size", query.MaxResults),
+    )
+
+    bodyBytes, err := s.client.Do(ctx, zinc.OpSearch, http.MethodPost, s.config.EndpointIndex+"/_search", jsonQuery)
+    if err != nil {
+        return nil, err
+    }
+
+    // Log response. Solo el tamaño: el cuerpo contiene el texto de los correos.
+    slog.DebugContext(ctx, "received search response from zinc", "bytes", len(bodyBytes))
+
+    if !scope.All {
+        return filterHits(bodyBytes, scope)
+    }
+    return bodyBytes, nil
+}
+
+// GetEmail devuelve un correo por su ID. Un correo fuera del alcance del usuario se trata
+// igual que uno inexistente, para no revelar que existe.
+func (s *SearchService) GetEmail(ctx context.Context, id string) (hit *models.Hit, err error) {
+    ctx, span := tracing.Tracer().Start(ctx, "SearchService.GetEmail", trace.WithAttributes(
+        attribute.String("zinc.index", s.config.IndexName()),
+    ))
+    defer span.End()
+    defer func() {
+        hits := 0
+        if hit != nil {
+            hits = 1
+        }
+        audit.Record(ctx, audit.Event{
+            Action:      audit.ActionView,
+            Outcome:     audit.Outcome(err, acl.ErrNoAccess, ErrNotFound),
+            Hits:        hits,
+            DocumentIDs: []string{id},
+        })
+    }()
+
+    scope := acl.FromContext(ctx)
+    if scope.Empty() {
+        return nil, acl.ErrNoAccess
+    }
+
+    bodyBytes, err := s.client.Do(ctx, zinc.OpSearch, http.MethodGet, s.config.EndpointIndex+"/_doc/"+url.PathEscape(id), nil)
+    var statusErr *zinc.StatusError
+    if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+        return nil, err
+    }
+
+    var doc models.Hit
+    if err := json.Unmarshal(bodyBytes, &doc); err != nil {
+        return nil, fmt.Errorf("error decoding response: %w", err)
+    }
+    if doc.ID == "" {
+        doc.ID = id
+    }
+    if !scope.AllowsPath(doc.Source.Folder) {
+        slog.InfoContext(ctx, "email outside the caller's scope", "id", id)
+        return nil, ErrNotFound
+    }
+    return &doc, nil
+}
+
+// Scan recorre todas las páginas de resultados de una búsqueda y entrega cada página a fn.
+// Solo se mantiene una página en memoria a la vez, por lo que sirve para exportar conjuntos
+// de resultados completos. Cada página tiene su propio tiempo máximo (el de exportación); la
+// búsqueda completa se detiene si ctx se cancela o si fn devuelve un error.
+func (s *SearchService) Scan(ctx context.Context, req models.SearchRequest, pageSize int, fn func([]models.Hit) error) (err error) {
+    req.NormalizeFilters()
+    ctx, span := s.startSpan(ctx, "SearchService.Scan", req)
+    pages, total := 0, 0
+    defer func() {
+        span.SetAttributes(attribute.Int("search.pages", pages), attribute.Int("search.hits", total))
+        endSpan(span, nil, err)
+    }()
+
+    scope := acl.FromContext(ctx)
+    if err := checkScope(req, scope); err != nil {
+        return err
+    }
+
+    if pageSize <= 0 {
+        pageSize = defaultScanPageSize
+    }
+    req.From = 0
+    req.Size = pageSize
+
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+
+        query := buildQuery(req, scope)
+        query.SortFields = scanSortFields
+        jsonQuery, err := json.Marshal(query)
+        if err != nil {
+            return fmt.Errorf("error marshaling query: %w", err)
+        }
+
+        pageStart := time.Now()
+        bodyBytes, err := s.client.Do(ctx, zinc.OpExport, http.MethodPost, s.config.EndpointIndex+"/_search", jsonQuery)
+        observeSearch("export_page", "zinc", pageStart)
+        if err != nil {
+            return err
+        }
+
+        var page models.ZincSearchResponse
+        if err := json.Unmarshal(bodyBytes, &page); err != nil {
+            return fmt.Errorf("error decoding response: %w", err)
+        }
+
+        pages++
+        total = page.Hits.Total.Value
+        hits := page.Hits.Hits
+        if len(hits) == 0 {
+            return nil
+        }
+        req.From += len(hits)
+        if !scope.All {
+            hits = allowedHits(hits, scope)
+        }
+        if err := fn(hits); err != nil {
+            return err
+        }
+
+        if len(page.Hits.Hits) < pageSize || req.From >= page.Hits.Total.Value {
+            return nil
+        }
     }
 }
 
-func (s *SearchService) Search(req models.SearchRequest) ([]byte, error) {
+// SetIndexVersion registra la versión del índice informada por el indexador. Si cambia, la
+// caché se vacía porque sus resultados pueden estar desactualizados. Devuelve si hubo cambio.
+func (s *SearchService) SetIndexVersion(version string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if version == s.indexVersion {
+        return false
+    }
+    s.indexVersion = version
+    if s.cache != nil {
+        s.cache.Purge()
+    }
+    return true
+}
+
+func (s *SearchService) IndexVersion() string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.indexVersion
+}
+
+// CacheStats devuelve las estadísticas de la caché; el segundo valor es false si está desactivada.
+func (s *SearchService) CacheStats() (cache.Stats, bool) {
+    if s.cache == nil {
+        return cache.Stats{}, false
+    }
+    return s.cache.Stats(), true
+}
+
+// cacheKey normaliza la solicitud para que búsquedas equivalentes compartan entrada: se
+// aplica el campo por defecto y se ignoran los espacios sobrantes del término. El alcance forma
+// parte de la clave para que nadie reciba resultados cacheados de otro alcance.
+func (s *SearchService) cacheKey(req models.SearchRequest, scope acl.Scope) string {
+    req.Term = strings.Join(strings.Fields(req.Term), " ")
+    req.Field = strings.ToLower(strings.TrimSpace(req.Field))
+    jsonQuery, _ := json.Marshal(buildQuery(req, scope))
+    return s.IndexVersion() + "|" + scope.Key() + "|" + string(jsonQuery)
+}
+
+// startSpan abre un span del servicio con los atributos comunes de la búsqueda. El término no
+// se incluye para no filtrar contenido de los correos en las trazas.
+func (s *SearchService) startSpan(ctx context.Context, name string, req models.SearchRequest) (context.Context, trace.Span) {
+    field := req.Field
+    if field == "" {
+        field = "body"
+    }
+    return tracing.Tracer().Start(ctx, name, trace.WithAttributes(
+        attribute.String("search.type", "match"),
+        attribute.String("search.field", field),
+        attribute.String("zinc.index", s.config.IndexName()),
+    ))
+}
+
+// searchSummary es lo que la auditoría y las trazas necesitan de una respuesta: el total y los
+// IDs. Al decodificar en esta estructura se omite el _source de cada correo.
+type searchSummary struct {
+    Hits struct {
+        Total struct {
+            Value int `json:"value"`
+        } `json:"total"`
+        Hits []struct {
+            ID string `json:"_id"`
+        } `json:"hits"`
+    } `json:"hits"`
+}
+
+// summarize devuelve el resumen de una respuesta de búsqueda, o nil si no se puede decodificar.
+func summarize(result []byte) *searchSummary {
+    var summary searchSummary
+    if json.Unmarshal(result, &summary) != nil {
+        return nil
+    }
+    return &summary
+}
+
+// endSpan añade el número de resultados (si hay resumen) y el error, y cierra el span.
+func endSpan(span trace.Span, summary *searchSummary, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    } else if summary != nil && span.IsRecording() {
+        span.SetAttributes(
+            attribute.Int("search.hits", summary.Hits.Total.Value),
+            attribute.Int("search.returned", len(summary.Hits.Hits)),
+        )
+    }
+    span.End()
+}
+
+// auditSearch registra la búsqueda con el número de resultados y los IDs devueltos.
+func auditSearch(ctx context.Context, req models.SearchRequest, summary *searchSummary, err error) {
+    if audit.Default() == nil {
+        return
+    }
+    field := req.Field
+    if field == "" {
+        field = "body"
+    }
+    event := audit.Event{
+        Action:  audit.ActionSearch,
+        Outcome: audit.Outcome(err, acl.ErrNoAccess, ErrNotFound),
+        Query: &audit.Query{Term: audit.NormalizeTerm(req.Term), Field: field, Custodian: req.Custodian,
+            FolderPath: req.FolderPath, From: req.From, Size: req.Size},
+    }
+    if summary != nil {
+        event.Hits = summary.Hits.Total.Value
+        for _, hit := range summary.Hits.Hits {
+            event.DocumentIDs = append(event.DocumentIDs, hit.ID)
+        }
+    }
+    audit.Record(ctx, event)
+}
+
+func observeSearch(kind, source string, start time.Time) {
+    metrics.SearchDuration.WithLabelValues(kind, source).Observe(time.Since(start).Seconds())
+}
+
+// buildQuery traduce la solicitud del cliente a la consulta que entiende ZincSearch. Con un
+// alcance restringido o con filtros exactos la búsqueda se expresa como querystring para poder
+// añadir las cláusulas obligatorias de custodios y carpetas.
+func buildQuery(req models.SearchRequest, scope acl.Scope) models.ZincSearchQuery {
     if req.Field == "" {
         req.Field = "body"
     }
@@ -42,48 +418,110 @@ func (s *SearchService) Search(req models.SearchRequest) ([]byte, error) {
         },
         From:       req.From,
         MaxResults: req.Size,
-        Source:     []string{"subject", "from", "to", "date", "body", "message_id", "folder"},
+        Source: []string{"subject", "from", "to", "date", "body", "message_id", "folder",
+            "custodian", "folder_path", "folder_leaf", "file_name"},
     }
+    if !scope.All || req.HasFilters() {
+        query.SearchType = "querystring"
+        query.Query = models.Query{Term: scopedQueryString(req, scope)}
+    }
+    return query
+}
 
-    // Convert query to JSON
-    jsonQuery, err := json.Marshal(query)
-
-    if err != nil {
-        return nil, fmt.Errorf("error marshaling query: %w", err)
+// scopedQueryString combina el término del usuario (escapado, para que no pueda alterar la
+// consulta) con los filtros exactos de la solicitud sobre los campos keyword custodian y
+// folder_path y, si el alcance está restringido, con una cláusula obligatoria que exige que el
+// correo sea de alguno de los custodios permitidos o esté en alguna de las carpetas permitidas
+// o sus subcarpetas. Ambas usan los mismos campos keyword que los filtros.
+func scopedQueryString(req models.SearchRequest, scope acl.Scope) string {
+    var clauses []string
+    if term := strings.TrimSpace(req.Term); term != "" && term != "*" {
+        clauses = append(clauses, "+"+req.Field+":("+escapeQueryString(term)+")")
+    }
+    if req.Custodian != "" {
+        clauses = append(clauses, "+custodian:"+quotePhrase(req.Custodian))
+    }
+    if req.FolderPath != "" {
+        clauses = append(clauses, "+folder_path:"+quotePhrase(req.FolderPath))
     }
 
-    // Log outgoing request
-    log.Printf("Sending request to ZincSearch: %s", string(jsonQuery))
+    if !scope.All {
+        var paths []string
+        for _, custodian := range scope.Custodians {
+            paths = append(paths, "custodian:"+quotePhrase(custodian))
+        }
+        for _, folder := range scope.Folders {
+            paths = append(paths, "folder_path:"+quotePhrase(folder), "folder_path:"+escapeQueryString(folder+"/")+"*")
+        }
+        clauses = append(clauses, "+("+strings.Join(paths, " ")+")")
+    }
+    return strings.Join(clauses, " ")
+}
 
-    request, err := http.NewRequest("POST", s.config.ZincSearchURL+s.config.EndpointIndex+"/_search", bytes.NewBuffer(jsonQuery))
-    if err != nil {
-        return nil, fmt.Errorf("error creating request: %w", err)
+// checkScope rechaza las búsquedas de usuarios sin buzones asignados y, cuando la búsqueda se
+// expresa como querystring, los nombres de campo que no se pueden usar en ella con seguridad.
+func checkScope(req models.SearchRequest, scope acl.Scope) error {
+    if scope.Empty() {
+        return acl.ErrNoAccess
+    }
+    if (!scope.All || req.HasFilters()) && req.Field != "" && !validField.MatchString(req.Field) {
+        return fmt.Errorf("%w: invalid field %q", ErrInvalidSearch, req.Field)
     }
+    return nil
+}
 
-    request.SetBasicAuth(s.config.ZincSearchUser, s.config.ZincSearchPassword)
-    request.Header.Set("Content-Type", "application/json")
+var queryStringEscaper = strings.NewReplacer(
+    `\`, `\\`, `+`, `\+`, `-`, `\-`, `=`, `\=`, `&`, `\&`, `|`, `\|`, `>`, `\>`, `<`, `\<`,
+    `!`, `\!`, `(`, `\(`, `)`, `\)`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`, `^`, `\^`,
+    `"`, `\"`, `~`, `\~`, `*`, `\*`, `?`, `\?`, `:`, `\:`, `/`, `\/`,
+)
 
-    response, err := s.client.Do(request)
-    if err != nil {
-        return nil, fmt.Errorf("error executing request: %w", err)
-    }
-    defer response.Body.Close()
+func escapeQueryString(term string) string {
+    return queryStringEscaper.Replace(term)
+}
+
+func quotePhrase(phrase string) string {
+    return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(phrase) + `"`
+}
 
-    // Check response status
-    if response.StatusCode != http.StatusOK {
-        bodyBytes, _ := ioutil.ReadAll(response.Body)
-        return nil, fmt.Errorf("zinc search error: status=%d body=%s", 
-            response.StatusCode, string(bodyBytes))
+// filterHits quita de una respuesta de ZincSearch los correos fuera del alcance. El filtro de
+// la consulta ya los excluye; esto es una segunda comprobación sobre la ruta del archivo.
+func filterHits(body []byte, scope acl.Scope) ([]byte, error) {
+    var response map[string]json.RawMessage
+    var hits map[string]json.RawMessage
+    var list []json.RawMessage
+    if err := json.Unmarshal(body, &response); err != nil {
+        return nil, fmt.Errorf("error decoding response: %w", err)
+    }
+    if err := json.Unmarshal(response["hits"], &hits); err != nil {
+        return nil, fmt.Errorf("error decoding response: %w", err)
+    }
+    if err := json.Unmarshal(hits["hits"], &list); err != nil {
+        return nil, fmt.Errorf("error decoding response: %w", err)
     }
 
-    // Read response body
-    bodyBytes, err := ioutil.ReadAll(response.Body)
-    if err != nil {
-        return nil, fmt.Errorf("error reading response: %w", err)
+    kept := list[:0]
+    for _, raw := range list {
+        var hit models.Hit
+        if json.Unmarshal(raw, &hit) == nil && scope.AllowsPath(hit.Source.Folder) {
+            kept = append(kept, raw)
+        }
+    }
+    if len(kept) == len(list) {
+        return body, nil
     }
 
-    // Log response
-    log.Printf("Received response from ZincSearch: %s", string(bodyBytes))
+    hits["hits"], _ = json.Marshal(kept)
+    response["hits"], _ = json.Marshal(hits)
+    return json.Marshal(response)
+}
 
-    return bodyBytes, nil
-}
\ No newline at end of file
+func allowedHits(hits []models.Hit, scope acl.Scope) []models.Hit {
+    kept := hits[:0]
+    for _, hit := range hits {
+        if scope.AllowsPath(hit.Source.Folder) {
+            kept = append(kept, hit)
+        }
+    }
+    return kept
+}
@@ -0,0 +1,100 @@
+package tracing
+
+//Configura OpenTelemetry para el servidor: el proveedor de trazas, el propagador W3C
+//(traceparent/tracestate) y el exportador elegido en la configuración. Con "stdout" o "file"
+//las trazas se escriben como JSON y se pueden revisar localmente sin infraestructura extra;
+//con "otlp" se envían por HTTP a un colector (OTEL_EXPORTER_OTLP_ENDPOINT).
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+
+    "server/config"
+)
+
+const instrumentationName = "server"
+
+// Exportadores soportados.
+const (
+    ExporterNone   = "none"
+    ExporterStdout = "stdout"
+    ExporterFile   = "file"
+    ExporterOTLP   = "otlp"
+)
+
+// Tracer devuelve el tracer del servidor. Si el tracing está desactivado es un tracer no-op,
+// así que el código instrumentado no necesita comprobarlo.
+func Tracer() trace.Tracer {
+    return otel.Tracer(instrumentationName)
+}
+
+// Setup instala el proveedor de trazas global y el propagador W3C. Devuelve la función que
+// vacía y cierra el exportador; debe llamarse al apagar el servidor.
+func Setup(ctx context.Context, config *config.Config) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+        propagation.TraceContext{},
+        propagation.Baggage{},
+    ))
+
+    exporter, closer, err := newExporter(ctx, config)
+    if err != nil {
+        return nil, err
+    }
+    if exporter == nil {
+        return func(context.Context) error { return nil }, nil
+    }
+
+    res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+        attribute.String("service.name", config.TracingServiceName),
+    ))
+    if err != nil {
+        return nil, fmt.Errorf("error creating trace resource: %w", err)
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+        sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+    )
+    otel.SetTracerProvider(provider)
+
+    return func(ctx context.Context) error {
+        err := provider.Shutdown(ctx)
+        if closer != nil {
+            closer.Close()
+        }
+        return err
+    }, nil
+}
+
+func newExporter(ctx context.Context, config *config.Config) (sdktrace.SpanExporter, io.Closer, error) {
+    switch config.TracingExporter {
+    case "", ExporterNone:
+        return nil, nil, nil
+    case ExporterStdout:
+        exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+        return exporter, nil, err
+    case ExporterFile:
+        f, err := os.OpenFile(config.TracingFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+        if err != nil {
+            return nil, nil, fmt.Errorf("error opening trace file: %w", err)
+        }
+        exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+        return exporter, f, err
+    case ExporterOTLP:
+        // El endpoint y las cabeceras se toman de las variables OTEL_EXPORTER_OTLP_*.
+        exporter, err := otlptracehttp.New(ctx)
+        return exporter, nil, err
+    }
+    return nil, nil, fmt.Errorf("unknown tracing exporter %q", config.TracingExporter)
+}
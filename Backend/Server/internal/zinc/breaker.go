@@ -0,0 +1,142 @@
+package zinc
+
+//Implementa un circuit breaker sencillo para las llamadas a ZincSearch. Tras varios fallos
+//consecutivos el circuito se abre y las llamadas fallan de inmediato durante un tiempo de
+//espera; después se deja pasar una única llamada de prueba que decide si se vuelve a cerrar.
+import (
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// Estados del circuit breaker.
+const (
+    StateClosed   = "closed"
+    StateOpen     = "open"
+    StateHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen se devuelve (envuelto en CircuitOpenError) mientras el circuito está abierto.
+var ErrCircuitOpen = errors.New("zinc circuit breaker is open")
+
+// CircuitOpenError indica cuánto falta para que el breaker vuelva a dejar pasar llamadas.
+type CircuitOpenError struct {
+    RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+    return fmt.Sprintf("%v: retry after %s", ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+    return ErrCircuitOpen
+}
+
+// outcome es el resultado de una llamada desde el punto de vista del breaker.
+type outcome int
+
+const (
+    outcomeSuccess outcome = iota
+    outcomeFailure
+    // outcomeIgnored se usa para errores que no dicen nada de la salud de ZincSearch,
+    // como una cancelación del cliente o un 4xx.
+    outcomeIgnored
+)
+
+type Breaker struct {
+    mu        sync.Mutex
+    threshold int
+    cooldown  time.Duration
+
+    state               string
+    consecutiveFailures int
+    openedAt            time.Time
+    probing             bool
+    lastError           string
+}
+
+// BreakerStatus es la foto del breaker que se expone en el endpoint de salud.
+type BreakerStatus struct {
+    State               string    `json:"state"`
+    ConsecutiveFailures int       `json:"consecutive_failures"`
+    Threshold           int       `json:"threshold"`
+    OpenedAt            time.Time `json:"opened_at,omitempty"`
+    RetryAfterSeconds   int       `json:"retry_after_seconds,omitempty"`
+    LastError           string    `json:"last_error,omitempty"`
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+    if threshold <= 0 {
+        threshold = 1
+    }
+    return &Breaker{threshold: threshold, cooldown: cooldown, state: StateClosed}
+}
+
+// allow decide si una llamada puede salir. En half-open solo se permite una prueba a la vez.
+func (b *Breaker) allow() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    switch b.state {
+    case StateOpen:
+        if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+            return &CircuitOpenError{RetryAfter: wait}
+        }
+        b.state = StateHalfOpen
+        b.probing = true
+        return nil
+    case StateHalfOpen:
+        if b.probing {
+            return &CircuitOpenError{RetryAfter: time.Second}
+        }
+        b.probing = true
+    }
+    return nil
+}
+
+// record registra el resultado de una llamada autorizada por allow.
+func (b *Breaker) record(result outcome, err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    wasProbe := b.state == StateHalfOpen
+    b.probing = false
+
+    switch result {
+    case outcomeSuccess:
+        b.state = StateClosed
+        b.consecutiveFailures = 0
+    case outcomeFailure:
+        b.consecutiveFailures++
+        if err != nil {
+            b.lastError = err.Error()
+        }
+        if wasProbe || b.consecutiveFailures >= b.threshold {
+            b.state = StateOpen
+            b.openedAt = time.Now()
+        }
+    }
+}
+
+// Status devuelve el estado actual del breaker.
+func (b *Breaker) Status() BreakerStatus {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    status := BreakerStatus{
+        State:               b.state,
+        ConsecutiveFailures: b.consecutiveFailures,
+        Threshold:           b.threshold,
+        LastError:           b.lastError,
+    }
+    if b.state != StateClosed {
+        status.OpenedAt = b.openedAt
+    }
+    if b.state == StateOpen {
+        if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+            status.RetryAfterSeconds = int(wait.Seconds() + 0.999)
+        }
+    }
+    return status
+}
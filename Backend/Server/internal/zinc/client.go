@@ -0,0 +1,328 @@
+package zinc
+
+//Cliente HTTP compartido para hablar con ZincSearch. Centraliza la autenticación, el transporte
+//(pool de conexiones y keep-alive), los tiempos máximos de cada tipo de operación, los
+//reintentos de lecturas y el circuit breaker, de forma que los servicios solo construyen la
+//consulta y pasan el contexto que reciben del handler.
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "math/rand"
+    "net"
+    "net/http"
+    "strconv"
+    "time"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
+
+    "server/config"
+    "server/internal/logging"
+    "server/internal/metrics"
+    "server/internal/tracing"
+)
+
+// Operation identifica el tipo de llamada para elegir su tiempo máximo.
+type Operation string
+
+const (
+    OpSearch  Operation = "search"
+    OpExport  Operation = "export"
+    OpHealth  Operation = "health"
+    OpFolders Operation = "folders"
+    // OpAudit escribe eventos de auditoría; usa el tiempo máximo por defecto y no se reintenta.
+    OpAudit Operation = "audit"
+)
+
+// idempotent indica si la operación es una lectura que se puede reintentar sin efectos
+// secundarios. Todas las búsquedas lo son aunque usen POST.
+func (op Operation) idempotent() bool {
+    switch op {
+    case OpSearch, OpExport, OpHealth, OpFolders:
+        return true
+    }
+    return false
+}
+
+type Client struct {
+    baseURL    string
+    user       string
+    password   string
+    httpClient *http.Client
+    timeouts   map[Operation]time.Duration
+    // defaultTimeout se aplica a las operaciones sin un tiempo propio.
+    defaultTimeout time.Duration
+
+    maxRetries   int
+    retryBackoff time.Duration
+    maxBackoff   time.Duration
+    breaker      *Breaker
+}
+
+// StatusError se devuelve cuando ZincSearch responde con un código distinto de 200.
+type StatusError struct {
+    StatusCode int
+    Body       string
+}
+
+// Error aplica la política de redacción al cuerpo, porque el mensaje acaba en los logs.
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("zinc search error: status=%d body=%s", e.StatusCode, logging.Redact(e.Body))
+}
+
+// NewClient crea el cliente con la configuración de ZincSearch. transport permite usar otro
+// RoundTripper (por ejemplo, un mock en los tests); si es nil se usa NewTransport.
+func NewClient(config *config.Config, transport http.RoundTripper) *Client {
+    if transport == nil {
+        transport = NewTransport(config)
+    }
+    return &Client{
+        baseURL:  config.ZincSearchURL,
+        user:     config.ZincSearchUser,
+        password: config.ZincSearchPassword,
+        httpClient: &http.Client{
+            Transport: transport,
+        },
+        timeouts: map[Operation]time.Duration{
+            OpSearch:  config.ZincTimeoutSearch,
+            OpExport:  config.ZincTimeoutExport,
+            OpHealth:  config.ZincTimeoutHealth,
+            OpFolders: config.ZincTimeoutFolders,
+        },
+        defaultTimeout: config.ZincTimeoutSearch,
+        maxRetries:     config.ZincRetryMax,
+        retryBackoff:   config.ZincRetryBackoff,
+        maxBackoff:     config.ZincRetryMaxBackoff,
+        breaker:        NewBreaker(config.ZincBreakerThreshold, config.ZincBreakerCooldown),
+    }
+}
+
+// NewTransport devuelve el transporte ajustado para ZincSearch. Parte de http.DefaultTransport
+// para conservar la configuración de proxy del proceso.
+func NewTransport(config *config.Config) *http.Transport {
+    base, ok := http.DefaultTransport.(*http.Transport)
+    if !ok {
+        base = &http.Transport{Proxy: http.ProxyFromEnvironment, ForceAttemptHTTP2: true}
+    }
+
+    transport := base.Clone()
+    transport.DialContext = (&net.Dialer{
+        Timeout:   config.ZincDialTimeout,
+        KeepAlive: config.ZincKeepAlive,
+    }).DialContext
+    transport.MaxIdleConns = config.ZincMaxIdleConns
+    transport.MaxIdleConnsPerHost = config.ZincMaxIdleConnsPerHost
+    transport.IdleConnTimeout = config.ZincIdleConnTimeout
+    transport.TLSHandshakeTimeout = config.ZincDialTimeout
+    return transport
+}
+
+// Timeout devuelve el tiempo máximo configurado para la operación.
+func (c *Client) Timeout(op Operation) time.Duration {
+    if timeout, ok := c.timeouts[op]; ok && timeout > 0 {
+        return timeout
+    }
+    return c.defaultTimeout
+}
+
+// WithOwnBreaker devuelve una copia del cliente que comparte el transporte y la configuración
+// pero tiene un circuit breaker propio, para usos secundarios (como la auditoría) cuyos fallos
+// no deben cortar las búsquedas.
+func (c *Client) WithOwnBreaker() *Client {
+    clone := *c
+    clone.breaker = NewBreaker(c.breaker.threshold, c.breaker.cooldown)
+    return &clone
+}
+
+// Breaker devuelve el circuit breaker del cliente, para exponer su estado.
+func (c *Client) Breaker() *Breaker {
+    return c.breaker
+}
+
+// Do ejecuta una llamada a ZincSearch con el tiempo máximo de op y devuelve el cuerpo de la
+// respuesta. El plazo cubre también los reintentos. Si ctx se cancela o vence el plazo, el
+// error envuelve ctx.Err(), así que puede comprobarse con errors.Is(err, context.DeadlineExceeded).
+// Mientras el circuito está abierto devuelve un *CircuitOpenError sin contactar a ZincSearch.
+func (c *Client) Do(ctx context.Context, op Operation, method, path string, body []byte) (_ []byte, err error) {
+    ctx, span := tracing.Tracer().Start(ctx, "zinc."+string(op),
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(
+            attribute.String("zinc.operation", string(op)),
+            attribute.String("http.request.method", method),
+            attribute.String("url.path", path),
+        ),
+    )
+    defer func() {
+        if err != nil {
+            span.RecordError(err)
+            span.SetStatus(codes.Error, errorReason(err))
+        }
+        span.End()
+    }()
+
+    if timeout := c.Timeout(op); timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+
+    attempts := 1
+    if op.idempotent() {
+        attempts += c.maxRetries
+    }
+
+    var lastErr error
+    for attempt := 0; attempt < attempts; attempt++ {
+        if attempt > 0 {
+            metrics.ZincRetries.WithLabelValues(string(op)).Inc()
+            span.AddEvent("retry", trace.WithAttributes(
+                attribute.Int("attempt", attempt+1),
+                attribute.String("previous_error", lastErr.Error()),
+            ))
+            if err := sleepContext(ctx, c.backoff(attempt)); err != nil {
+                return nil, fmt.Errorf("retry aborted after %v: %w", lastErr, err)
+            }
+        }
+
+        if err := c.breaker.allow(); err != nil {
+            metrics.ZincErrors.WithLabelValues(string(op), "circuit_open").Inc()
+            return nil, err
+        }
+        start := time.Now()
+        bodyBytes, err := c.do(ctx, method, path, body)
+        c.breaker.record(classify(ctx, err), err)
+        observe(op, start, err)
+        if err == nil {
+            return bodyBytes, nil
+        }
+
+        lastErr = err
+        if !retryable(ctx, err) {
+            break
+        }
+    }
+    return nil, lastErr
+}
+
+// do realiza un único intento de la llamada.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+    var reader io.Reader
+    if body != nil {
+        reader = bytes.NewReader(body)
+    }
+    request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+    if err != nil {
+        return nil, fmt.Errorf("error creating request: %w", err)
+    }
+
+    request.SetBasicAuth(c.user, c.password)
+    request.Header.Set("Content-Type", "application/json")
+    otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+    response, err := c.httpClient.Do(request)
+    if err != nil {
+        return nil, fmt.Errorf("error executing request: %w", err)
+    }
+    defer response.Body.Close()
+    trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+
+    // Check response status
+    if response.StatusCode != http.StatusOK {
+        bodyBytes, _ := io.ReadAll(response.Body)
+        return nil, &StatusError{StatusCode: response.StatusCode, Body: string(bodyBytes)}
+    }
+
+    // Read response body
+    bodyBytes, err := io.ReadAll(response.Body)
+    if err != nil {
+        return nil, fmt.Errorf("error reading response: %w", err)
+    }
+    return bodyBytes, nil
+}
+
+
+// backoff calcula la espera antes del intento indicado: exponencial con jitter y con tope.
+func (c *Client) backoff(attempt int) time.Duration {
+    wait := c.retryBackoff << (attempt - 1)
+    if wait <= 0 || wait > c.maxBackoff {
+        wait = c.maxBackoff
+    }
+    return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// observe registra la latencia del intento y, si falló, el motivo.
+func observe(op Operation, start time.Time, err error) {
+    result := "ok"
+    if err != nil {
+        result = "error"
+        metrics.ZincErrors.WithLabelValues(string(op), errorReason(err)).Inc()
+    }
+    metrics.ZincDuration.WithLabelValues(string(op), result).Observe(time.Since(start).Seconds())
+}
+
+// errorReason resume un error en una etiqueta de cardinalidad baja para las métricas.
+func errorReason(err error) string {
+    var statusErr *StatusError
+    switch {
+    case errors.As(err, &statusErr):
+        return "status_" + strconv.Itoa(statusErr.StatusCode)
+    case errors.Is(err, ErrCircuitOpen):
+        return "circuit_open"
+    case errors.Is(err, context.DeadlineExceeded):
+        return "timeout"
+    case errors.Is(err, context.Canceled):
+        return "canceled"
+    }
+    return "network"
+}
+
+// classify traduce el resultado de un intento a lo que le importa al breaker.
+func classify(ctx context.Context, err error) outcome {
+    if err == nil {
+        return outcomeSuccess
+    }
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        if statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests {
+            return outcomeFailure
+        }
+        return outcomeIgnored
+    }
+    if errors.Is(err, context.Canceled) && ctx.Err() == context.Canceled {
+        return outcomeIgnored
+    }
+    return outcomeFailure
+}
+
+// retryable indica si merece la pena repetir la llamada tras err.
+func retryable(ctx context.Context, err error) bool {
+    if ctx.Err() != nil {
+        return false
+    }
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        switch statusErr.StatusCode {
+        case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+            return true
+        }
+        return false
+    }
+    return true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
\ No newline at end of file
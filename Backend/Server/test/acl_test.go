@@ -0,0 +1,156 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/config"
+    "server/internal/acl"
+    "server/internal/auth"
+    "server/internal/handlers"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+// QueryCaptureTransport guarda el cuerpo de cada consulta y responde con un cuerpo fijo.
+type QueryCaptureTransport struct {
+    body    string
+    queries []string
+}
+
+func (q *QueryCaptureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    if req.Body != nil {
+        content, _ := io.ReadAll(req.Body)
+        q.queries = append(q.queries, string(content))
+    }
+    return &http.Response{
+        StatusCode: 200,
+        Body:       ioutil.NopCloser(bytes.NewBufferString(q.body)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func loadTestACL(t *testing.T) *acl.Policy {
+    file := filepath.Join(t.TempDir(), "acl.yaml")
+    rules := "rules:\n  - roles: [reviewer]\n    custodians: [allen-p]\n    folders: [lay-k/inbox]\n  - subjects: [boss]\n    custodians: [\"*\"]\n"
+    if err := os.WriteFile(file, []byte(rules), 0600); err != nil {
+        t.Fatal(err)
+    }
+    policy, err := acl.Load(file)
+    if err != nil {
+        t.Fatalf("acl.Load: %v", err)
+    }
+    return policy
+}
+
+func TestACL_ScopeForPrincipal(t *testing.T) {
+    policy := loadTestACL(t)
+
+    scope := policy.ScopeFor(&auth.Principal{Subject: "ana", Roles: []string{"reviewer"}})
+    if scope.All || !scope.AllowsCustodian("allen-p") || !scope.AllowsFolder("lay-k", "inbox/2001") || scope.AllowsFolder("lay-k", "sent") {
+        t.Errorf("alcance inesperado para reviewer: %+v", scope)
+    }
+    if !scope.AllowsPath("enron_mail_20110402/maildir/allen-p/sent/1.") || scope.AllowsPath("enron_mail_20110402/maildir/skilling-j/inbox/1.") {
+        t.Errorf("AllowsPath no respeta el alcance: %+v", scope)
+    }
+    if !policy.ScopeFor(&auth.Principal{Subject: "boss"}).All {
+        t.Error("una regla con \"*\" debería dar acceso a todo")
+    }
+    if !policy.ScopeFor(&auth.Principal{Subject: "nobody"}).Empty() {
+        t.Error("un usuario sin reglas no debería ver nada")
+    }
+}
+
+func TestACL_SearchInjectsFilterAndDropsForeignHits(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("CACHE_ENABLED", "false")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("CACHE_ENABLED")
+
+    transport := &QueryCaptureTransport{body: `{"hits":{"total":{"value":2},"hits":[` +
+        `{"_id":"1","_source":{"subject":"mine","folder":"enron_mail_20110402/maildir/allen-p/inbox/1."}},` +
+        `{"_id":"2","_source":{"subject":"theirs","folder":"enron_mail_20110402/maildir/skilling-j/inbox/1."}}]}}`}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    searchService := services.NewSearchService(cfg, zinc.NewClient(cfg, transport))
+    scope := loadTestACL(t).ScopeFor(&auth.Principal{Subject: "ana", Roles: []string{"reviewer"}})
+
+    req := httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"term":"gas) OR (folder:skilling","size":5}`))
+    req = req.WithContext(acl.WithScope(req.Context(), scope))
+    recorder := httptest.NewRecorder()
+    handlers.NewSearchHandler(searchService).Handle(recorder, req)
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+
+    var query struct {
+        SearchType string `json:"search_type"`
+        Query      struct {
+            Term string `json:"term"`
+        } `json:"query"`
+    }
+    if err := json.Unmarshal([]byte(transport.queries[0]), &query); err != nil {
+        t.Fatal(err)
+    }
+    want := `+body:(gas\) OR \(folder\:skilling) +(custodian:"allen-p" folder_path:"lay-k/inbox" folder_path:lay\-k\/inbox\/*)`
+    if query.SearchType != "querystring" || query.Query.Term != want {
+        t.Errorf("consulta inesperada:\n  obtenida %s %s\n  esperada querystring %s", query.SearchType, query.Query.Term, want)
+    }
+
+    if strings.Contains(recorder.Body.String(), "theirs") || !strings.Contains(recorder.Body.String(), "mine") {
+        t.Errorf("la respuesta debería contener solo correos del alcance: %s", recorder.Body.String())
+    }
+}
+
+func TestACL_EmailFetchAndNoAccess(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    transport := &QueryCaptureTransport{body: `{"_id":"2","_source":{"subject":"theirs","folder":"enron_mail_20110402/maildir/skilling-j/inbox/1."}}`}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    searchService := services.NewSearchService(cfg, zinc.NewClient(cfg, transport))
+    policy := loadTestACL(t)
+
+    r := chi.NewRouter()
+    r.Get("/api/emails/{id}", handlers.NewEmailHandler(searchService).Handle)
+    r.Post("/api/search", handlers.NewSearchHandler(searchService).Handle)
+
+    do := func(method, path, body string, principal *auth.Principal) int {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req = req.WithContext(acl.WithScope(req.Context(), policy.ScopeFor(principal)))
+        recorder := httptest.NewRecorder()
+        r.ServeHTTP(recorder, req)
+        return recorder.Code
+    }
+
+    if code := do("GET", "/api/emails/2", "", &auth.Principal{Subject: "ana", Roles: []string{"reviewer"}}); code != http.StatusNotFound {
+        t.Errorf("correo fuera del alcance: se esperaba 404, se obtuvo %d", code)
+    }
+    if code := do("GET", "/api/emails/2", "", &auth.Principal{Subject: "boss"}); code != http.StatusOK {
+        t.Errorf("correo con acceso total: se esperaba 200, se obtuvo %d", code)
+    }
+    if code := do("POST", "/api/search", `{"term":"gas"}`, &auth.Principal{Subject: "nobody"}); code != http.StatusForbidden {
+        t.Errorf("usuario sin buzones: se esperaba 403, se obtuvo %d", code)
+    }
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "server/config"
+    "server/internal/audit"
+    "server/internal/auth"
+    "server/internal/handlers"
+    "server/internal/logging"
+    "server/internal/models"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+func TestAudit_SearchAndViewAreRecorded(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("AUDIT_FILE", filepath.Join(t.TempDir(), "audit.jsonl"))
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("AUDIT_FILE")
+
+    transport := &QueryCaptureTransport{body: `{"hits":{"total":{"value":7},"hits":[{"_id":"a1","_source":{"subject":"x"}},{"_id":"a2","_source":{"subject":"y"}}]}}`}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    client := zinc.NewClient(cfg, transport)
+    auditLog, err := audit.Setup(cfg, client)
+    if err != nil {
+        t.Fatalf("audit.Setup: %v", err)
+    }
+    defer audit.SetDefault(nil)
+    defer auditLog.Close()
+
+    searchService := services.NewSearchService(cfg, client)
+    ctx := auth.WithPrincipal(logging.WithRequestID(httptest.NewRequest("GET", "/", nil).Context(), "req-42"),
+        &auth.Principal{Subject: "alice", Method: auth.MethodAPIKey})
+
+    if _, err := searchService.Search(ctx, models.SearchRequest{Term: "  Gas   prices ", Size: 5}); err != nil {
+        t.Fatalf("Search: %v", err)
+    }
+
+    recorder := httptest.NewRecorder()
+    handlers.NewAuditHandler(auditLog).Handle(recorder, httptest.NewRequest("GET", "/api/admin/audit?principal=alice&action=search", nil))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, recorder.Code)
+    }
+    var response struct {
+        Count  int           `json:"count"`
+        Events []audit.Event `json:"events"`
+    }
+    if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if response.Count != 1 {
+        t.Fatalf("se esperaba 1 evento, se obtuvieron %d", response.Count)
+    }
+    event := response.Events[0]
+    if event.RequestID != "req-42" || event.Query.Term != "Gas prices" || event.Hits != 7 || strings.Join(event.DocumentIDs, ",") != "a1,a2" {
+        t.Errorf("evento inesperado: %+v", event)
+    }
+
+    recorder = httptest.NewRecorder()
+    handlers.NewAuditHandler(auditLog).Handle(recorder, httptest.NewRequest("GET", "/api/admin/audit?since=yesterday", nil))
+    if recorder.Code != http.StatusBadRequest {
+        t.Errorf("fecha inválida: se esperaba 400, se obtuvo %d", recorder.Code)
+    }
+}
+
+func TestAudit_FileRotation(t *testing.T) {
+    dir := t.TempDir()
+    sink, err := audit.NewFileSink(filepath.Join(dir, "audit.jsonl"), 300, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer sink.Close()
+
+    for i := 0; i < 20; i++ {
+        if err := sink.Write(context.Background(), audit.Event{Principal: "bob", Action: audit.ActionView, DocumentIDs: []string{strings.Repeat("x", 40)}}); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    files, _ := filepath.Glob(filepath.Join(dir, "audit*.jsonl"))
+    if len(files) != 3 {
+        t.Errorf("se esperaban el archivo actual y 2 copias, se encontraron %d: %v", len(files), files)
+    }
+    events, err := sink.Search(audit.Filter{Principal: "bob", Limit: 3})
+    if err != nil || len(events) != 3 {
+        t.Errorf("Search devolvió %d eventos, error %v", len(events), err)
+    }
+}
+
+// SlowAuditTransport retiene las escrituras en el índice de auditoría hasta que se cierra
+// release y entonces responde 500; el resto de llamadas responde con body.
+type SlowAuditTransport struct {
+    body    string
+    release chan struct{}
+    writes  atomic.Int32
+}
+
+func (s *SlowAuditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    status, body := http.StatusOK, s.body
+    if strings.HasPrefix(req.URL.Path, "/api/audit/") {
+        <-s.release
+        s.writes.Add(1)
+        status, body = http.StatusInternalServerError, `{"error":"down"}`
+    }
+    return &http.Response{
+        StatusCode: status,
+        Body:       io.NopCloser(bytes.NewBufferString(body)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func TestAudit_ZincSinkDoesNotBlockSearches(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("AUDIT_FILE", filepath.Join(t.TempDir(), "audit.jsonl"))
+    os.Setenv("AUDIT_ZINC_INDEX", "audit")
+    os.Setenv("CACHE_ENABLED", "false")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("AUDIT_FILE")
+    defer os.Unsetenv("AUDIT_ZINC_INDEX")
+    defer os.Unsetenv("CACHE_ENABLED")
+
+    transport := &SlowAuditTransport{body: `{"hits":{"total":{"value":1},"hits":[{"_id":"a1"}]}}`, release: make(chan struct{})}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    client := zinc.NewClient(cfg, transport)
+    auditLog, err := audit.Setup(cfg, client)
+    if err != nil {
+        t.Fatalf("audit.Setup: %v", err)
+    }
+    defer audit.SetDefault(nil)
+
+    // Con el índice de auditoría colgado, las búsquedas terminan igual.
+    searchService := services.NewSearchService(cfg, client)
+    searches := cfg.ZincBreakerThreshold + 2
+    done := make(chan error)
+    go func() {
+        for i := 0; i < searches; i++ {
+            if _, err := searchService.Search(context.Background(), models.SearchRequest{Term: "gas", Size: 1}); err != nil {
+                done <- err
+                return
+            }
+        }
+        done <- nil
+    }()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Fatalf("Search: %v", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("las búsquedas esperan a la escritura de auditoría en ZincSearch")
+    }
+
+    // Los fallos del índice de auditoría no abren el circuito de las búsquedas.
+    close(transport.release)
+    if err := auditLog.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    // El breaker propio de la auditoría se abre tras el umbral de fallos y deja de intentarlo.
+    if got := int(transport.writes.Load()); got != cfg.ZincBreakerThreshold {
+        t.Errorf("se esperaban %d escrituras de auditoría, se hicieron %d", cfg.ZincBreakerThreshold, got)
+    }
+    if state := client.Breaker().Status().State; state != zinc.StateClosed {
+        t.Errorf("el breaker de las búsquedas debería seguir cerrado, está %s", state)
+    }
+}
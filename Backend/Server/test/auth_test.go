@@ -0,0 +1,188 @@
+package main
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "github.com/golang-jwt/jwt/v5"
+
+    "server/config"
+    "server/internal/auth"
+    customMiddleware "server/internal/middleware"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+// newAuthRouter devuelve un router protegido que responde con el sujeto del principal.
+func newAuthRouter(t *testing.T, cfg *config.Config) http.Handler {
+    authenticator, err := auth.New(cfg)
+    if err != nil {
+        t.Fatalf("auth.New: %v", err)
+    }
+    r := chi.NewRouter()
+    r.Use(customMiddleware.Authenticate(authenticator))
+    r.Get("/api/whoami", func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(auth.FromContext(r.Context()).Subject))
+    })
+    return r
+}
+
+func doAuthRequest(router http.Handler, header, value string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("GET", "/api/whoami", nil)
+    if header != "" {
+        req.Header.Set(header, value)
+    }
+    recorder := httptest.NewRecorder()
+    router.ServeHTTP(recorder, req)
+    return recorder
+}
+
+func TestAuth_APIKeys(t *testing.T) {
+    router := newAuthRouter(t, &config.Config{
+        AuthEnabled: true,
+        AuthAPIKeys: []string{"frontend:" + auth.HashAPIKey("secret-key") + ":reader"},
+    })
+
+    if rec := doAuthRequest(router, "X-API-Key", "secret-key"); rec.Code != http.StatusOK || rec.Body.String() != "frontend" {
+        t.Errorf("clave válida: código %d, cuerpo %q", rec.Code, rec.Body.String())
+    }
+    if rec := doAuthRequest(router, "Authorization", "Bearer secret-key"); rec.Code != http.StatusOK {
+        t.Errorf("clave como bearer: se esperaba 200, se obtuvo %d", rec.Code)
+    }
+    if rec := doAuthRequest(router, "X-API-Key", "wrong"); rec.Code != http.StatusUnauthorized {
+        t.Errorf("clave incorrecta: se esperaba 401, se obtuvo %d", rec.Code)
+    }
+    rec := doAuthRequest(router, "", "")
+    if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+        t.Errorf("sin credenciales: se esperaba 401 con WWW-Authenticate, se obtuvo %d %v", rec.Code, rec.Header())
+    }
+}
+
+func TestAuth_JWTHS256(t *testing.T) {
+    router := newAuthRouter(t, &config.Config{
+        AuthEnabled:       true,
+        AuthJWTHMACSecret: testHMACSecret,
+        AuthJWTIssuer:     "https://issuer.test",
+        AuthJWTRolesClaim: "roles",
+    })
+
+    sign := func(claims jwt.MapClaims) string {
+        token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testHMACSecret))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return token
+    }
+
+    valid := sign(jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "exp": time.Now().Add(time.Hour).Unix()})
+    if rec := doAuthRequest(router, "Authorization", "Bearer "+valid); rec.Code != http.StatusOK || rec.Body.String() != "alice" {
+        t.Errorf("token válido: código %d, cuerpo %q", rec.Code, rec.Body.String())
+    }
+
+    expired := sign(jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "exp": time.Now().Add(-time.Hour).Unix()})
+    wrongIssuer := sign(jwt.MapClaims{"sub": "alice", "iss": "https://other.test", "exp": time.Now().Add(time.Hour).Unix()})
+    for name, token := range map[string]string{"caducado": expired, "emisor incorrecto": wrongIssuer} {
+        if rec := doAuthRequest(router, "Authorization", "Bearer "+token); rec.Code != http.StatusUnauthorized {
+            t.Errorf("token %s: se esperaba 401, se obtuvo %d", name, rec.Code)
+        }
+    }
+}
+
+func TestAuth_JWTRS256WithJWKS(t *testing.T) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+        "kty": "RSA",
+        "kid": "k1",
+        "use": "sig",
+        "n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+        "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+    }}})
+    file := filepath.Join(t.TempDir(), "jwks.json")
+    if err := os.WriteFile(file, jwks, 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    router := newAuthRouter(t, &config.Config{AuthEnabled: true, AuthJWTJWKSFile: file, AuthJWTRolesClaim: "roles"})
+
+    token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()})
+    token.Header["kid"] = "k1"
+    signed, err := token.SignedString(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if rec := doAuthRequest(router, "Authorization", "Bearer "+signed); rec.Code != http.StatusOK || rec.Body.String() != "bob" {
+        t.Errorf("token RS256: código %d, cuerpo %q", rec.Code, rec.Body.String())
+    }
+
+    // Un token HS256 firmado con la clave pública no debe aceptarse (confusión de algoritmos).
+    forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "mallory", "exp": time.Now().Add(time.Hour).Unix()}).
+        SignedString(key.N.Bytes())
+    if rec := doAuthRequest(router, "Authorization", "Bearer "+forged); rec.Code != http.StatusUnauthorized {
+        t.Errorf("token HS256 falsificado: se esperaba 401, se obtuvo %d", rec.Code)
+    }
+}
+
+func TestAuth_RequireRole(t *testing.T) {
+    ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+    do := func(router http.Handler, apiKey string) int {
+        req := httptest.NewRequest("GET", "/api/admin/audit", nil)
+        if apiKey != "" {
+            req.Header.Set("X-API-Key", apiKey)
+        }
+        recorder := httptest.NewRecorder()
+        router.ServeHTTP(recorder, req)
+        return recorder.Code
+    }
+
+    // Sin autenticación las rutas de administración no existen para nadie.
+    open := chi.NewRouter()
+    open.Use(customMiddleware.Authenticate(nil))
+    open.With(customMiddleware.RequireRole(nil, "admin")).Get("/api/admin/audit", ok)
+    if code := do(open, ""); code != http.StatusNotFound {
+        t.Errorf("sin autenticación: se esperaba 404, se obtuvo %d", code)
+    }
+
+    authenticator, err := auth.New(&config.Config{
+        AuthEnabled: true,
+        AuthAPIKeys: []string{"reader:" + auth.HashAPIKey("reader-key") + ":reader", "ops:" + auth.HashAPIKey("admin-key") + ":admin",
+            "indexer:" + auth.HashAPIKey("indexer-key") + ":indexer"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    protected := chi.NewRouter()
+    protected.Use(customMiddleware.Authenticate(authenticator))
+    protected.With(customMiddleware.RequireRole(authenticator, "admin")).Get("/api/admin/audit", ok)
+    if code := do(protected, "reader-key"); code != http.StatusForbidden {
+        t.Errorf("sin el rol: se esperaba 403, se obtuvo %d", code)
+    }
+    if code := do(protected, "admin-key"); code != http.StatusOK {
+        t.Errorf("con el rol: se esperaba 200, se obtuvo %d", code)
+    }
+    if code := do(protected, "indexer-key"); code != http.StatusForbidden {
+        t.Errorf("el rol indexer no debería dar acceso a /api/admin: se obtuvo %d", code)
+    }
+
+    // Las rutas de la caché aceptan cualquiera de los roles indicados.
+    cache := chi.NewRouter()
+    cache.Use(customMiddleware.Authenticate(authenticator))
+    cache.With(customMiddleware.RequireRole(authenticator, "admin", "indexer")).Get("/api/admin/audit", ok)
+    for key, want := range map[string]int{"reader-key": http.StatusForbidden, "admin-key": http.StatusOK, "indexer-key": http.StatusOK} {
+        if code := do(cache, key); code != want {
+            t.Errorf("con %s: se esperaba %d, se obtuvo %d", key, want, code)
+        }
+    }
+}
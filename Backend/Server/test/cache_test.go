@@ -0,0 +1,75 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync/atomic"
+    "testing"
+
+    "server/config"
+    "server/internal/handlers"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+// CountingTransport responde siempre con el mismo cuerpo y cuenta las llamadas recibidas.
+type CountingTransport struct {
+    body  string
+    calls int32
+}
+
+func (c *CountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    atomic.AddInt32(&c.calls, 1)
+    return &http.Response{
+        StatusCode: 200,
+        Body:       ioutil.NopCloser(bytes.NewBufferString(c.body)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func TestSearchCache_HitAndInvalidation(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    transport := &CountingTransport{body: `{"hits":{"hits":[],"total":{"value":0}}}`}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    searchService := services.NewSearchService(cfg, zinc.NewClient(cfg, transport))
+    searchHandler := handlers.NewSearchHandler(searchService)
+    cacheHandler := handlers.NewCacheHandler(searchService)
+
+    search := func(body string) {
+        recorder := httptest.NewRecorder()
+        searchHandler.Handle(recorder, httptest.NewRequest("POST", "/api/search", strings.NewReader(body)))
+        if recorder.Code != http.StatusOK {
+            t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, recorder.Code)
+        }
+    }
+
+    // La segunda búsqueda solo difiere en espacios y debe salir de la caché.
+    search(`{"term":"Hello world","size":5}`)
+    search(`{"term":"  Hello   world ","size":5}`)
+    if calls := atomic.LoadInt32(&transport.calls); calls != 1 {
+        t.Fatalf("Esperada 1 llamada a ZincSearch, obtenidas %d", calls)
+    }
+
+    recorder := httptest.NewRecorder()
+    cacheHandler.HandleIndexVersion(recorder, httptest.NewRequest("POST", "/api/index/version", strings.NewReader(`{"version":"v2"}`)))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, recorder.Code)
+    }
+
+    search(`{"term":"Hello world","size":5}`)
+    if calls := atomic.LoadInt32(&transport.calls); calls != 2 {
+        t.Errorf("Tras cambiar la versión del índice se esperaban 2 llamadas, obtenidas %d", calls)
+    }
+}
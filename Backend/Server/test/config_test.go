@@ -0,0 +1,113 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "server/config"
+)
+
+func TestConfig_FileEnvAndFlagPrecedence(t *testing.T) {
+    dir := t.TempDir()
+    file := filepath.Join(dir, "server.yaml")
+    content := "zinc:\n  url: http://zinc:4080\n  user: fileuser\n  timeouts:\n    search: 3s\nserver:\n  port: 9000\n"
+    if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    secret := filepath.Join(dir, "password")
+    if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    os.Setenv("ZINC_TIMEOUT_SEARCH", "4s")
+    os.Setenv("ZINC_PASSWORD_FILE", secret)
+    defer os.Unsetenv("ZINC_TIMEOUT_SEARCH")
+    defer os.Unsetenv("ZINC_PASSWORD_FILE")
+
+    cfg, err := config.Load([]string{"--config", file, "--server-port", "9100"})
+    if err != nil {
+        t.Fatalf("Load devolvió error: %v", err)
+    }
+    if cfg.ZincSearchURL != "http://zinc:4080" || cfg.ZincSearchUser != "fileuser" {
+        t.Errorf("no se aplicaron los valores del archivo: %+v", cfg)
+    }
+    if cfg.ZincTimeoutSearch != 4*time.Second {
+        t.Errorf("el entorno debería tener prioridad sobre el archivo, se obtuvo %v", cfg.ZincTimeoutSearch)
+    }
+    if cfg.ServerPort != "9100" {
+        t.Errorf("el flag debería tener prioridad sobre el archivo, se obtuvo %q", cfg.ServerPort)
+    }
+    if cfg.ZincSearchPassword != "s3cret" {
+        t.Errorf("no se leyó el secreto desde ZINC_PASSWORD_FILE: %q", cfg.ZincSearchPassword)
+    }
+
+    var out bytes.Buffer
+    if err := cfg.Print(&out); err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(out.String(), "s3cret") || !strings.Contains(out.String(), "password: '********'") {
+        t.Errorf("--print-config debería enmascarar los secretos:\n%s", out.String())
+    }
+}
+
+func TestConfig_ReportsAllErrors(t *testing.T) {
+    dir := t.TempDir()
+    file := filepath.Join(dir, "server.yaml")
+    content := "zinc:\n  url: localhost:4080\n  timeouts:\n    search: ten\nlog:\n  format: xml\nunknown_key: 1\n"
+    if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    _, err := config.Load([]string{"--config", file, "--server-port", "0"})
+    if err == nil {
+        t.Fatal("se esperaba un error de validación")
+    }
+    for _, want := range []string{"zinc.url", "zinc.timeouts.search", "log.format", "unknown_key", "server.port", "zinc.user", "zinc.password"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("el error no menciona %s:\n%v", want, err)
+        }
+    }
+}
+
+func TestConfig_SecretFileFlagAndFileFormat(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+
+    dir := t.TempDir()
+    secret := filepath.Join(dir, "password")
+    if err := os.WriteFile(secret, []byte("from-flag\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := config.Load([]string{"--zinc-password-file", secret})
+    if err != nil || cfg.ZincSearchPassword != "from-flag" {
+        t.Errorf("--zinc-password-file: contraseña %q, error %v", cfg.ZincSearchPassword, err)
+    }
+
+    // Un archivo TOML se lee igual que uno YAML: tablas para las secciones y listas nativas.
+    file := filepath.Join(dir, "server.toml")
+    content := "[zinc]\nurl = \"http://zinc:4080\"\n[zinc.timeouts]\nsearch = \"3s\"\n[cors.api]\nallowed_origins = [\"https://a.example\", \"https://b.example\"]\n"
+    if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err = config.Load([]string{"--config", file, "--zinc-password-file", secret})
+    if err != nil {
+        t.Fatalf("config TOML: %v", err)
+    }
+    if cfg.ZincSearchURL != "http://zinc:4080" || cfg.ZincTimeoutSearch != 3*time.Second || len(cfg.CORSAPI.AllowedOrigins) != 2 {
+        t.Errorf("config TOML inesperada: url %q, timeout %v, orígenes %v", cfg.ZincSearchURL, cfg.ZincTimeoutSearch, cfg.CORSAPI.AllowedOrigins)
+    }
+
+    // Otros formatos se rechazan con un mensaje claro.
+    file = filepath.Join(dir, "server.json")
+    if err := os.WriteFile(file, []byte(`{"zinc":{"url":"http://zinc:4080"}}`), 0600); err != nil {
+        t.Fatal(err)
+    }
+    _, err = config.Load([]string{"--config", file, "--zinc-password-file", secret})
+    if err == nil || !strings.Contains(err.Error(), "only YAML (.yaml, .yml) and TOML") {
+        t.Errorf("se esperaba un error de formato para %s, obtenido: %v", file, err)
+    }
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/config"
+    customMiddleware "server/internal/middleware"
+)
+
+func newCORSRouter() http.Handler {
+    r := chi.NewRouter()
+    r.Use(customMiddleware.CORS(
+        customMiddleware.CORSGroup{Prefix: "/api/", Policy: config.CORSPolicy{
+            AllowedOrigins: []string{"https://app.example.com", "https://*.enron.test"},
+            AllowedMethods: []string{"GET", "POST"},
+            AllowedHeaders: []string{"Content-Type"},
+            ExposedHeaders: []string{"X-Request-ID"},
+            MaxAge:         10 * time.Minute,
+        }},
+        customMiddleware.CORSGroup{Prefix: "/api/admin/", Policy: config.CORSPolicy{}},
+    ))
+    ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+    r.Post("/api/search", ok)
+    r.Get("/api/admin/audit", ok)
+    return r
+}
+
+func TestCORS_AllowedOrigins(t *testing.T) {
+    router := newCORSRouter()
+
+    cases := []struct {
+        origin string
+        want   string
+    }{
+        {"https://app.example.com", "https://app.example.com"},
+        {"https://mail.enron.test", "https://mail.enron.test"},
+        {"https://enron.test", ""},
+        {"http://mail.enron.test", ""},
+        {"https://evil.com", ""},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest("POST", "/api/search", nil)
+        req.Header.Set("Origin", c.origin)
+        recorder := httptest.NewRecorder()
+        router.ServeHTTP(recorder, req)
+
+        if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != c.want {
+            t.Errorf("origen %s: Access-Control-Allow-Origin = %q, se esperaba %q", c.origin, got, c.want)
+        }
+        if got := recorder.Header().Get("Vary"); got != "Origin" {
+            t.Errorf("origen %s: Vary = %q, se esperaba Origin", c.origin, got)
+        }
+    }
+}
+
+func TestCORS_PreflightAndAdminGroup(t *testing.T) {
+    router := newCORSRouter()
+
+    req := httptest.NewRequest("OPTIONS", "/api/search", nil)
+    req.Header.Set("Origin", "https://app.example.com")
+    req.Header.Set("Access-Control-Request-Method", "POST")
+    recorder := httptest.NewRecorder()
+    router.ServeHTTP(recorder, req)
+
+    if recorder.Code != http.StatusNoContent {
+        t.Fatalf("preflight: se esperaba 204, se obtuvo %d", recorder.Code)
+    }
+    if got := recorder.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+        t.Errorf("Access-Control-Allow-Methods = %q", got)
+    }
+    if got := recorder.Header().Get("Access-Control-Max-Age"); got != "600" {
+        t.Errorf("Access-Control-Max-Age = %q", got)
+    }
+
+    // Los endpoints de administración no permiten ningún origen por defecto.
+    req = httptest.NewRequest("GET", "/api/admin/audit", nil)
+    req.Header.Set("Origin", "https://app.example.com")
+    recorder = httptest.NewRecorder()
+    router.ServeHTTP(recorder, req)
+    if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "" {
+        t.Errorf("admin no debería permitir el origen, se obtuvo %q", got)
+    }
+}
+
+func TestCORS_DefaultsAllowAPIKeyHeader(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    cfg, err := config.Load(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := chi.NewRouter()
+    r.Use(customMiddleware.CORS(
+        customMiddleware.CORSGroup{Prefix: "/api/", Policy: cfg.CORSAPI},
+        customMiddleware.CORSGroup{Prefix: "/api/admin/", Policy: cfg.CORSAdmin},
+    ))
+    r.Post("/api/search", func(w http.ResponseWriter, r *http.Request) {})
+
+    // El frontend envía la API key en X-API-Key: el preflight debe permitirla.
+    req := httptest.NewRequest("OPTIONS", "/api/search", nil)
+    req.Header.Set("Origin", "https://app.example.com")
+    req.Header.Set("Access-Control-Request-Method", "POST")
+    req.Header.Set("Access-Control-Request-Headers", "content-type,x-api-key")
+    recorder := httptest.NewRecorder()
+    r.ServeHTTP(recorder, req)
+    if got := recorder.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "X-API-Key") {
+        t.Errorf("Access-Control-Allow-Headers = %q, falta X-API-Key", got)
+    }
+    if !strings.Contains(strings.Join(cfg.CORSAdmin.AllowedHeaders, ","), "X-API-Key") {
+        t.Errorf("cors.admin.allowed_headers = %v, falta X-API-Key", cfg.CORSAdmin.AllowedHeaders)
+    }
+}
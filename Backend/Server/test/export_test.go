@@ -0,0 +1,116 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+
+    "server/config"
+    "server/internal/handlers"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+func newTestExportHandler(t *testing.T, transport http.RoundTripper) http.HandlerFunc {
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    searchService := services.NewSearchService(cfg, zinc.NewClient(cfg, transport))
+    exportService := services.NewExportService(cfg, searchService)
+    h := handlers.NewExportHandler(exportService)
+    return h.Handle
+}
+
+func TestExportHandler_CSV(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    mockZincResponse := `{
+        "hits": {
+            "hits": [
+                { "_id": "a1", "_source": { "subject": "Test Email 1", "from": "sender@example.com", "message_id": "1", "custodian": "allen-p", "folder_path": "allen-p/inbox" } },
+                { "_id": "a2", "_source": { "subject": "Test, Email 2", "from": "sender2@example.com", "message_id": "2" } }
+            ],
+            "total": { "value": 2 }
+        }
+    }`
+
+    transport := &MockTransport{
+        mockResponse: &http.Response{
+            StatusCode: 200,
+            Body:       ioutil.NopCloser(bytes.NewBufferString(mockZincResponse)),
+            Header:     make(http.Header),
+        },
+    }
+
+    req := httptest.NewRequest("GET", "/api/export?term=test&format=csv&columns=id,subject,custodian,folder_path", nil)
+    recorder := httptest.NewRecorder()
+
+    handlerFunc := newTestExportHandler(t, transport)
+    handlerFunc(recorder, req)
+
+    res := recorder.Result()
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, res.StatusCode)
+    }
+    if contentType := res.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+        t.Errorf("Content-Type inesperado: %s", contentType)
+    }
+
+    bodyBytes, err := ioutil.ReadAll(res.Body)
+    if err != nil {
+        t.Fatalf("Error al leer el cuerpo de la respuesta: %v", err)
+    }
+    expected := "id,subject,custodian,folder_path\na1,Test Email 1,allen-p,allen-p/inbox\na2,\"Test, Email 2\",,\n"
+    if string(bodyBytes) != expected {
+        t.Errorf("CSV no coincide.\nEsperado: %q\nObtenido: %q", expected, string(bodyBytes))
+    }
+}
+
+func TestExportHandler_InvalidFormat(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    req := httptest.NewRequest("GET", "/api/export?term=test&format=pdf", nil)
+    recorder := httptest.NewRecorder()
+
+    handlerFunc := newTestExportHandler(t, nil)
+    handlerFunc(recorder, req)
+
+    if recorder.Code != http.StatusBadRequest {
+        t.Errorf("Esperado status code %d, obtenido %d", http.StatusBadRequest, recorder.Code)
+    }
+}
+
+func TestExportHandler_ScanSortsPages(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    transport := &QueryCaptureTransport{body: `{"hits":{"total":{"value":1},"hits":[{"_id":"a1","_source":{"subject":"Test Email 1"}}]}}`}
+
+    req := httptest.NewRequest("GET", "/api/export?term=test&format=csv&fields=id", nil)
+    recorder := httptest.NewRecorder()
+    newTestExportHandler(t, transport)(recorder, req)
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+
+    // Las páginas de la exportación se piden con un orden estable para que from/size no repita
+    // ni omita documentos.
+    if len(transport.queries) != 1 || !strings.Contains(transport.queries[0], `"sort_fields":["_id"]`) {
+        t.Errorf("consultas inesperadas: %v", transport.queries)
+    }
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "server/config"
+    "server/internal/acl"
+    "server/internal/auth"
+    "server/internal/handlers"
+    "server/internal/models"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+func TestFolders_FromIndexAggregation(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    transport := &QueryCaptureTransport{body: `{"hits":{"total":{"value":5},"hits":[]},"aggregations":{"folders":{"buckets":[` +
+        `{"key":"allen-p/sent","doc_count":3},{"key":"allen-p/inbox","doc_count":2},{"key":"allen-p/inbox/2001","doc_count":1},` +
+        `{"key":"lay-k/inbox","doc_count":4},{"key":"lay-k/sent","doc_count":1},{"key":"skilling-j/inbox","doc_count":7}]}}}`}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    if cfg.FoldersSource != services.FolderSourceIndex {
+        t.Fatalf("el origen por defecto debería ser %q, obtenido %q", services.FolderSourceIndex, cfg.FoldersSource)
+    }
+    folderService := services.NewFolderService(cfg, zinc.NewClient(cfg, transport))
+    scope := loadTestACL(t).ScopeFor(&auth.Principal{Subject: "ana", Roles: []string{"reviewer"}})
+
+    req := httptest.NewRequest("GET", "/api/folders", nil)
+    req = req.WithContext(acl.WithScope(req.Context(), scope))
+    recorder := httptest.NewRecorder()
+    handlers.NewFoldersHandler(folderService).Handle(recorder, req)
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+
+    var tree models.FolderNode
+    if err := json.NewDecoder(recorder.Body).Decode(&tree); err != nil {
+        t.Fatal(err)
+    }
+    // allen-p completo (3 + 2 + 1) y de lay-k solo inbox; skilling-j queda fuera del alcance.
+    if tree.Total != 10 || len(tree.Children) != 2 {
+        t.Fatalf("árbol inesperado: %s", recorder.Body.String())
+    }
+    allen, lay := tree.Children[0], tree.Children[1]
+    if allen.Name != "allen-p" || allen.Total != 6 || allen.Count != 0 || lay.Name != "lay-k" || lay.Total != 4 {
+        t.Errorf("custodios inesperados: %+v %+v", allen, lay)
+    }
+    if inbox := allen.Children[0]; inbox.Path != "allen-p/inbox" || inbox.Count != 2 || inbox.Total != 3 ||
+        len(inbox.Children) != 1 || inbox.Children[0].Path != "allen-p/inbox/2001" || allen.Children[1].Name != "sent" {
+        t.Errorf("subcarpetas inesperadas de allen-p: %+v", allen.Children)
+    }
+
+    var query struct {
+        MaxResults int `json:"max_results"`
+        Aggs       map[string]struct {
+            AggType string `json:"agg_type"`
+            Field   string `json:"field"`
+        } `json:"aggs"`
+    }
+    if err := json.Unmarshal([]byte(transport.queries[0]), &query); err != nil {
+        t.Fatal(err)
+    }
+    if agg := query.Aggs["folders"]; query.MaxResults != 0 || agg.AggType != "term" || agg.Field != "folder_path" {
+        t.Errorf("consulta de agregación inesperada: %s", transport.queries[0])
+    }
+}
+
+
+func TestFolders_SubtreeAndDepthFromFilesystem(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    root := t.TempDir()
+    for _, file := range []string{"kaminski-v/all_documents/1.", "kaminski-v/all_documents/2.", "kaminski-v/discussion_threads/a/1.", "kaminski-v/discussion_threads/a/b/1."} {
+        path := filepath.Join(root, "maildir", filepath.FromSlash(file))
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte("Subject: test\n"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    os.Setenv("FOLDERS_SOURCE", "filesystem")
+    os.Setenv("FOLDERS_ROOT", root)
+    defer os.Unsetenv("FOLDERS_SOURCE")
+    defer os.Unsetenv("FOLDERS_ROOT")
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    handler := handlers.NewFoldersHandler(services.NewFolderService(cfg, zinc.NewClient(cfg, nil)))
+
+    recorder := httptest.NewRecorder()
+    handler.Handle(recorder, httptest.NewRequest("GET", "/api/folders?root=kaminski-v/discussion_threads&depth=1", nil))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+    var tree models.FolderNode
+    if err := json.NewDecoder(recorder.Body).Decode(&tree); err != nil {
+        t.Fatal(err)
+    }
+    if tree.Path != "kaminski-v/discussion_threads" || tree.Total != 2 || len(tree.Children) != 1 {
+        t.Fatalf("subárbol inesperado: %+v", tree)
+    }
+    if a := tree.Children[0]; a.Count != 1 || a.Total != 2 || !a.HasChildren || len(a.Children) != 0 {
+        t.Errorf("depth=1 debería recortar los nietos y conservar has_children: %+v", a)
+    }
+
+    for query, status := range map[string]int{"root=kaminski-v/missing": http.StatusNotFound, "depth=-1": http.StatusBadRequest} {
+        recorder := httptest.NewRecorder()
+        handler.Handle(recorder, httptest.NewRequest("GET", "/api/folders?"+query, nil))
+        if recorder.Code != status {
+            t.Errorf("%s: esperado status code %d, obtenido %d", query, status, recorder.Code)
+        }
+    }
+}
+
+func TestFolders_CachedWithETagAndChangeDetection(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    root := t.TempDir()
+    inbox := filepath.Join(root, "allen-p", "inbox")
+    if err := os.MkdirAll(inbox, 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(inbox, "1."), []byte("Subject: test\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    os.Setenv("FOLDERS_SOURCE", "filesystem")
+    os.Setenv("FOLDERS_ROOT", root)
+    defer os.Unsetenv("FOLDERS_SOURCE")
+    defer os.Unsetenv("FOLDERS_ROOT")
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    folderService := services.NewFolderService(cfg, zinc.NewClient(cfg, nil))
+    handler := handlers.NewFoldersHandler(folderService)
+    get := func(etag string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("GET", "/api/folders", nil)
+        if etag != "" {
+            req.Header.Set("If-None-Match", etag)
+        }
+        recorder := httptest.NewRecorder()
+        handler.Handle(recorder, req)
+        return recorder
+    }
+
+    first := get("")
+    etag := first.Header().Get("ETag")
+    if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+        t.Fatalf("la primera respuesta debería tener ETag y Last-Modified: %d %v", first.Code, first.Header())
+    }
+    if second := get(etag); second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+        t.Errorf("con If-None-Match vigente se esperaba 304 sin cuerpo, obtenido %d %q", second.Code, second.Body.String())
+    }
+
+    // Un correo nuevo no se ve hasta que se detecta el cambio en la carpeta.
+    if err := os.WriteFile(filepath.Join(inbox, "2."), []byte("Subject: test\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    future := time.Now().Add(time.Minute)
+    if err := os.Chtimes(inbox, future, future); err != nil {
+        t.Fatal(err)
+    }
+    if cached := get(etag); cached.Code != http.StatusNotModified {
+        t.Errorf("el árbol debería seguir en caché hasta la siguiente comprobación, obtenido %d", cached.Code)
+    }
+    changed, err := folderService.RefreshIfChanged(context.Background())
+    if err != nil || !changed {
+        t.Fatalf("RefreshIfChanged debería detectar el cambio: %v %v", changed, err)
+    }
+    if changed, _ := folderService.RefreshIfChanged(context.Background()); changed {
+        t.Error("sin cambios RefreshIfChanged no debería volver a leer el origen")
+    }
+
+    third := get(etag)
+    var tree models.FolderNode
+    if err := json.NewDecoder(third.Body).Decode(&tree); err != nil {
+        t.Fatal(err)
+    }
+    if third.Code != http.StatusOK || third.Header().Get("ETag") == etag || tree.Total != 2 {
+        t.Errorf("tras el cambio se esperaba un árbol nuevo con 2 correos: %d %s total=%d", third.Code, third.Header().Get("ETag"), tree.Total)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "runtime"
+    "strings"
+    "testing"
+
+    "server/config"
+    "server/internal/handlers"
+    "server/internal/logging"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+// HealthTransport responde a /api/index/<índice> con indexStatus e indexBody y a cualquier otra
+// ruta (el /healthz de ZincSearch y la agregación de carpetas) con 200.
+type HealthTransport struct {
+    indexStatus int
+    indexBody   string
+}
+
+func (h *HealthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    status, body := http.StatusOK, `{"hits":{"total":{"value":1},"hits":[]},"aggregations":{"folders":{"buckets":[{"key":"allen-p/inbox","doc_count":1}]}}}`
+    if strings.HasPrefix(req.URL.Path, "/api/index/") {
+        status, body = h.indexStatus, h.indexBody
+    }
+    return &http.Response{
+        StatusCode: status,
+        Body:       io.NopCloser(bytes.NewBufferString(body)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func newTestHealthHandler(t *testing.T, transport http.RoundTripper) (*handlers.HealthHandler, *services.HealthService) {
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    client := zinc.NewClient(cfg, transport)
+    healthService := services.NewHealthService(cfg, client, services.NewFolderService(cfg, client))
+    return handlers.NewHealthHandler(client, healthService), healthService
+}
+
+func TestHealth_Liveness(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    // /healthz no depende de ZincSearch: responde 200 aunque el índice no exista.
+    transport := &HealthTransport{indexStatus: http.StatusNotFound, indexBody: `{"error":"not found"}`}
+
+    healthHandler, _ := newTestHealthHandler(t, transport)
+    recorder := httptest.NewRecorder()
+    healthHandler.HandleLiveness(recorder, httptest.NewRequest("GET", "/healthz", nil))
+    if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"status":"ok"`) {
+        t.Errorf("respuesta inesperada de /healthz: %d %s", recorder.Code, recorder.Body.String())
+    }
+}
+
+func TestHealth_Readiness(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    var logs bytes.Buffer
+    logging.Setup(&logs, "json", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+    defer logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+
+    tests := []struct {
+        name         string
+        indexStatus  int
+        indexBody    string
+        shuttingDown bool
+        wantStatus   int
+        wantCheck    string
+        wantError    string
+    }{
+        {name: "listo", indexStatus: http.StatusOK, indexBody: `{"stats":{"doc_num":10}}`, wantStatus: http.StatusOK},
+        {name: "índice vacío", indexStatus: http.StatusOK, indexBody: `{"stats":{"doc_num":0}}`,
+            wantStatus: http.StatusServiceUnavailable, wantCheck: "index", wantError: "has 0 documents"},
+        // Las comprobaciones del índice devuelven un mensaje propio, no el error de ZincSearch.
+        {name: "índice inexistente (404)", indexStatus: http.StatusNotFound, indexBody: `{"error":"not found"}`,
+            wantStatus: http.StatusServiceUnavailable, wantCheck: "index", wantError: `" does not exist`},
+        {name: "índice inexistente (400)", indexStatus: http.StatusBadRequest, indexBody: `{"error":"index enron_mail does not exist"}`,
+            wantStatus: http.StatusServiceUnavailable, wantCheck: "index", wantError: `" does not exist`},
+        {name: "en apagado", indexStatus: http.StatusOK, indexBody: `{"stats":{"doc_num":10}}`, shuttingDown: true,
+            wantStatus: http.StatusServiceUnavailable, wantCheck: "shutdown", wantError: "shutting down"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            transport := &HealthTransport{indexStatus: tt.indexStatus, indexBody: tt.indexBody}
+
+            healthHandler, healthService := newTestHealthHandler(t, transport)
+            if tt.shuttingDown {
+                healthService.SetShuttingDown()
+            }
+            recorder := httptest.NewRecorder()
+            healthHandler.HandleReadiness(recorder, httptest.NewRequest("GET", "/readyz", nil))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("Esperado status code %d, obtenido %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+            }
+
+            var readiness services.Readiness
+            if err := json.NewDecoder(recorder.Body).Decode(&readiness); err != nil {
+                t.Fatal(err)
+            }
+            if readiness.Ready != (tt.wantStatus == http.StatusOK) {
+                t.Errorf("ready = %v con status %d", readiness.Ready, recorder.Code)
+            }
+            for _, check := range readiness.Checks {
+                switch {
+                case check.Name == tt.wantCheck:
+                    if check.OK || !strings.Contains(check.Error, tt.wantError) {
+                        t.Errorf("comprobación %q inesperada: %+v", check.Name, check)
+                    }
+                case !check.OK:
+                    t.Errorf("la comprobación %q no debería fallar: %+v", check.Name, check)
+                }
+            }
+        })
+    }
+
+    // La comprobación de carpetas pide un solo bucket: no es una lista truncada.
+    if strings.Contains(logs.String(), "truncated") {
+        t.Errorf("/readyz no debería avisar de carpetas truncadas:\n%s", logs.String())
+    }
+}
+
+func TestHealth_Version(t *testing.T) {
+    recorder := httptest.NewRecorder()
+    handlers.NewVersionHandler(handlers.BuildInfo{Version: "1.2.3", Commit: "abc123"}).
+        Handle(recorder, httptest.NewRequest("GET", "/version", nil))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, recorder.Code)
+    }
+
+    var info handlers.BuildInfo
+    if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+        t.Fatal(err)
+    }
+    // Los valores de ldflags tienen prioridad sobre los metadatos de VCS del binario.
+    if info.Version != "1.2.3" || info.Commit != "abc123" || info.GoVersion != runtime.Version() {
+        t.Errorf("versión inesperada: %+v", info)
+    }
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/internal/handlers"
+    "server/internal/logging"
+    customMiddleware "server/internal/middleware"
+)
+
+func TestRequestID_InLogsAndErrorEnvelope(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    var logs bytes.Buffer
+    logging.Setup(&logs, "json", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 8})
+    defer logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+
+    r := chi.NewRouter()
+    r.Use(customMiddleware.RequestID)
+    r.Use(customMiddleware.RequestLogger)
+    r.Post("/api/search", newTestSearchHandler(t, nil))
+
+    req := httptest.NewRequest("POST", "/api/search", strings.NewReader("invalid json"))
+    req.Header.Set("X-Request-ID", "req-123")
+    recorder := httptest.NewRecorder()
+    r.ServeHTTP(recorder, req)
+
+    if got := recorder.Header().Get("X-Request-ID"); got != "req-123" {
+        t.Errorf("X-Request-ID de la respuesta no coincide: %q", got)
+    }
+
+    var envelope struct {
+        Error handlers.ErrorBody `json:"error"`
+    }
+    if err := json.NewDecoder(recorder.Body).Decode(&envelope); err != nil {
+        t.Fatalf("Error al leer el cuerpo de la respuesta: %v", err)
+    }
+    if envelope.Error.RequestID != "req-123" {
+        t.Errorf("El envoltorio de error no incluye el request ID: %+v", envelope.Error)
+    }
+    if !strings.Contains(logs.String(), `"request_id":"req-123"`) {
+        t.Errorf("La línea de log no incluye el request ID: %s", logs.String())
+    }
+}
+
+func TestRedactionPolicy(t *testing.T) {
+    var logs bytes.Buffer
+    defer logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+
+    cases := []struct {
+        policy   logging.Policy
+        expected string
+    }{
+        {logging.Policy{Mode: logging.RedactTruncate, MaxLen: 5}, "confi…"},
+        {logging.Policy{Mode: logging.RedactNone}, "confidential merger"},
+        {logging.Policy{Mode: logging.RedactFull}, "[redacted_len=19]"},
+        {logging.Policy{Mode: logging.RedactHash, HashKey: []byte("clave")}, "hmac:" + testHMAC("clave", "confidential merger")},
+    }
+    for _, c := range cases {
+        logs.Reset()
+        logging.Setup(&logs, "json", "info", c.policy)
+        if got := logging.Redact("confidential merger").String(); got != c.expected {
+            t.Errorf("Política %q: esperado %q, obtenido %q", c.policy.Mode, c.expected, got)
+        }
+    }
+}
+
+func testHMAC(key, value string) string {
+    mac := hmac.New(sha256.New, []byte(key))
+    mac.Write([]byte(value))
+    return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func TestRedactionPolicy_HashIsKeyed(t *testing.T) {
+    defer logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+
+    // Sin clave configurada se usa una aleatoria del proceso: el resultado no es el sha256 sin
+    // sal del término, pero sigue agrupando valores iguales.
+    logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactHash})
+    sum := sha256.Sum256([]byte("gas"))
+    first, second := logging.Redact("gas").String(), logging.Redact("gas").String()
+    if first != second || !strings.HasPrefix(first, "hmac:") || strings.Contains(first, hex.EncodeToString(sum[:6])) {
+        t.Errorf("hash sin clave inesperado: %q, %q", first, second)
+    }
+
+    logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactHash, HashKey: []byte("otra")})
+    if got := logging.Redact("gas").String(); got == first || got != "hmac:"+testHMAC("otra", "gas") {
+        t.Errorf("el hash debería depender de la clave: %q", got)
+    }
+}
+
+func TestRedactionPolicy_ConcurrentSetup(t *testing.T) {
+    defer logging.Setup(os.Stderr, "text", "info", logging.Policy{Mode: logging.RedactTruncate, MaxLen: 32})
+
+    // Cambiar la política mientras otras goroutines registran no debe ser una carrera (go test -race).
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                logging.Redact("confidential merger")
+            }
+        }()
+        go func() {
+            defer wg.Done()
+            logging.Setup(&bytes.Buffer{}, "json", "info", logging.Policy{Mode: logging.RedactFull})
+        }()
+    }
+    wg.Wait()
+}
@@ -3,6 +3,7 @@ package main
 import (
     "bytes"
     "encoding/json"
+    "errors"
     "io/ioutil"
     "net/http"
     "net/http/httptest"
@@ -14,6 +15,7 @@ import (
     "server/internal/handlers"
     "server/internal/models"
     "server/internal/services"
+    "server/internal/zinc"
 )
 
 // MockTransport es una estructura que implementa http.RoundTripper para mockear respuestas.
@@ -27,14 +29,14 @@ func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
     return m.mockResponse, m.mockError
 }
 
-func newTestSearchHandler(t *testing.T) http.HandlerFunc {
+func newTestSearchHandler(t *testing.T, transport http.RoundTripper) http.HandlerFunc {
     // Usamos una configuración dummy o de test
     cfg, err := config.LoadConfig()
     if err != nil {
         t.Fatalf("Error en LoadConfig: %v", err)
     }
     // Crea el servicio de búsqueda y el handler
-    searchService := services.NewSearchService(cfg)
+    searchService := services.NewSearchService(cfg, zinc.NewClient(cfg, transport))
     h := handlers.NewSearchHandler(searchService)
     return h.Handle
 }
@@ -55,7 +57,7 @@ func TestSearchHandler(t *testing.T) {
         }
     }`
 
-    mockTransport := &MockTransport{
+    transport := &MockTransport{
         mockResponse: &http.Response{
             StatusCode: 200,
             Body:       ioutil.NopCloser(bytes.NewBufferString(mockZincResponse)),
@@ -63,9 +65,6 @@ func TestSearchHandler(t *testing.T) {
         },
         mockError: nil,
     }
-    originalTransport := http.DefaultTransport
-    http.DefaultTransport = mockTransport
-    defer func() { http.DefaultTransport = originalTransport }()
 
     searchReq := models.SearchRequest{
         Term:  "Hello",
@@ -82,7 +81,7 @@ func TestSearchHandler(t *testing.T) {
     req.Header.Set("Content-Type", "application/json")
     recorder := httptest.NewRecorder()
 
-    handlerFunc := newTestSearchHandler(t)
+    handlerFunc := newTestSearchHandler(t, transport)
     handlerFunc(recorder, req)
 
     res := recorder.Result()
@@ -113,7 +112,7 @@ func TestSearchHandler_InvalidPayload(t *testing.T) {
     req.Header.Set("Content-Type", "application/json")
     recorder := httptest.NewRecorder()
 
-    handlerFunc := newTestSearchHandler(t)
+    handlerFunc := newTestSearchHandler(t, nil)
     handlerFunc(recorder, req)
 
     res := recorder.Result()
@@ -123,13 +122,18 @@ func TestSearchHandler_InvalidPayload(t *testing.T) {
         t.Errorf("Esperado status code %d, obtenido %d", http.StatusBadRequest, res.StatusCode)
     }
 
-    bodyBytes, err := ioutil.ReadAll(res.Body)
-    if err != nil {
+    var envelope struct {
+        Error handlers.ErrorBody `json:"error"`
+    }
+    if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
         t.Fatalf("Error al leer el cuerpo de la respuesta: %v", err)
     }
-    expectedMessage := "Invalid request payload\n"
-    if string(bodyBytes) != expectedMessage {
-        t.Errorf("Mensaje de error no coincide.\nEsperado: %s\nObtenido: %s", expectedMessage, string(bodyBytes))
+    expectedMessage := "Invalid request payload"
+    if envelope.Error.Message != expectedMessage {
+        t.Errorf("Mensaje de error no coincide.\nEsperado: %s\nObtenido: %s", expectedMessage, envelope.Error.Message)
+    }
+    if envelope.Error.Status != http.StatusBadRequest {
+        t.Errorf("Status del envoltorio no coincide: %d", envelope.Error.Status)
     }
 }
 
@@ -148,7 +152,7 @@ func TestSearchHandler_DefaultField(t *testing.T) {
         }
     }`
 
-    mockTransport := &MockTransport{
+    transport := &MockTransport{
         mockResponse: &http.Response{
             StatusCode: 200,
             Body:       ioutil.NopCloser(bytes.NewBufferString(mockZincResponse)),
@@ -156,9 +160,6 @@ func TestSearchHandler_DefaultField(t *testing.T) {
         },
         mockError: nil,
     }
-    originalTransport := http.DefaultTransport
-    http.DefaultTransport = mockTransport
-    defer func() { http.DefaultTransport = originalTransport }()
 
     searchReq := models.SearchRequest{
         Term:  "Default",
@@ -175,7 +176,7 @@ func TestSearchHandler_DefaultField(t *testing.T) {
     req.Header.Set("Content-Type", "application/json")
     recorder := httptest.NewRecorder()
 
-    handlerFunc := newTestSearchHandler(t)
+    handlerFunc := newTestSearchHandler(t, transport)
     handlerFunc(recorder, req)
 
     res := recorder.Result()
@@ -196,6 +197,116 @@ func TestSearchHandler_DefaultField(t *testing.T) {
     }
 }
 
+func TestSearchHandler_ExactFolderFilters(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("CACHE_ENABLED", "false")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("CACHE_ENABLED")
+
+    transport := &QueryCaptureTransport{body: `{"hits":{"total":{"value":0},"hits":[]}}`}
+
+    handlerFunc := newTestSearchHandler(t, transport)
+    cases := []struct {
+        body string
+        want string
+    }{
+        {`{"term":"gas","custodian":" lay-k ","folder_path":"/lay-k/inbox/"}`, `+body:(gas) +custodian:"lay-k" +folder_path:"lay-k/inbox"`},
+        {`{"term":"*","folder_path":"allen-p/sent"}`, `+folder_path:"allen-p/sent"`},
+    }
+    for i, c := range cases {
+        recorder := httptest.NewRecorder()
+        handlerFunc(recorder, httptest.NewRequest("POST", "/api/search", strings.NewReader(c.body)))
+        if recorder.Code != http.StatusOK {
+            t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+        }
+        var query struct {
+            SearchType string `json:"search_type"`
+            Query      struct {
+                Term string `json:"term"`
+            } `json:"query"`
+        }
+        if err := json.Unmarshal([]byte(transport.queries[i]), &query); err != nil {
+            t.Fatal(err)
+        }
+        if query.SearchType != "querystring" || query.Query.Term != c.want {
+            t.Errorf("consulta inesperada para %s:\n  obtenida %s %s\n  esperada querystring %s", c.body, query.SearchType, query.Query.Term, c.want)
+        }
+    }
+
+    recorder := httptest.NewRecorder()
+    handlerFunc(recorder, httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"term":"gas","field":"body:x","custodian":"lay-k"}`)))
+    if recorder.Code != http.StatusBadRequest {
+        t.Errorf("un campo no válido con filtros debería dar %d, obtenido %d", http.StatusBadRequest, recorder.Code)
+    }
+}
+
 // Nota: Para TestSearchHandler_ZincSearchError se recomienda refactorizar el handler
 // para que retorne errores en lugar de llamar a log.Fatal y así poder testearlo.
-// Se deja comentado o pendiente de refactorización.
\ No newline at end of file
+// Se deja comentado o pendiente de refactorización.
+
+// BlockingTransport simula un ZincSearch colgado: no responde hasta que se cancela la solicitud.
+type BlockingTransport struct{}
+
+func (BlockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    <-req.Context().Done()
+    return nil, req.Context().Err()
+}
+
+func TestSearchHandler_Timeout(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("ZINC_TIMEOUT_SEARCH", "50ms")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("ZINC_TIMEOUT_SEARCH")
+
+    transport := BlockingTransport{}
+
+    req := httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"term":"Hello","size":5}`))
+    req.Header.Set("Content-Type", "application/json")
+    recorder := httptest.NewRecorder()
+
+    handlerFunc := newTestSearchHandler(t, transport)
+    handlerFunc(recorder, req)
+
+    if recorder.Code != http.StatusGatewayTimeout {
+        t.Errorf("Esperado status code %d, obtenido %d", http.StatusGatewayTimeout, recorder.Code)
+    }
+}
+
+
+func TestSearchHandler_CircuitOpen(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    os.Setenv("ZINC_RETRY_MAX", "0")
+    os.Setenv("ZINC_BREAKER_THRESHOLD", "1")
+    os.Setenv("ZINC_BREAKER_COOLDOWN", "30s")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+    defer os.Unsetenv("ZINC_RETRY_MAX")
+    defer os.Unsetenv("ZINC_BREAKER_THRESHOLD")
+    defer os.Unsetenv("ZINC_BREAKER_COOLDOWN")
+
+    transport := &MockTransport{
+        mockError: errors.New("connection refused"),
+    }
+
+    handlerFunc := newTestSearchHandler(t, transport)
+
+    // El primer fallo abre el circuito; la segunda búsqueda ya no llega a ZincSearch.
+    expectedCodes := []int{http.StatusInternalServerError, http.StatusServiceUnavailable}
+    for i, expected := range expectedCodes {
+        req := httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"term":"Hello","size":5}`))
+        recorder := httptest.NewRecorder()
+        handlerFunc(recorder, req)
+
+        if recorder.Code != expected {
+            t.Fatalf("Solicitud %d: esperado status code %d, obtenido %d", i+1, expected, recorder.Code)
+        }
+        if expected == http.StatusServiceUnavailable && recorder.Header().Get("Retry-After") == "" {
+            t.Errorf("Falta la cabecera Retry-After en la respuesta 503")
+        }
+    }
+}
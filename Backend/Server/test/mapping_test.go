@@ -0,0 +1,181 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "server/config"
+    "server/internal/mapping"
+    "server/internal/services"
+    "server/internal/zinc"
+)
+
+// sharedMappingFile es el mapping versionado que también usa el indexador.
+const sharedMappingFile = "../../Mapping/emails.json"
+
+// IndexTransport responde a /api/index/<índice> con body y a cualquier otra ruta con un objeto vacío.
+type IndexTransport struct {
+    body string
+}
+
+func (i *IndexTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    body := `{}`
+    if strings.HasPrefix(req.URL.Path, "/api/index/") {
+        body = i.body
+    }
+    return &http.Response{
+        StatusCode: 200,
+        Body:       io.NopCloser(bytes.NewBufferString(body)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func TestMapping_SharedFileLoads(t *testing.T) {
+    m, err := mapping.Load(sharedMappingFile)
+    if err != nil {
+        t.Fatalf("mapping.Load: %v", err)
+    }
+    if m.Version < 1 {
+        t.Errorf("versión inesperada: %d", m.Version)
+    }
+    // El árbol de carpetas y los filtros exactos dependen de estos campos keyword agregables.
+    for _, field := range []string{"custodian", "folder_path", "folder_leaf", "file_name"} {
+        if p := m.Mappings.Properties[field]; p.Type != "keyword" || !p.Aggregatable {
+            t.Errorf("%s debería ser keyword agregable: %+v", field, p)
+        }
+    }
+    if p := m.Mappings.Properties["sent_at"]; p.Type != "date" || p.Format == "" {
+        t.Errorf("sent_at debería ser date con formato: %+v", p)
+    }
+
+    file := filepath.Join(t.TempDir(), "bad.json")
+    if err := os.WriteFile(file, []byte(`{"version":0,"mappings":{"properties":{"body":{"type":"txt"}}}}`), 0600); err != nil {
+        t.Fatal(err)
+    }
+    _, err = mapping.Load(file)
+    if err == nil || !strings.Contains(err.Error(), "version") || !strings.Contains(err.Error(), `"txt"`) {
+        t.Errorf("se esperaban los errores de versión y tipo, obtenido: %v", err)
+    }
+}
+
+func TestMapping_HealthComparesIndex(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    m, err := mapping.Load(sharedMappingFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Índice creado por una versión anterior: todo texto inferido y sin los campos nuevos.
+    properties := map[string]mapping.Property{}
+    for _, field := range m.Fields() {
+        properties[field] = m.Mappings.Properties[field]
+    }
+    properties["custodian"] = mapping.Property{Type: "text", Index: true}
+    delete(properties, "sent_at")
+    payload, _ := json.Marshal(map[string]interface{}{
+        "mappings": map[string]interface{}{"properties": properties},
+        "stats":    map[string]int{"doc_num": 10},
+    })
+    transport := &IndexTransport{body: string(payload)}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    client := zinc.NewClient(cfg, transport)
+    healthService := services.NewHealthService(cfg, client, services.NewFolderService(cfg, client))
+    healthService.SetMapping(m)
+
+    diff, err := healthService.CheckMapping(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff.Compatible() || len(diff.Missing) != 1 || diff.Missing[0] != "sent_at" ||
+        len(diff.Conflicts) != 1 || !strings.HasPrefix(diff.Conflicts[0], "custodian:") {
+        t.Errorf("diferencias inesperadas: %+v", diff)
+    }
+
+    // /readyz informa las diferencias sin dejar de estar listo.
+    for _, check := range healthService.Readiness(context.Background()).Checks {
+        if check.Name != "index" {
+            continue
+        }
+        if !check.OK || check.Details["mapping_version"] != m.Version || check.Details["mapping_diff"] == nil {
+            t.Errorf("comprobación del índice inesperada: %+v", check)
+        }
+    }
+}
+
+func TestMapping_StrictNeedsFile(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    // Sin archivo no se comprueba el mapping, así que el servidor arranca desde cualquier carpeta.
+    cfg, err := config.Load(nil)
+    if err != nil || cfg.IndexMappingFile != "" {
+        t.Errorf("index.mapping_file por defecto: %q, error %v", cfg.IndexMappingFile, err)
+    }
+    _, err = config.Load([]string{"--index-mapping-strict"})
+    if err == nil || !strings.Contains(err.Error(), "index.mapping_strict") {
+        t.Errorf("se esperaba un error de index.mapping_strict, obtenido: %v", err)
+    }
+    _, err = config.Load([]string{"--index-mapping-file", "missing.json"})
+    if err == nil || !strings.Contains(err.Error(), "index.mapping_file") {
+        t.Errorf("se esperaba un error de index.mapping_file, obtenido: %v", err)
+    }
+    cfg, err = config.Load([]string{"--index-mapping-file", sharedMappingFile, "--index-mapping-strict"})
+    if err != nil || cfg.IndexMappingFile != sharedMappingFile || !cfg.IndexMappingStrict {
+        t.Errorf("configuración inesperada: %+v, %v", cfg, err)
+    }
+}
+
+// TestMapping_LoadsSharedFileLikeIndexer comprueba que el mapping cargado, serializado de nuevo,
+// es el archivo con las banderas no declaradas a false. El indexador
+// (TestLoadMapping_SharedFile) hace la misma comprobación con su copia del cargador, así que
+// ambos leen el archivo igual.
+func TestMapping_LoadsSharedFileLikeIndexer(t *testing.T) {
+    m, err := mapping.Load(sharedMappingFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := os.ReadFile(sharedMappingFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var want map[string]interface{}
+    if err := json.Unmarshal(data, &want); err != nil {
+        t.Fatal(err)
+    }
+    for _, property := range want["mappings"].(map[string]interface{})["properties"].(map[string]interface{}) {
+        for _, flag := range []string{"index", "store", "sortable", "aggregatable", "highlightable"} {
+            if _, ok := property.(map[string]interface{})[flag]; !ok {
+                property.(map[string]interface{})[flag] = false
+            }
+        }
+    }
+
+    loaded, err := json.Marshal(m)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got map[string]interface{}
+    if err := json.Unmarshal(loaded, &got); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("el mapping cargado no coincide con el archivo:\n obtenido %v\n esperado %v", got, want)
+    }
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/internal/metrics"
+    customMiddleware "server/internal/middleware"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+    r := chi.NewRouter()
+    r.Use(customMiddleware.Metrics)
+    r.Get("/api/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusTeapot)
+    })
+    r.Method("GET", "/metrics", metrics.Handler())
+
+    r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items/42", nil))
+
+    recorder := httptest.NewRecorder()
+    r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+    bodyBytes, err := ioutil.ReadAll(recorder.Result().Body)
+    if err != nil {
+        t.Fatalf("Error al leer el cuerpo de la respuesta: %v", err)
+    }
+    // La ruta se etiqueta con el patrón, no con la URL concreta.
+    expected := `emailsearch_http_requests_total{method="GET",route="/api/items/{id}",status="418"} 1`
+    if !strings.Contains(string(bodyBytes), expected) {
+        t.Errorf("No se encontró la métrica esperada: %s", expected)
+    }
+    if !strings.Contains(string(bodyBytes), "go_goroutines") {
+        t.Errorf("No se encontraron las métricas del runtime de Go")
+    }
+}
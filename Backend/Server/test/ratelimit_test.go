@@ -0,0 +1,134 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/config"
+    "server/internal/auth"
+    "server/internal/handlers"
+    customMiddleware "server/internal/middleware"
+    "server/internal/ratelimit"
+)
+
+func TestRateLimit_PerClientAndClass(t *testing.T) {
+    limiter := ratelimit.New(map[string]ratelimit.Budget{
+        ratelimit.ClassSearch: {Rate: 0.001, Burst: 2},
+        ratelimit.ClassExport: {Rate: 0.001, Burst: 1},
+    })
+    proxies, err := ratelimit.ParseTrustedProxies([]string{"10.0.0.0/8"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+    r := chi.NewRouter()
+    r.With(customMiddleware.RateLimit(limiter, proxies, ratelimit.ClassSearch)).Post("/api/search", ok)
+    r.With(customMiddleware.RateLimit(limiter, proxies, ratelimit.ClassExport)).Get("/api/export", ok)
+
+    do := func(method, path, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.RemoteAddr = remoteAddr
+        if forwardedFor != "" {
+            req.Header.Set("X-Forwarded-For", forwardedFor)
+        }
+        recorder := httptest.NewRecorder()
+        r.ServeHTTP(recorder, req)
+        return recorder
+    }
+
+    for i := 0; i < 2; i++ {
+        if rec := do("POST", "/api/search", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+            t.Fatalf("búsqueda %d: se esperaba 200, se obtuvo %d", i+1, rec.Code)
+        }
+    }
+    rec := do("POST", "/api/search", "192.0.2.1:1234", "")
+    if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+        t.Fatalf("tercera búsqueda: se esperaba 429 con Retry-After, se obtuvo %d %v", rec.Code, rec.Header())
+    }
+
+    // La exportación tiene su propio presupuesto.
+    if rec := do("GET", "/api/export", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+        t.Errorf("exportación: se esperaba 200, se obtuvo %d", rec.Code)
+    }
+    // Un X-Forwarded-For de un cliente directo no cambia la clave...
+    if rec := do("POST", "/api/search", "192.0.2.1:1234", "198.51.100.7"); rec.Code != http.StatusTooManyRequests {
+        t.Errorf("X-Forwarded-For no confiable: se esperaba 429, se obtuvo %d", rec.Code)
+    }
+    // ...pero detrás de un proxy de confianza cada cliente tiene su bucket.
+    if rec := do("POST", "/api/search", "10.1.2.3:5555", "198.51.100.7, 10.0.0.5"); rec.Code != http.StatusOK {
+        t.Errorf("cliente detrás de proxy: se esperaba 200, se obtuvo %d", rec.Code)
+    }
+}
+
+func TestRateLimit_RuntimeUpdate(t *testing.T) {
+    limiter := ratelimit.New(map[string]ratelimit.Budget{ratelimit.ClassExport: {Rate: 0.001, Burst: 1}})
+    handler := handlers.NewRateLimitHandler(limiter)
+
+    if !limiter.Allow(ratelimit.ClassExport, "ip:1").Allowed || limiter.Allow(ratelimit.ClassExport, "ip:1").Allowed {
+        t.Fatal("el presupuesto inicial debería permitir una sola exportación")
+    }
+
+    recorder := httptest.NewRecorder()
+    handler.HandleUpdate(recorder, httptest.NewRequest("PUT", "/api/admin/ratelimits", strings.NewReader(`{"export":{"rate":1000,"burst":5}}`)))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+    }
+    // El bucket existente se rellena a la nueva tasa.
+    time.Sleep(20 * time.Millisecond)
+    if !limiter.Allow(ratelimit.ClassExport, "ip:1").Allowed {
+        t.Error("el nuevo presupuesto debería aplicarse al bucket existente")
+    }
+
+    recorder = httptest.NewRecorder()
+    handler.HandleUpdate(recorder, httptest.NewRequest("PUT", "/api/admin/ratelimits", strings.NewReader(`{"export":{"rate":1,"burst":0}}`)))
+    if recorder.Code != http.StatusBadRequest {
+        t.Errorf("presupuesto inválido: se esperaba 400, se obtuvo %d", recorder.Code)
+    }
+}
+
+func TestRateLimit_FailedAuthentication(t *testing.T) {
+    limiter := ratelimit.New(map[string]ratelimit.Budget{ratelimit.ClassAuth: {Rate: 0.001, Burst: 2}})
+    authenticator, err := auth.New(&config.Config{AuthEnabled: true, AuthAPIKeys: []string{"frontend:" + auth.HashAPIKey("secret-key")}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := chi.NewRouter()
+    r.Use(customMiddleware.LimitFailedAuth(limiter, nil))
+    r.Use(customMiddleware.Authenticate(authenticator))
+    r.Get("/api/folders", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+    do := func(remoteAddr, apiKey string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("GET", "/api/folders", nil)
+        req.RemoteAddr = remoteAddr
+        req.Header.Set("X-API-Key", apiKey)
+        recorder := httptest.NewRecorder()
+        r.ServeHTTP(recorder, req)
+        return recorder
+    }
+
+    // Las solicitudes autenticadas no consumen el presupuesto de fallos.
+    for i := 0; i < 3; i++ {
+        if rec := do("192.0.2.1:1234", "secret-key"); rec.Code != http.StatusOK {
+            t.Fatalf("clave válida %d: se esperaba 200, se obtuvo %d", i+1, rec.Code)
+        }
+    }
+    for i := 0; i < 2; i++ {
+        if rec := do("192.0.2.1:1234", "guess"); rec.Code != http.StatusUnauthorized {
+            t.Fatalf("intento %d: se esperaba 401, se obtuvo %d", i+1, rec.Code)
+        }
+    }
+    // Agotado el presupuesto, la IP recibe 429 sin que se validen sus credenciales.
+    rec := do("192.0.2.1:1234", "secret-key")
+    if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+        t.Errorf("tras los fallos: se esperaba 429 con Retry-After, se obtuvo %d %v", rec.Code, rec.Header())
+    }
+    if rec := do("198.51.100.7:1234", "secret-key"); rec.Code != http.StatusOK {
+        t.Errorf("otra IP: se esperaba 200, se obtuvo %d", rec.Code)
+    }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/go-chi/chi/v5"
+
+    "server/config"
+    "server/internal/handlers"
+    customMiddleware "server/internal/middleware"
+    "server/internal/services"
+    "server/internal/tracing"
+    "server/internal/zinc"
+)
+
+// HeaderCaptureTransport guarda las cabeceras de la última solicitud enviada a ZincSearch.
+type HeaderCaptureTransport struct {
+    header http.Header
+}
+
+func (h *HeaderCaptureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    h.header = req.Header.Clone()
+    return &http.Response{
+        StatusCode: 200,
+        Body:       ioutil.NopCloser(bytes.NewBufferString(`{"hits":{"hits":[],"total":{"value":0}}}`)),
+        Header:     make(http.Header),
+    }, nil
+}
+
+func TestTracing_PropagatesTraceparent(t *testing.T) {
+    os.Setenv("ZINC_FIRST_ADMIN_USER", "testuser")
+    os.Setenv("ZINC_FIRST_ADMIN_PASSWORD", "testpass")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_USER")
+    defer os.Unsetenv("ZINC_FIRST_ADMIN_PASSWORD")
+
+    transport := &HeaderCaptureTransport{}
+
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        t.Fatalf("Error en LoadConfig: %v", err)
+    }
+    shutdown, err := tracing.Setup(context.Background(), cfg)
+    if err != nil {
+        t.Fatalf("Error en tracing.Setup: %v", err)
+    }
+    defer shutdown(context.Background())
+
+    searchHandler := handlers.NewSearchHandler(services.NewSearchService(cfg, zinc.NewClient(cfg, transport)))
+    r := chi.NewRouter()
+    r.Use(customMiddleware.Tracing)
+    r.Post("/api/search", searchHandler.Handle)
+
+    const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+    req := httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"term":"Hello","size":5}`))
+    req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+    recorder := httptest.NewRecorder()
+    r.ServeHTTP(recorder, req)
+
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("Esperado status code %d, obtenido %d", http.StatusOK, recorder.Code)
+    }
+    if got := transport.header.Get("traceparent"); !strings.Contains(got, traceID) {
+        t.Errorf("La solicitud a ZincSearch no continúa la traza del llamador: traceparent=%q", got)
+    }
+    if got := recorder.Header().Get("traceparent"); !strings.Contains(got, traceID) {
+        t.Errorf("La respuesta no incluye el traceparent de la traza: %q", got)
+    }
+}
@@ -3,6 +3,8 @@ import axios from 'axios';
 const api = axios.create({
   baseURL: 'http://localhost:8080/api',
   timeout: 5000, // Tiempo de espera para las solicitudes
+  // API key opcional, necesaria cuando el servidor tiene AUTH_ENABLED=true.
+  headers: import.meta.env.VITE_API_KEY ? { 'X-API-Key': import.meta.env.VITE_API_KEY } : {},
 });
 
 // Interceptor para manejar errores globalmente
@@ -19,14 +21,16 @@ api.interceptors.response.use(
  * @param {Object} params - Parámetros de búsqueda.
  * @param {string} params.term - Término de búsqueda.
  * @param {string} params.field - Campo para buscar.
+ * @param {string} [params.folderPath] - Carpeta exacta (folder_path) a la que limitar la búsqueda.
  * @param {number} params.from - Índice inicial para la paginación.
  * @param {number} params.size - Tamaño de la página.
  * @returns {Promise<Object>} - Resultado de la búsqueda.
  */
-export const fetchEmails = async ({ term, field, from, size }) => {
+export const fetchEmails = async ({ term, field, folderPath, from, size }) => {
   const response = await api.post('/search', {
     term: term || '*',
     field,
+    folder_path: folderPath || undefined,
     from,
     size,
   });
@@ -1,7 +1,20 @@
 // language: javascript
-export async function fetchFolders() {
+/**
+ * Obtiene el árbol de carpetas. Cada nodo tiene name, path, count (correos propios),
+ * total (incluidas las subcarpetas), has_children y children.
+ * @param {Object} [params]
+ * @param {string} [params.root] - Ruta del subárbol a pedir (por ejemplo, "allen-p").
+ * @param {number} [params.depth] - Niveles por debajo de root (0 o ausente: todos).
+ * @returns {Promise<Object>} - Nodo raíz del árbol pedido.
+ */
+export async function fetchFolders({ root, depth } = {}) {
     try {
-      const response = await fetch('http://localhost:8080/api/folders');
+      const headers = import.meta.env.VITE_API_KEY ? { 'X-API-Key': import.meta.env.VITE_API_KEY } : {};
+      const params = new URLSearchParams();
+      if (root) params.set('root', root);
+      if (depth) params.set('depth', depth);
+      const query = params.toString() ? `?${params}` : '';
+      const response = await fetch(`http://localhost:8080/api/folders${query}`, { headers });
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }
@@ -10,4 +23,19 @@ export async function fetchFolders() {
       console.error("Error fetching folders:", error);
       throw error;
     }
-  }
\ No newline at end of file
+  }
+
+/**
+ * Aplana las subcarpetas de un nodo (en orden, a cualquier profundidad) para listarlas.
+ * @param {Object} node - Nodo devuelto por fetchFolders.
+ * @returns {Array<{path: string, name: string, level: number, total: number}>} - La ruta es relativa a node.
+ */
+export function flattenFolders(node, prefix = '', level = 0) {
+    const result = [];
+    for (const child of node.children || []) {
+      const path = prefix ? `${prefix}/${child.name}` : child.name;
+      result.push({ path, name: child.name, level, total: child.total });
+      result.push(...flattenFolders(child, path, level + 1));
+    }
+    return result;
+  }
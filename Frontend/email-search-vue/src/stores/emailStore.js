@@ -16,7 +16,7 @@ import emailService from '../services/emailService';
  * @property {number} state.pageSize - Número de elementos por página.
  * @property {number} state.totalEmails - Total de correos electrónicos encontrados.
  * @property {number} state.totalPages - Total de páginas calculadas.
- * @property {string} state.folderFilter - Filtro de carpeta aplicado a la búsqueda.
+ * @property {string} state.folderFilter - Carpeta (folder_path, por ejemplo "allen-p/inbox") por la que se filtra de forma exacta.
  * @property {string} state.textFilter - Filtro de texto aplicado a la búsqueda.
  * @property {string} state.selectedField - Campo seleccionado para la búsqueda (_all por defecto).
  */
@@ -35,39 +35,23 @@ export const useEmailStore = defineStore('emailStore', {
   actions: {
     /**
      * Realiza la búsqueda de emails utilizando el servicio emailService.
-     * Combina los filtros de carpeta y texto, y calcula la paginación.
+     * El filtro de texto se busca en el campo seleccionado y el de carpeta se envía como filtro
+     * exacto (folder_path); después calcula la paginación.
      *
      * @async
      * @function fetchEmails
      * @returns {Promise<void>}
      */
     async fetchEmails() {
-      let combinedTerm = '';
-      if (this.folderFilter && this.textFilter) {
-        combinedTerm = `${this.folderFilter} ${this.textFilter}`;
-      } else if (this.folderFilter) {
-        combinedTerm = `${this.folderFilter}`;
-      } else if (this.textFilter) {
-        combinedTerm = `${this.textFilter}`;
-      }
-      
-      // Definir el campo a utilizar para la búsqueda
-      let searchField = this.selectedField;
-      if (this.folderFilter && this.textFilter) {
-        console.log("Los dos filtros están activos");
-        // Si se aplican ambos filtros, se fuerza el campo _all
-        searchField = '_all';
-      }
       try {
-        console.log("La búsqueda es:" + combinedTerm + " y el campo es:" + searchField);
         // Llamada al servicio para obtener emails
         const data = await emailService.fetchEmails({
-          term: combinedTerm,
-          field: searchField,
+          term: this.textFilter,
+          field: this.selectedField,
+          folderPath: this.folderFilter,
           from: this.page * this.pageSize,
           size: this.pageSize,
         });
-        console.log(combinedTerm);
         this.emails = data.hits.hits.map(hit => hit._source);
         this.totalEmails = data.hits.total ? data.hits.total.value : 0;
         this.totalPages = Math.ceil(this.totalEmails / this.pageSize);
@@ -121,8 +105,7 @@ export const useEmailStore = defineStore('emailStore', {
      * @param {string} sub - Subcarpeta seleccionada.
      */
     setFolderFilter(main, sub) {
-      const folderPath = `${main}/${sub}`;
-      this.folderFilter = 'enron_mail_20110402/maildir/' + folderPath;
+      this.folderFilter = `${main}/${sub}`;
       this.fetchEmails();
     },
   },